@@ -2,13 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/XXueTu/temjob/pkg"
 	"github.com/XXueTu/temjob/pkg/sdk"
 )
 
+// notification is the input of notification_workflow.
+type notification struct {
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject"`
+	Activity  string `json:"activity"`
+}
+
+func (n notification) Validate() error {
+	if n.Recipient == "" || n.Subject == "" {
+		return errors.New("recipient and subject are required")
+	}
+	return nil
+}
+
+type emailResult struct {
+	EmailSent bool   `json:"email_sent"`
+	SentAt    string `json:"sent_at"`
+}
+
+type activityResult struct {
+	Logged bool   `json:"logged"`
+	LogID  string `json:"log_id"`
+}
+
 func main() {
 	// Initialize client
 	client, err := sdk.NewClient(sdk.ClientConfig{
@@ -21,29 +47,25 @@ func main() {
 	}
 	defer client.Close()
 
-	// Register task handlers
-	client.RegisterTaskHandler("send_email", sdk.SimpleTaskHandler(func(input map[string]interface{}) (map[string]interface{}, error) {
-		recipient := input["recipient"].(string)
-		subject := input["subject"].(string)
-
+	// Register task handlers. Input that does not decode into the handler's
+	// input type fails the task without retries.
+	client.RegisterTaskHandler("send_email", sdk.TypedHandler(func(ctx context.Context, input notification) (emailResult, error) {
 		// Simulate sending email
-		fmt.Printf("Sending email to %s with subject: %s\n", recipient, subject)
+		fmt.Printf("Sending email to %s with subject: %s\n", input.Recipient, input.Subject)
 		time.Sleep(1 * time.Second)
 
-		return map[string]interface{}{
-			"email_sent": true,
-			"sent_at":    time.Now().Format(time.RFC3339),
+		return emailResult{
+			EmailSent: true,
+			SentAt:    time.Now().Format(time.RFC3339),
 		}, nil
 	}))
 
-	client.RegisterTaskHandler("log_activity", sdk.SimpleTaskHandler(func(input map[string]interface{}) (map[string]interface{}, error) {
-		activity := input["activity"].(string)
+	client.RegisterTaskHandler("log_activity", sdk.TypedHandler(func(ctx context.Context, input notification) (activityResult, error) {
+		fmt.Printf("Logging activity: %s\n", input.Activity)
 
-		fmt.Printf("Logging activity: %s\n", activity)
-
-		return map[string]interface{}{
-			"logged": true,
-			"log_id": "log_" + time.Now().Format("20060102150405"),
+		return activityResult{
+			Logged: true,
+			LogID:  "log_" + time.Now().Format("20060102150405"),
 		}, nil
 	}))
 
@@ -57,6 +79,7 @@ func main() {
 		}), 3).
 		AddStep("send_email").Then().
 		AddStep("log_activity").DependsOn("send_email").Then().
+		ValidateInput(sdk.ValidateInputAs[notification]()).
 		Build()
 
 	// Register workflow
@@ -80,36 +103,26 @@ func main() {
 	// Wait for services to start
 	time.Sleep(2 * time.Second)
 
-	// Submit workflow
-	workflowID, err := client.SubmitWorkflow(ctx, "notification_workflow", map[string]interface{}{
-		"recipient": "user@example.com",
-		"subject":   "Welcome to TemJob!",
-		"activity":  "User registration notification sent",
+	// Submit workflow and wait for its result
+	input, err := sdk.EncodeInput(notification{
+		Recipient: "user@example.com",
+		Subject:   "Welcome to TemJob!",
+		Activity:  "User registration notification sent",
 	})
 	if err != nil {
-		log.Fatal("Failed to submit workflow:", err)
+		log.Fatal("Failed to encode input:", err)
 	}
 
-	fmt.Printf("Submitted workflow: %s\n", workflowID)
-
-	// Monitor workflow progress
-	for {
-		workflow, err := client.GetWorkflow(ctx, workflowID)
-		if err != nil {
-			log.Printf("Failed to get workflow: %v", err)
-			break
-		}
+	workflow, err := client.SubmitAndWait(ctx, "notification_workflow", input, pkg.SubmitOptions{})
 
-		fmt.Printf("Workflow %s state: %s\n", workflowID, workflow.State)
-
-		if workflow.State == "completed" || workflow.State == "failed" {
-			fmt.Printf("Workflow finished with state: %s\n", workflow.State)
-			if workflow.Output != nil {
-				fmt.Printf("Output: %+v\n", workflow.Output)
-			}
-			break
-		}
-
-		time.Sleep(2 * time.Second)
+	var workflowErr *sdk.WorkflowError
+	if errors.As(err, &workflowErr) {
+		log.Fatalf("Workflow %s %s: %s", workflowErr.WorkflowID, workflowErr.State, workflowErr.Reason)
+	}
+	if err != nil {
+		log.Fatal("Failed to run workflow:", err)
 	}
+
+	fmt.Printf("Workflow %s completed\n", workflow.ID)
+	fmt.Printf("Output: %+v\n", workflow.Output)
 }
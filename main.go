@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
 	"os"
@@ -77,8 +78,15 @@ func main() {
 	stateManager := state.NewMySQLStateManager(db, redisClient, logger)
 	taskQueue := queue.NewRedisTaskQueue(redisClient, logger, stateManager)
 	engine := workflow.NewEngine(stateManager, taskQueue, logger)
+	engine.SetWebhookSecret(cfg.Webhooks.Secret)
 	workerInstance := worker.NewWorker(taskQueue, stateManager, logger)
 
+	for taskType, limit := range cfg.RateLimits {
+		if err := taskQueue.SetRateLimit(context.Background(), taskType, pkg.RateLimit{Rate: limit.Rate, Burst: limit.Burst}); err != nil {
+			logger.Fatal("Failed to set rate limit", zap.String("task_type", taskType), zap.Error(err))
+		}
+	}
+
 	// Register example workflow
 	registerExampleWorkflow(engine, workerInstance)
 
@@ -116,6 +124,19 @@ func main() {
 		}
 	}()
 
+	// Start gRPC server
+	var grpcServer *web.GRPCServer
+	if cfg.Server.GRPCPort != "" {
+		grpcServer = web.NewGRPCServer(stateManager, engine, logger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := grpcServer.Start(cfg.Server.GRPCPort); err != nil {
+				logger.Error("gRPC server error", zap.Error(err))
+			}
+		}()
+	}
+
 	// Submit example workflow
 	go func() {
 		time.Sleep(2 * time.Second)
@@ -144,6 +165,9 @@ func main() {
 	// Stop components
 	engine.Stop()
 	workerInstance.Stop()
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
 
 	// Wait for all goroutines to finish
 	done := make(chan struct{})
@@ -160,36 +184,67 @@ func main() {
 	}
 }
 
+// fileInput is the input of the example data_processing workflow.
+type fileInput struct {
+	InputFile string `json:"input_file"`
+}
+
+func (in fileInput) Validate() error {
+	if in.InputFile == "" {
+		return errors.New("input_file is required")
+	}
+	return nil
+}
+
+type validateOutput struct {
+	Validated bool   `json:"validated"`
+	FileSize  int    `json:"file_size"`
+	InputFile string `json:"input_file"`
+}
+
+type processOutput struct {
+	ProcessedRecords int    `json:"processed_records"`
+	InputFile        string `json:"input_file"`
+	OutputFile       string `json:"output_file"`
+}
+
+type reportInput struct {
+	InputFile  string `json:"input_file"`
+	OutputFile string `json:"output_file"`
+}
+
+type reportOutput struct {
+	ReportFile string `json:"report_file"`
+	Summary    string `json:"summary"`
+}
+
 func registerExampleWorkflow(engine pkg.WorkflowEngine, worker pkg.Worker) {
 	// Register task handlers
-	worker.RegisterTaskHandler("validate_input", sdk.SimpleTaskHandler(func(input map[string]interface{}) (map[string]interface{}, error) {
-		inputFile := input["input_file"].(string)
-		return map[string]interface{}{
-			"validated":  true,
-			"file_size":  1024,
-			"input_file": inputFile,
+	worker.RegisterTaskHandler("validate_input", sdk.TypedHandler(func(ctx context.Context, input fileInput) (validateOutput, error) {
+		return validateOutput{
+			Validated: true,
+			FileSize:  1024,
+			InputFile: input.InputFile,
 		}, nil
 	}))
 
-	worker.RegisterTaskHandler("process_data", sdk.SimpleTaskHandler(func(input map[string]interface{}) (map[string]interface{}, error) {
-		inputFile := input["input_file"].(string)
-		return map[string]interface{}{
-			"processed_records": 100,
-			"input_file":        inputFile,
-			"output_file":       "processed_" + inputFile,
+	worker.RegisterTaskHandler("process_data", sdk.TypedHandler(func(ctx context.Context, input fileInput) (processOutput, error) {
+		return processOutput{
+			ProcessedRecords: 100,
+			InputFile:        input.InputFile,
+			OutputFile:       "processed_" + input.InputFile,
 		}, nil
 	}))
 
-	worker.RegisterTaskHandler("generate_report", sdk.SimpleTaskHandler(func(input map[string]interface{}) (map[string]interface{}, error) {
-		outputFile, ok := input["output_file"].(string)
-		if !ok || outputFile == "" {
+	worker.RegisterTaskHandler("generate_report", sdk.TypedHandler(func(ctx context.Context, input reportInput) (reportOutput, error) {
+		outputFile := input.OutputFile
+		if outputFile == "" {
 			// If output_file is not available, use input_file as fallback
-			inputFile, _ := input["input_file"].(string)
-			outputFile = "processed_" + inputFile
+			outputFile = "processed_" + input.InputFile
 		}
-		return map[string]interface{}{
-			"report_file": "report_" + outputFile,
-			"summary":     "Data processing completed successfully",
+		return reportOutput{
+			ReportFile: "report_" + outputFile,
+			Summary:    "Data processing completed successfully",
 		}, nil
 	}))
 
@@ -207,6 +262,7 @@ func registerExampleWorkflow(engine pkg.WorkflowEngine, worker pkg.Worker) {
 		AddStep("validate_input").Then().
 		AddStep("process_data").DependsOn("validate_input").Then().
 		AddStep("generate_report").DependsOn("process_data").Then().
+		ValidateInput(sdk.ValidateInputAs[fileInput]()).
 		Build()
 
 	engine.RegisterWorkflow(workflowDef)
@@ -15,6 +15,9 @@ type Config struct {
 	Worker   WorkerConfig   `yaml:"worker"`
 	Engine   EngineConfig   `yaml:"engine"`
 	Logging  LoggingConfig  `yaml:"logging"`
+	// RateLimits maps task types to their fleet-wide dispatch limits
+	RateLimits map[string]RateLimitConfig `yaml:"rate_limits"`
+	Webhooks   WebhookConfig              `yaml:"webhooks"`
 }
 
 type DatabaseConfig struct {
@@ -43,6 +46,8 @@ type RedisConfig struct {
 type ServerConfig struct {
 	Port string `yaml:"port"`
 	Mode string `yaml:"mode"`
+	// GRPCPort serves the gRPC API when set.
+	GRPCPort string `yaml:"grpc_port"`
 }
 
 type WorkerConfig struct {
@@ -56,6 +61,17 @@ type EngineConfig struct {
 	MaxWorkflowTimeout  time.Duration `yaml:"max_workflow_timeout"`
 }
 
+type RateLimitConfig struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+type WebhookConfig struct {
+	// Secret signs webhook deliveries; workflows with webhooks are rejected
+	// without it.
+	Secret string `yaml:"secret"`
+}
+
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
@@ -7,14 +7,19 @@ import (
 )
 
 type WorkflowModel struct {
-	ID        string    `gorm:"type:varchar(36);primary_key" json:"id"`
+	ID        string    `gorm:"type:varchar(128);primary_key" json:"id"`
 	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
 	Input     string    `gorm:"type:json" json:"input"`
 	Output    string    `gorm:"type:json" json:"output"`
 	State     string    `gorm:"type:varchar(50);not null;index" json:"state"`
+	Error     string    `gorm:"type:text" json:"error"`
 	CreatedAt time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
 	StartedAt *time.Time `gorm:"type:datetime;null" json:"started_at"`
 	EndedAt   *time.Time `gorm:"type:datetime;null" json:"ended_at"`
+	ConcurrencyKey string `gorm:"type:varchar(255);index" json:"concurrency_key"`
+	WaitingReason  string `gorm:"type:varchar(255)" json:"waiting_reason"`
+	Priority       int    `gorm:"type:int;default:0" json:"priority"`
+	Webhooks       string `gorm:"type:json" json:"webhooks"`
 	Tasks     []TaskModel `gorm:"foreignKey:WorkflowID" json:"tasks,omitempty"`
 }
 
@@ -24,8 +29,9 @@ func (WorkflowModel) TableName() string {
 
 type TaskModel struct {
 	ID          string     `gorm:"type:varchar(36);primary_key" json:"id"`
-	WorkflowID  string     `gorm:"type:varchar(36);not null;index" json:"workflow_id"`
+	WorkflowID  string     `gorm:"type:varchar(128);not null;index" json:"workflow_id"`
 	Type        string     `gorm:"type:varchar(255);not null" json:"type"`
+	Kind        string     `gorm:"type:varchar(50)" json:"kind"`
 	Input       string     `gorm:"type:json" json:"input"`
 	Output      string     `gorm:"type:json" json:"output"`
 	State       string     `gorm:"type:varchar(50);not null;index" json:"state"`
@@ -36,6 +42,11 @@ type TaskModel struct {
 	StartedAt   *time.Time `gorm:"type:datetime;null" json:"started_at"`
 	CompletedAt *time.Time `gorm:"type:datetime;null" json:"completed_at"`
 	WorkerID    string     `gorm:"type:varchar(255)" json:"worker_id"`
+	WakeAt      *time.Time `gorm:"type:datetime;null" json:"wake_at"`
+	Approval    string     `gorm:"type:json" json:"approval"`
+	Attempts    string     `gorm:"type:json" json:"attempts"`
+	Priority    int        `gorm:"type:int;default:0" json:"priority"`
+	Progress    string     `gorm:"type:json" json:"progress"`
 	Workflow    WorkflowModel `gorm:"foreignKey:WorkflowID" json:"workflow,omitempty"`
 }
 
@@ -45,8 +56,9 @@ func (TaskModel) TableName() string {
 
 type WorkflowExecutionLog struct {
 	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	WorkflowID string    `gorm:"type:varchar(36);not null;index" json:"workflow_id"`
+	WorkflowID string    `gorm:"type:varchar(128);not null;index" json:"workflow_id"`
 	TaskID     string    `gorm:"type:varchar(36);index" json:"task_id"`
+	EventType  string    `gorm:"type:varchar(50);index" json:"event_type"`
 	Level      string    `gorm:"type:varchar(20);not null" json:"level"`
 	Message    string    `gorm:"type:text;not null" json:"message"`
 	Metadata   string    `gorm:"type:json" json:"metadata"`
@@ -57,10 +69,134 @@ func (WorkflowExecutionLog) TableName() string {
 	return "workflow_execution_logs"
 }
 
+type WorkflowSignal struct {
+	ID         string     `gorm:"type:varchar(36);primary_key" json:"id"`
+	WorkflowID string     `gorm:"type:varchar(128);not null;index:idx_signal_lookup" json:"workflow_id"`
+	Name       string     `gorm:"type:varchar(255);not null;index:idx_signal_lookup" json:"name"`
+	Payload    string     `gorm:"type:json" json:"payload"`
+	CreatedAt  time.Time  `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ConsumedAt *time.Time `gorm:"type:datetime;null" json:"consumed_at"`
+}
+
+func (WorkflowSignal) TableName() string {
+	return "workflow_signals"
+}
+
+type ScheduleModel struct {
+	ID             string     `gorm:"type:varchar(64);primary_key" json:"id"`
+	WorkflowName   string     `gorm:"type:varchar(255);not null" json:"workflow_name"`
+	CronExpr       string     `gorm:"type:varchar(255)" json:"cron_expr"`
+	IntervalMs     int64      `gorm:"type:bigint;default:0" json:"interval_ms"`
+	Timezone       string     `gorm:"type:varchar(64)" json:"timezone"`
+	InputTemplate  string     `gorm:"type:json" json:"input_template"`
+	OverlapPolicy  string     `gorm:"type:varchar(20);not null" json:"overlap_policy"`
+	JitterMs       int64      `gorm:"type:bigint;default:0" json:"jitter_ms"`
+	Paused         bool       `gorm:"default:false" json:"paused"`
+	NextRunAt      *time.Time `gorm:"type:datetime(3);null;index" json:"next_run_at"`
+	LastRunAt      *time.Time `gorm:"type:datetime(3);null" json:"last_run_at"`
+	LastWorkflowID string     `gorm:"type:varchar(128)" json:"last_workflow_id"`
+	BufferedRuns   string     `gorm:"type:json" json:"buffered_runs"`
+	CreatedAt      time.Time  `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"type:datetime" json:"updated_at"`
+}
+
+func (ScheduleModel) TableName() string {
+	return "schedules"
+}
+
+// ConcurrencySlotModel records a workflow holding one of the concurrency
+// slots of a key.
+type ConcurrencySlotModel struct {
+	SlotKey    string    `gorm:"type:varchar(255);primaryKey" json:"slot_key"`
+	WorkflowID string    `gorm:"type:varchar(128);primaryKey" json:"workflow_id"`
+	CreatedAt  time.Time `gorm:"type:datetime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (ConcurrencySlotModel) TableName() string {
+	return "concurrency_slots"
+}
+
+// ConcurrencyKeyModel is the row engines lock to take turns acquiring the
+// slots of a key.
+type ConcurrencyKeyModel struct {
+	SlotKey string `gorm:"type:varchar(255);primaryKey" json:"slot_key"`
+}
+
+func (ConcurrencyKeyModel) TableName() string {
+	return "concurrency_keys"
+}
+
+// TaskLogModel is a line logged by a task handler; its ID is the entry's
+// sequence number.
+type TaskLogModel struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TaskID     string    `gorm:"type:varchar(36);not null;index" json:"task_id"`
+	WorkflowID string    `gorm:"type:varchar(128);not null" json:"workflow_id"`
+	Attempt    int       `gorm:"type:int;not null" json:"attempt"`
+	Level      string    `gorm:"type:varchar(20);not null" json:"level"`
+	Message    string    `gorm:"type:text;not null" json:"message"`
+	CreatedAt  time.Time `gorm:"type:datetime(3)" json:"created_at"`
+}
+
+func (TaskLogModel) TableName() string {
+	return "task_logs"
+}
+
+// WebhookDeliveryModel is one event sent to one webhook URL; NextAttemptAt
+// is null once the delivery is finished.
+type WebhookDeliveryModel struct {
+	ID             string     `gorm:"type:varchar(36);primary_key" json:"id"`
+	WorkflowID     string     `gorm:"type:varchar(128);not null;index" json:"workflow_id"`
+	TaskID         string     `gorm:"type:varchar(36)" json:"task_id"`
+	URL            string     `gorm:"type:varchar(2048);not null" json:"url"`
+	Event          string     `gorm:"type:varchar(50);not null" json:"event"`
+	Payload        string     `gorm:"type:json" json:"payload"`
+	State          string     `gorm:"type:varchar(20);not null" json:"state"`
+	Attempts       int        `gorm:"type:int;default:0" json:"attempts"`
+	ResponseStatus int        `gorm:"type:int;default:0" json:"response_status"`
+	Error          string     `gorm:"type:text" json:"error"`
+	NextAttemptAt  *time.Time `gorm:"type:datetime(3);null;index" json:"next_attempt_at"`
+	DeliveredAt    *time.Time `gorm:"type:datetime(3);null" json:"delivered_at"`
+	RedeliveryOf   string     `gorm:"type:varchar(36)" json:"redelivery_of"`
+	CreatedAt      time.Time  `gorm:"type:datetime(3)" json:"created_at"`
+}
+
+func (WebhookDeliveryModel) TableName() string {
+	return "webhook_deliveries"
+}
+
+// BackfillModel records the progress of a backfill. UpdatedAt drives its
+// retention.
+type BackfillModel struct {
+	ID           string     `gorm:"type:varchar(36);primary_key" json:"id"`
+	ScheduleID   string     `gorm:"type:varchar(64)" json:"schedule_id"`
+	WorkflowName string     `gorm:"type:varchar(255);not null" json:"workflow_name"`
+	Start        time.Time  `gorm:"type:datetime(3)" json:"start"`
+	End          time.Time  `gorm:"type:datetime(3)" json:"end"`
+	State        string     `gorm:"type:varchar(20);not null" json:"state"`
+	TotalRuns    int        `gorm:"type:int;default:0" json:"total_runs"`
+	WorkflowIDs  string     `gorm:"type:json" json:"workflow_ids"`
+	Error        string     `gorm:"type:text" json:"error"`
+	CreatedAt    time.Time  `gorm:"type:datetime(3)" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"type:datetime(3);index" json:"updated_at"`
+	EndedAt      *time.Time `gorm:"type:datetime(3);null" json:"ended_at"`
+}
+
+func (BackfillModel) TableName() string {
+	return "backfills"
+}
+
 func AutoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&WorkflowModel{},
 		&TaskModel{},
 		&WorkflowExecutionLog{},
+		&WorkflowSignal{},
+		&ScheduleModel{},
+		&ConcurrencySlotModel{},
+		&ConcurrencyKeyModel{},
+		&TaskLogModel{},
+		&WebhookDeliveryModel{},
+		&BackfillModel{},
 	)
 }
\ No newline at end of file
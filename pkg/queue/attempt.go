@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	cstate "github.com/XXueTu/temjob/pkg/state"
+)
+
+// Both task queues record the outcome of an attempt the same way; only
+// where they keep the task differs.
+
+type attemptResult struct {
+	workerID string
+	attempt  int
+	finished bool
+	retry    bool
+}
+
+// finishAttempt applies the outcome of the task's current attempt to task.
+// A finished attempt is appended to the task's attempts; a failed one with
+// retries left turns the task back to retrying for the caller to requeue.
+func finishAttempt(task *pkg.Task, state pkg.TaskState, output map[string]interface{}, errMsg string, retryable bool) attemptResult {
+	task.State = state
+	if output != nil {
+		task.Output = output
+	}
+	if errMsg != "" {
+		task.Error = errMsg
+	}
+
+	result := attemptResult{
+		workerID: task.WorkerID,
+		attempt:  task.RetryCount + 1,
+		finished: state == pkg.TaskStateCompleted || state == pkg.TaskStateFailed,
+		retry:    state == pkg.TaskStateFailed && retryable && task.RetryCount < task.MaxRetries,
+	}
+
+	if result.finished {
+		now := time.Now()
+		task.CompletedAt = &now
+		task.Attempts = append(task.Attempts, pkg.TaskAttempt{
+			Attempt:   result.attempt,
+			WorkerID:  result.workerID,
+			State:     state,
+			StartedAt: task.StartedAt,
+			EndedAt:   &now,
+			Error:     errMsg,
+			Output:    output,
+		})
+	}
+
+	if result.retry {
+		task.RetryCount++
+		task.State = pkg.TaskStateRetrying
+		task.WorkerID = ""
+		task.StartedAt = nil
+		task.CompletedAt = nil
+	}
+
+	return result
+}
+
+// recordAttempt records the history events of an attempt's outcome. The
+// retry_scheduled event is left to the caller, once the task is requeued.
+func recordAttempt(ctx context.Context, stateManager pkg.StateManager, logger *zap.Logger, task *pkg.Task, state pkg.TaskState, errMsg string, retryable bool, result attemptResult) {
+	switch state {
+	case pkg.TaskStateCompleted:
+		recordTaskEvent(ctx, stateManager, logger, task, pkg.EventTaskCompleted, "Task completed: "+task.Type, "info", nil)
+	case pkg.TaskStateFailed:
+		metadata := map[string]interface{}{
+			"attempt": result.attempt,
+			"error":   errMsg,
+		}
+		if !retryable {
+			metadata["retryable"] = false
+		}
+		recordTaskEvent(ctx, stateManager, logger, task, pkg.EventAttemptFailed, "Attempt failed: "+errMsg, "warn", metadata)
+		if !result.retry {
+			recordTaskEvent(ctx, stateManager, logger, task, pkg.EventTaskFailed, "Task failed: "+task.Type, "error", nil)
+		}
+	}
+}
+
+func recordTaskEvent(ctx context.Context, stateManager pkg.StateManager, logger *zap.Logger, task *pkg.Task, eventType pkg.EventType, message, level string, metadata map[string]interface{}) {
+	if stateManager == nil {
+		return
+	}
+
+	err := pkg.RecordEvent(ctx, stateManager, &pkg.HistoryEvent{
+		WorkflowID: task.WorkflowID,
+		TaskID:     task.ID,
+		Type:       eventType,
+		Level:      level,
+		Message:    message,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		logger.Warn("Failed to record history event", zap.String("task_id", task.ID), zap.String("event", string(eventType)), zap.Error(err))
+	}
+}
+
+// syncTask copies the queue's task data to the state manager.
+func syncTask(ctx context.Context, stateManager pkg.StateManager, logger *zap.Logger, task *pkg.Task) {
+	// Also update the state manager (MySQL) with the task state
+	if stateManager != nil {
+		if err := stateManager.SaveTask(ctx, task); err != nil {
+			logger.Warn("Failed to sync task state to state manager", zap.Error(err))
+		} else {
+			// Clear cache to ensure fresh data is retrieved
+			if mysqlState, ok := stateManager.(*cstate.MySQLStateManager); ok {
+				mysqlState.InvalidateCache(ctx, task.WorkflowID)
+			}
+		}
+	}
+}
+
+// applyProgress stores progress on task, stamped with the current attempt.
+// Only a running task takes progress, so a report arriving after the
+// attempt's outcome is rejected rather than written over it.
+func applyProgress(task *pkg.Task, progress pkg.TaskProgress) (pkg.TaskProgress, error) {
+	if task.State != pkg.TaskStateRunning {
+		return progress, fmt.Errorf("task %s is %s, not running", task.ID, task.State)
+	}
+
+	progress.Attempt = task.RetryCount + 1
+	if progress.UpdatedAt.IsZero() {
+		progress.UpdatedAt = time.Now()
+	}
+	task.Progress = &progress
+	return progress, nil
+}
+
+// publishProgress sends a task_progress event to live subscribers. It is
+// not written to the history, since a long task may report progress
+// thousands of times.
+func publishProgress(ctx context.Context, stateManager pkg.StateManager, logger *zap.Logger, task *pkg.Task, progress pkg.TaskProgress) {
+	bus, ok := stateManager.(pkg.EventBus)
+	if !ok {
+		return
+	}
+
+	err := bus.PublishEvent(ctx, &pkg.HistoryEvent{
+		WorkflowID: task.WorkflowID,
+		TaskID:     task.ID,
+		Type:       pkg.EventTaskProgress,
+		Level:      "info",
+		Message:    progress.Message,
+		Metadata: map[string]interface{}{
+			"percent": progress.Percent,
+			"current": progress.Current,
+			"total":   progress.Total,
+			"attempt": progress.Attempt,
+		},
+		CreatedAt: progress.UpdatedAt,
+	})
+	if err != nil {
+		logger.Warn("Failed to publish task progress", zap.String("task_id", task.ID), zap.Error(err))
+	}
+}
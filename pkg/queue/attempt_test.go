@@ -0,0 +1,28 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+func TestMemoryQueueNonRetryableFailure(t *testing.T) {
+	q, stateManager := newTestQueue(t)
+	ctx := context.Background()
+
+	task := enqueueTask(t, q, stateManager, "t", 3, 0)
+	dequeue(t, q, time.Second)
+	if err := q.FailTask(ctx, task.ID, "bad input", false); err != nil {
+		t.Fatalf("failed to fail task: %v", err)
+	}
+
+	stored, err := stateManager.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	if stored.State != pkg.TaskStateFailed || stored.RetryCount != 0 {
+		t.Errorf("task state = %s after %d retries, want failed without retries", stored.State, stored.RetryCount)
+	}
+}
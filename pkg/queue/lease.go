@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+const (
+	LeaseKey       = "temjob:queue:leases"
+	LeaseOwnersKey = "temjob:queue:lease:owners"
+)
+
+const reclaimBatchSize = 100
+
+// renewLeaseScript moves the expiry of the lease on ARGV[1] to ARGV[3] if
+// worker ARGV[2] still holds it. It returns 0 when the lease is gone.
+var renewLeaseScript = redis.NewScript(`
+if redis.call("HGET", KEYS[2], ARGV[1]) ~= ARGV[2] or not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// releaseLeaseScript drops the lease on ARGV[1] if worker ARGV[2] still
+// holds it. It returns 0 when the lease is gone.
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("HGET", KEYS[2], ARGV[1]) ~= ARGV[2] or not redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+return 1
+`)
+
+// claimExpiredLeaseScript drops the lease on ARGV[1] if it expired before
+// ARGV[2] and returns 1, so only one reclaimer fails the attempt.
+var claimExpiredLeaseScript = redis.NewScript(`
+local expiry = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not expiry or tonumber(expiry) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+return 1
+`)
+
+// AcquireLease leases a task the worker just dequeued until ttl from now.
+func (q *RedisTaskQueue) AcquireLease(ctx context.Context, taskID, workerID string, ttl time.Duration) (time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, LeaseOwnersKey, taskID, workerID)
+		pipe.ZAdd(ctx, LeaseKey, &redis.Z{Score: float64(expiresAt.UnixMilli()), Member: taskID})
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	return expiresAt, nil
+}
+
+func (q *RedisTaskQueue) RenewLease(ctx context.Context, taskID, workerID string, ttl time.Duration) (time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+
+	renewed, err := renewLeaseScript.Run(ctx, q.client, []string{LeaseKey, LeaseOwnersKey},
+		taskID, workerID, expiresAt.UnixMilli()).Int()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to renew lease: %w", err)
+	}
+	if renewed == 0 {
+		return time.Time{}, pkg.ErrLeaseLost
+	}
+	return expiresAt, nil
+}
+
+func (q *RedisTaskQueue) ReleaseLease(ctx context.Context, taskID, workerID string) error {
+	released, err := releaseLeaseScript.Run(ctx, q.client, []string{LeaseKey, LeaseOwnersKey},
+		taskID, workerID).Int()
+	if err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	if released == 0 {
+		return pkg.ErrLeaseLost
+	}
+	return nil
+}
+
+// ReclaimExpiredLeases fails the attempts of tasks whose lease expired and
+// returns how many it reclaimed.
+func (q *RedisTaskQueue) ReclaimExpiredLeases(ctx context.Context) (int, error) {
+	now := time.Now().UnixMilli()
+
+	taskIDs, err := q.client.ZRangeByScore(ctx, LeaseKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprint(now),
+		Count: reclaimBatchSize,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired leases: %w", err)
+	}
+
+	reclaimed := 0
+	for _, taskID := range taskIDs {
+		claimed, err := claimExpiredLeaseScript.Run(ctx, q.client, []string{LeaseKey, LeaseOwnersKey}, taskID, now).Int()
+		if err != nil {
+			return reclaimed, fmt.Errorf("failed to claim expired lease: %w", err)
+		}
+		if claimed == 0 {
+			continue
+		}
+
+		if err := q.UpdateTaskState(ctx, taskID, pkg.TaskStateFailed, nil, "task lease expired"); err != nil {
+			q.logger.Error("Failed to fail task with expired lease", zap.String("task_id", taskID), zap.Error(err))
+			continue
+		}
+		q.logger.Warn("Task lease expired", zap.String("task_id", taskID))
+		reclaimed++
+	}
+	return reclaimed, nil
+}
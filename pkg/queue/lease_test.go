@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+func TestMemoryQueueLeases(t *testing.T) {
+	q, stateManager := newTestQueue(t)
+	ctx := context.Background()
+
+	task := enqueueTask(t, q, stateManager, "t", 0, 0)
+	dequeue(t, q, time.Second)
+
+	if _, err := q.AcquireLease(ctx, task.ID, "worker", 50*time.Millisecond); err != nil {
+		t.Fatalf("failed to acquire lease: %v", err)
+	}
+	if _, err := q.RenewLease(ctx, task.ID, "other", time.Minute); !errors.Is(err, pkg.ErrLeaseLost) {
+		t.Errorf("renewal by another worker: err = %v, want ErrLeaseLost", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	reclaimed, err := q.ReclaimExpiredLeases(ctx)
+	if err != nil || reclaimed != 1 {
+		t.Fatalf("reclaimed %d, %v; want the expired lease", reclaimed, err)
+	}
+	if err := q.ReleaseLease(ctx, task.ID, "worker"); !errors.Is(err, pkg.ErrLeaseLost) {
+		t.Errorf("release after expiry: err = %v, want ErrLeaseLost", err)
+	}
+
+	stored, err := stateManager.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	if stored.State != pkg.TaskStateFailed || stored.Error != "task lease expired" {
+		t.Errorf("task state = %s (%q), want failed by lease expiry", stored.State, stored.Error)
+	}
+}
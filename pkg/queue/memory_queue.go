@@ -0,0 +1,401 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// memoryDequeueTimeout is how long Dequeue waits for a task before
+// returning nil, matching the blocking pop of RedisTaskQueue.
+const memoryDequeueTimeout = 30 * time.Second
+
+// MemoryTaskQueue is a task queue held in process memory, for tests and for
+// embedding temjob without Redis. It behaves like RedisTaskQueue: tasks are
+// handed out in FIFO order with positive priorities first, Dequeue blocks
+// until a task is ready, failed attempts are retried up to MaxRetries, and it
+// implements the same optional interfaces for rate limits, leases, progress
+// and non-retryable failures. Tasks are stored JSON-encoded so handlers see
+// inputs exactly as they would through Redis.
+type MemoryTaskQueue struct {
+	logger       *zap.Logger
+	stateManager pkg.StateManager
+
+	mu      sync.Mutex
+	tasks   map[string][]byte
+	ready   []string
+	delayed map[string]time.Time
+	// processing maps dequeued tasks to their worker until the outcome of
+	// the attempt is recorded.
+	processing map[string]string
+	leases     map[string]memoryLease
+	limits     map[string]pkg.RateLimit
+	buckets    map[string]*tokenBucket
+	// wake is closed and replaced whenever a task becomes ready, waking
+	// every blocked Dequeue.
+	wake chan struct{}
+}
+
+type memoryLease struct {
+	workerID  string
+	expiresAt time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewMemoryTaskQueue(logger *zap.Logger, stateManager pkg.StateManager) *MemoryTaskQueue {
+	return &MemoryTaskQueue{
+		logger:       logger,
+		stateManager: stateManager,
+		tasks:        make(map[string][]byte),
+		delayed:      make(map[string]time.Time),
+		processing:   make(map[string]string),
+		leases:       make(map[string]memoryLease),
+		limits:       make(map[string]pkg.RateLimit),
+		buckets:      make(map[string]*tokenBucket),
+		wake:         make(chan struct{}),
+	}
+}
+
+// Enqueue adds a task to the back of the queue, or to the front when it has
+// a positive priority so it runs before every task already waiting.
+func (q *MemoryTaskQueue) Enqueue(ctx context.Context, task *pkg.Task) error {
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	q.mu.Lock()
+	q.tasks[task.ID] = taskData
+	if task.Priority > 0 {
+		q.ready = append([]string{task.ID}, q.ready...)
+	} else {
+		q.ready = append(q.ready, task.ID)
+	}
+	q.wakeLocked()
+	q.mu.Unlock()
+
+	q.logger.Info("Task enqueued", zap.String("task_id", task.ID))
+	return nil
+}
+
+// Dequeue hands the next task to workerID, waiting up to 30 seconds for one
+// and returning nil when none arrives or ctx is done. A task whose type is
+// over its rate limit is delayed instead and nil is returned, as
+// RedisTaskQueue does.
+func (q *MemoryTaskQueue) Dequeue(ctx context.Context, workerID string) (*pkg.Task, error) {
+	deadline := time.Now().Add(memoryDequeueTimeout)
+
+	for {
+		q.mu.Lock()
+		next := q.promoteDelayedLocked(time.Now())
+		if len(q.ready) > 0 {
+			task, err := q.dequeueLocked(workerID)
+			q.mu.Unlock()
+			return task, err
+		}
+		wake := q.wake
+		q.mu.Unlock()
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, nil
+		}
+		if next > 0 && next < wait {
+			wait = next
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// dequeueLocked pops the next ready task; q.mu must be held.
+func (q *MemoryTaskQueue) dequeueLocked(workerID string) (*pkg.Task, error) {
+	taskID := q.ready[0]
+	q.ready = q.ready[1:]
+
+	var task pkg.Task
+	if err := json.Unmarshal(q.tasks[taskID], &task); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+
+	if delay := q.takeTokenLocked(task.Type, time.Now()); delay > 0 {
+		q.delayed[taskID] = time.Now().Add(delay)
+		q.logger.Debug("Task delayed by rate limit", zap.String("task_id", taskID), zap.String("task_type", task.Type), zap.Duration("delay", delay))
+		return nil, nil
+	}
+
+	task.State = pkg.TaskStateRunning
+	task.WorkerID = workerID
+	now := time.Now()
+	task.StartedAt = &now
+
+	if err := q.storeLocked(&task); err != nil {
+		return nil, err
+	}
+	q.processing[taskID] = workerID
+
+	q.logger.Info("Task dequeued", zap.String("task_id", task.ID), zap.String("worker_id", workerID))
+	return &task, nil
+}
+
+// UpdateTaskState records the outcome of the task's current attempt; see
+// RedisTaskQueue.UpdateTaskState.
+func (q *MemoryTaskQueue) UpdateTaskState(ctx context.Context, taskID string, state pkg.TaskState, output map[string]interface{}, errMsg string) error {
+	return q.updateTaskState(ctx, taskID, state, output, errMsg, true)
+}
+
+// FailTask fails the task's current attempt, retrying it only when retryable
+// is true and retries are left.
+func (q *MemoryTaskQueue) FailTask(ctx context.Context, taskID, errMsg string, retryable bool) error {
+	return q.updateTaskState(ctx, taskID, pkg.TaskStateFailed, nil, errMsg, retryable)
+}
+
+func (q *MemoryTaskQueue) updateTaskState(ctx context.Context, taskID string, state pkg.TaskState, output map[string]interface{}, errMsg string, retryable bool) error {
+	q.mu.Lock()
+	task, err := q.loadLocked(taskID)
+	if err != nil {
+		q.mu.Unlock()
+		return err
+	}
+
+	result := finishAttempt(task, state, output, errMsg, retryable)
+	if err := q.storeLocked(task); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	if result.finished {
+		delete(q.processing, taskID)
+	}
+	q.mu.Unlock()
+
+	syncTask(ctx, q.stateManager, q.logger, task)
+	recordAttempt(ctx, q.stateManager, q.logger, task, state, errMsg, retryable, result)
+
+	if result.retry {
+		if err := q.Enqueue(ctx, task); err != nil {
+			return fmt.Errorf("failed to requeue task for retry: %w", err)
+		}
+
+		recordTaskEvent(ctx, q.stateManager, q.logger, task, pkg.EventRetryScheduled, "Retry scheduled: "+task.Type, "info", map[string]interface{}{
+			"attempt": task.RetryCount + 1,
+		})
+		q.logger.Info("Task requeued for retry", zap.String("task_id", taskID), zap.Int("retry_count", task.RetryCount))
+	}
+
+	q.logger.Info("Task state updated", zap.String("task_id", taskID), zap.String("state", string(state)))
+	return nil
+}
+
+// SetTaskProgress stores progress on a running task and publishes it as a
+// task_progress event.
+func (q *MemoryTaskQueue) SetTaskProgress(ctx context.Context, taskID string, progress pkg.TaskProgress) error {
+	q.mu.Lock()
+	task, err := q.loadLocked(taskID)
+	if err == nil {
+		progress, err = applyProgress(task, progress)
+	}
+	if err == nil {
+		err = q.storeLocked(task)
+	}
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	syncTask(ctx, q.stateManager, q.logger, task)
+	publishProgress(ctx, q.stateManager, q.logger, task, progress)
+	return nil
+}
+
+// SetRateLimit limits how fast tasks of taskType are dequeued. A
+// non-positive rate removes the limit.
+func (q *MemoryTaskQueue) SetRateLimit(ctx context.Context, taskType string, limit pkg.RateLimit) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if limit.Rate <= 0 {
+		delete(q.limits, taskType)
+	} else {
+		if limit.Burst <= 0 {
+			limit.Burst = int(math.Max(1, math.Ceil(limit.Rate)))
+		}
+		q.limits[taskType] = limit
+	}
+	delete(q.buckets, taskType)
+
+	q.logger.Info("Rate limit set", zap.String("task_type", taskType), zap.Float64("rate", limit.Rate), zap.Int("burst", limit.Burst))
+	return nil
+}
+
+// takeTokenLocked takes a token from taskType's bucket and returns how long
+// the task has to wait when none is left; q.mu must be held.
+func (q *MemoryTaskQueue) takeTokenLocked(taskType string, now time.Time) time.Duration {
+	limit, ok := q.limits[taskType]
+	if !ok {
+		return 0
+	}
+
+	bucket, ok := q.buckets[taskType]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		q.buckets[taskType] = bucket
+	}
+
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+math.Max(0, elapsed)*limit.Rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	return time.Duration(math.Ceil((1-bucket.tokens)*1000/limit.Rate)) * time.Millisecond
+}
+
+// promoteDelayedLocked moves due delayed tasks to the front of the queue and
+// returns how long until the next one is due, or zero when none is left;
+// q.mu must be held.
+func (q *MemoryTaskQueue) promoteDelayedLocked(now time.Time) time.Duration {
+	var next time.Duration
+	for taskID, dueAt := range q.delayed {
+		if !dueAt.After(now) {
+			delete(q.delayed, taskID)
+			q.ready = append([]string{taskID}, q.ready...)
+			continue
+		}
+		if wait := dueAt.Sub(now); next == 0 || wait < next {
+			next = wait
+		}
+	}
+	return next
+}
+
+func (q *MemoryTaskQueue) AcquireLease(ctx context.Context, taskID, workerID string, ttl time.Duration) (time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.leases[taskID] = memoryLease{workerID: workerID, expiresAt: expiresAt}
+	return expiresAt, nil
+}
+
+func (q *MemoryTaskQueue) RenewLease(ctx context.Context, taskID, workerID string, ttl time.Duration) (time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	lease, ok := q.leases[taskID]
+	if !ok || lease.workerID != workerID {
+		return time.Time{}, pkg.ErrLeaseLost
+	}
+	q.leases[taskID] = memoryLease{workerID: workerID, expiresAt: expiresAt}
+	return expiresAt, nil
+}
+
+func (q *MemoryTaskQueue) ReleaseLease(ctx context.Context, taskID, workerID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	lease, ok := q.leases[taskID]
+	if !ok || lease.workerID != workerID {
+		return pkg.ErrLeaseLost
+	}
+	delete(q.leases, taskID)
+	return nil
+}
+
+// ReclaimExpiredLeases fails the attempts of tasks whose lease expired and
+// returns how many it reclaimed.
+func (q *MemoryTaskQueue) ReclaimExpiredLeases(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	q.mu.Lock()
+	var expired []string
+	for taskID, lease := range q.leases {
+		if !lease.expiresAt.After(now) {
+			expired = append(expired, taskID)
+			delete(q.leases, taskID)
+		}
+	}
+	q.mu.Unlock()
+
+	reclaimed := 0
+	for _, taskID := range expired {
+		if err := q.UpdateTaskState(ctx, taskID, pkg.TaskStateFailed, nil, "task lease expired"); err != nil {
+			q.logger.Error("Failed to fail task with expired lease", zap.String("task_id", taskID), zap.Error(err))
+			continue
+		}
+		q.logger.Warn("Task lease expired", zap.String("task_id", taskID))
+		reclaimed++
+	}
+	return reclaimed, nil
+}
+
+func (q *MemoryTaskQueue) GetQueueLength(ctx context.Context) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.ready)), nil
+}
+
+func (q *MemoryTaskQueue) GetProcessingTasks(ctx context.Context, workerID string) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var taskIDs []string
+	for taskID, owner := range q.processing {
+		if owner == workerID {
+			taskIDs = append(taskIDs, taskID)
+		}
+	}
+	return taskIDs, nil
+}
+
+// loadLocked decodes a stored task; q.mu must be held.
+func (q *MemoryTaskQueue) loadLocked(taskID string) (*pkg.Task, error) {
+	taskData, ok := q.tasks[taskID]
+	if !ok {
+		return nil, fmt.Errorf("failed to get task data: task %s not found", taskID)
+	}
+
+	var task pkg.Task
+	if err := json.Unmarshal(taskData, &task); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+	return &task, nil
+}
+
+// storeLocked encodes and stores a task; q.mu must be held.
+func (q *MemoryTaskQueue) storeLocked(task *pkg.Task) error {
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+	q.tasks[task.ID] = taskData
+	return nil
+}
+
+// wakeLocked wakes every blocked Dequeue; q.mu must be held.
+func (q *MemoryTaskQueue) wakeLocked() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
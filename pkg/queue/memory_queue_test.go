@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/state"
+)
+
+func newTestQueue(t *testing.T) (*MemoryTaskQueue, *state.MemoryStateManager) {
+	t.Helper()
+	stateManager := state.NewMemoryStateManager()
+	return NewMemoryTaskQueue(zap.NewNop(), stateManager), stateManager
+}
+
+func enqueueTask(t *testing.T, q *MemoryTaskQueue, stateManager pkg.StateManager, taskType string, maxRetries, priority int) *pkg.Task {
+	t.Helper()
+
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: "wf",
+		Type:       taskType,
+		State:      pkg.TaskStatePending,
+		MaxRetries: maxRetries,
+		Priority:   priority,
+		CreatedAt:  time.Now(),
+	}
+	if err := stateManager.SaveTask(context.Background(), task); err != nil {
+		t.Fatalf("failed to save task: %v", err)
+	}
+	if err := q.Enqueue(context.Background(), task); err != nil {
+		t.Fatalf("failed to enqueue task: %v", err)
+	}
+	return task
+}
+
+// dequeue waits up to timeout for a task, skipping the nil results of tasks
+// delayed by a rate limit.
+func dequeue(t *testing.T, q *MemoryTaskQueue, timeout time.Duration) *pkg.Task {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for ctx.Err() == nil {
+		task, err := q.Dequeue(ctx, "worker")
+		if err != nil {
+			t.Fatalf("failed to dequeue: %v", err)
+		}
+		if task != nil {
+			return task
+		}
+	}
+	return nil
+}
+
+func TestMemoryQueueBlockingDequeue(t *testing.T) {
+	q, stateManager := newTestQueue(t)
+
+	dequeued := make(chan *pkg.Task, 1)
+	go func() {
+		task, _ := q.Dequeue(context.Background(), "worker")
+		dequeued <- task
+	}()
+
+	// The waiting Dequeue wakes as soon as a task arrives
+	time.Sleep(100 * time.Millisecond)
+	task := enqueueTask(t, q, stateManager, "t", 0, 0)
+	select {
+	case got := <-dequeued:
+		if got == nil || got.ID != task.ID || got.State != pkg.TaskStateRunning {
+			t.Errorf("dequeued %+v, want the enqueued task running", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked Dequeue did not wake for a new task")
+	}
+}
+
+func TestMemoryQueuePriority(t *testing.T) {
+	q, stateManager := newTestQueue(t)
+
+	first := enqueueTask(t, q, stateManager, "t", 0, 0)
+	urgent := enqueueTask(t, q, stateManager, "t", 0, 1)
+
+	if task := dequeue(t, q, time.Second); task.ID != urgent.ID {
+		t.Errorf("dequeued %s first, want the prioritized task", task.ID)
+	}
+	if task := dequeue(t, q, time.Second); task.ID != first.ID {
+		t.Errorf("dequeued %s second, want the first task", task.ID)
+	}
+}
+
+func TestMemoryQueueRetries(t *testing.T) {
+	q, stateManager := newTestQueue(t)
+	ctx := context.Background()
+
+	task := enqueueTask(t, q, stateManager, "t", 1, 0)
+
+	dequeue(t, q, time.Second)
+	if err := q.UpdateTaskState(ctx, task.ID, pkg.TaskStateFailed, nil, "first"); err != nil {
+		t.Fatalf("failed to fail task: %v", err)
+	}
+	retried := dequeue(t, q, time.Second)
+	if retried == nil || retried.RetryCount != 1 {
+		t.Fatalf("retried task = %+v, want retry count 1", retried)
+	}
+
+	if err := q.UpdateTaskState(ctx, task.ID, pkg.TaskStateFailed, nil, "second"); err != nil {
+		t.Fatalf("failed to fail task: %v", err)
+	}
+	stored, err := stateManager.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	if stored.State != pkg.TaskStateFailed || len(stored.Attempts) != 2 {
+		t.Errorf("task state = %s with %d attempts, want failed after 2", stored.State, len(stored.Attempts))
+	}
+	if length, _ := q.GetQueueLength(ctx); length != 0 {
+		t.Errorf("queue length = %d, want no more retries", length)
+	}
+}
@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// SetTaskProgress stores progress on a running task and publishes it as a
+// task_progress event.
+func (q *RedisTaskQueue) SetTaskProgress(ctx context.Context, taskID string, progress pkg.TaskProgress) error {
+	taskData, err := q.client.HGet(ctx, QueueTaskPrefix+taskID, "data").Result()
+	if err != nil {
+		return fmt.Errorf("failed to get task data: %w", err)
+	}
+
+	var task pkg.Task
+	if err := json.Unmarshal([]byte(taskData), &task); err != nil {
+		return fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+
+	progress, err = applyProgress(&task, progress)
+	if err != nil {
+		return err
+	}
+
+	if err := q.updateTaskData(ctx, &task); err != nil {
+		return fmt.Errorf("failed to update task data: %w", err)
+	}
+	syncTask(ctx, q.stateManager, q.logger, &task)
+	publishProgress(ctx, q.stateManager, q.logger, &task, progress)
+	return nil
+}
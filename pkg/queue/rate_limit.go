@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+const (
+	RateLimitKey     = "temjob:ratelimits"
+	RateBucketPrefix = "temjob:ratelimit:bucket:"
+	DelayedQueueKey  = "temjob:queue:delayed"
+)
+
+const (
+	// rateLimitCacheTTL bounds how long a queue keeps using stale limits
+	// after another process changed them.
+	rateLimitCacheTTL  = 5 * time.Second
+	delayedPromoteSize = 100
+)
+
+// takeTokenScript refills the bucket in KEYS[1] for the time elapsed since
+// its last use and takes one token. It returns 0 when a token was taken,
+// otherwise the milliseconds until one becomes available.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`)
+
+// promoteDelayedScript moves due task IDs from the delayed set KEYS[1] to the
+// dequeue end of KEYS[2] and returns the milliseconds until the next delayed
+// task is due, or -1 when none is left.
+var promoteDelayedScript = redis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, tonumber(ARGV[2]))
+for _, id in ipairs(due) do
+	redis.call("ZREM", KEYS[1], id)
+	redis.call("RPUSH", KEYS[2], id)
+end
+local next = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+if next[2] then
+	return math.max(0, tonumber(next[2]) - tonumber(ARGV[1]))
+end
+return -1
+`)
+
+// SetRateLimit stores the dispatch rate of taskType in Redis so every queue
+// sharing it enforces the same limit. A non-positive rate removes the limit.
+func (q *RedisTaskQueue) SetRateLimit(ctx context.Context, taskType string, limit pkg.RateLimit) error {
+	if limit.Rate <= 0 {
+		if err := q.client.HDel(ctx, RateLimitKey, taskType).Err(); err != nil {
+			return fmt.Errorf("failed to remove rate limit: %w", err)
+		}
+	} else {
+		if limit.Burst <= 0 {
+			limit.Burst = int(math.Max(1, math.Ceil(limit.Rate)))
+		}
+
+		data, err := json.Marshal(limit)
+		if err != nil {
+			return fmt.Errorf("failed to marshal rate limit: %w", err)
+		}
+		if err := q.client.HSet(ctx, RateLimitKey, taskType, data).Err(); err != nil {
+			return fmt.Errorf("failed to save rate limit: %w", err)
+		}
+	}
+
+	q.mu.Lock()
+	q.limitsLoadedAt = time.Time{}
+	q.mu.Unlock()
+
+	q.logger.Info("Rate limit set", zap.String("task_type", taskType), zap.Float64("rate", limit.Rate), zap.Int("burst", limit.Burst))
+	return nil
+}
+
+// rateLimit returns the limit of taskType, reloading the limits from Redis
+// at most every rateLimitCacheTTL.
+func (q *RedisTaskQueue) rateLimit(ctx context.Context, taskType string) (pkg.RateLimit, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if time.Since(q.limitsLoadedAt) > rateLimitCacheTTL {
+		values, err := q.client.HGetAll(ctx, RateLimitKey).Result()
+		if err != nil {
+			q.logger.Warn("Failed to load rate limits", zap.Error(err))
+		} else {
+			limits := make(map[string]pkg.RateLimit, len(values))
+			for taskType, data := range values {
+				var limit pkg.RateLimit
+				if err := json.Unmarshal([]byte(data), &limit); err == nil {
+					limits[taskType] = limit
+				}
+			}
+			q.limits = limits
+			q.limitsLoadedAt = time.Now()
+		}
+	}
+
+	limit, ok := q.limits[taskType]
+	return limit, ok
+}
+
+// takeToken returns how long a task of taskType has to wait before it may
+// be dispatched; zero means it may run now.
+func (q *RedisTaskQueue) takeToken(ctx context.Context, taskType string) (time.Duration, error) {
+	limit, ok := q.rateLimit(ctx, taskType)
+	if !ok {
+		return 0, nil
+	}
+
+	wait, err := takeTokenScript.Run(ctx, q.client, []string{RateBucketPrefix + taskType},
+		limit.Rate, limit.Burst, time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// delayTask takes a dequeued task back from the worker's processing list and
+// parks it in the delayed set until its rate limit allows it.
+func (q *RedisTaskQueue) delayTask(ctx context.Context, processingKey, taskID string, delay time.Duration) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, processingKey, 1, taskID)
+		pipe.ZAdd(ctx, DelayedQueueKey, &redis.Z{
+			Score:  float64(time.Now().Add(delay).UnixMilli()),
+			Member: taskID,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delay task: %w", err)
+	}
+	return nil
+}
+
+// promoteDelayedTasks requeues delayed tasks that are due and shortens the
+// dequeue timeout so the next one is picked up on time.
+func (q *RedisTaskQueue) promoteDelayedTasks(ctx context.Context, timeout time.Duration) (time.Duration, error) {
+	next, err := promoteDelayedScript.Run(ctx, q.client, []string{DelayedQueueKey, TaskQueueKey},
+		time.Now().UnixMilli(), delayedPromoteSize).Int64()
+	if err != nil {
+		return timeout, fmt.Errorf("failed to promote delayed tasks: %w", err)
+	}
+
+	if next >= 0 {
+		// Blocking pops wait at least a second
+		if wait := time.Duration(next) * time.Millisecond; wait < timeout {
+			timeout = wait
+		}
+		if timeout < time.Second {
+			timeout = time.Second
+		}
+	}
+	return timeout, nil
+}
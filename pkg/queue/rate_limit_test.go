@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+func TestMemoryQueueRateLimit(t *testing.T) {
+	q, stateManager := newTestQueue(t)
+	ctx := context.Background()
+
+	if err := q.SetRateLimit(ctx, "limited", pkg.RateLimit{Rate: 10, Burst: 2}); err != nil {
+		t.Fatalf("failed to set rate limit: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		enqueueTask(t, q, stateManager, "limited", 0, 0)
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if task := dequeue(t, q, 2*time.Second); task == nil {
+			t.Fatalf("task %d was not dequeued", i)
+		}
+	}
+	// The burst of two is free; the other two wait 100ms each
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("4 tasks dequeued in %v, want the rate limit to spread them", elapsed)
+	}
+
+	enqueueTask(t, q, stateManager, "free", 0, 0)
+	start = time.Now()
+	if task := dequeue(t, q, time.Second); task == nil || task.Type != "free" {
+		t.Fatalf("dequeued %v, want the unlimited task", task)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("unlimited task waited %v", elapsed)
+	}
+}
+
+func TestMemoryQueueRemoveRateLimit(t *testing.T) {
+	q, stateManager := newTestQueue(t)
+	ctx := context.Background()
+
+	if err := q.SetRateLimit(ctx, "limited", pkg.RateLimit{Rate: 1, Burst: 1}); err != nil {
+		t.Fatalf("failed to set rate limit: %v", err)
+	}
+	if err := q.SetRateLimit(ctx, "limited", pkg.RateLimit{}); err != nil {
+		t.Fatalf("failed to remove rate limit: %v", err)
+	}
+
+	enqueueTask(t, q, stateManager, "limited", 0, 0)
+	enqueueTask(t, q, stateManager, "limited", 0, 0)
+	for i := 0; i < 2; i++ {
+		if task := dequeue(t, q, 100*time.Millisecond); task == nil {
+			t.Fatalf("task %d was held back after the limit was removed", i)
+		}
+	}
+}
@@ -4,13 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 
 	"github.com/XXueTu/temjob/pkg"
-	cstate "github.com/XXueTu/temjob/pkg/state"
 )
 
 const (
@@ -23,6 +23,10 @@ type RedisTaskQueue struct {
 	client       *redis.Client
 	logger       *zap.Logger
 	stateManager pkg.StateManager
+
+	mu             sync.Mutex
+	limits         map[string]pkg.RateLimit
+	limitsLoadedAt time.Time
 }
 
 func NewRedisTaskQueue(client *redis.Client, logger *zap.Logger, stateManager pkg.StateManager) *RedisTaskQueue {
@@ -33,6 +37,8 @@ func NewRedisTaskQueue(client *redis.Client, logger *zap.Logger, stateManager pk
 	}
 }
 
+// Enqueue adds a task to the back of the queue, or to the dequeue end when it
+// has a positive priority so it runs before every task already waiting.
 func (q *RedisTaskQueue) Enqueue(ctx context.Context, task *pkg.Task) error {
 	taskData, err := json.Marshal(task)
 	if err != nil {
@@ -41,7 +47,11 @@ func (q *RedisTaskQueue) Enqueue(ctx context.Context, task *pkg.Task) error {
 
 	pipe := q.client.Pipeline()
 	pipe.HSet(ctx, QueueTaskPrefix+task.ID, "data", taskData)
-	pipe.LPush(ctx, TaskQueueKey, task.ID)
+	if task.Priority > 0 {
+		pipe.RPush(ctx, TaskQueueKey, task.ID)
+	} else {
+		pipe.LPush(ctx, TaskQueueKey, task.ID)
+	}
 
 	_, err = pipe.Exec(ctx)
 	if err != nil {
@@ -52,8 +62,18 @@ func (q *RedisTaskQueue) Enqueue(ctx context.Context, task *pkg.Task) error {
 	return nil
 }
 
+// Dequeue hands the next task to workerID. A task whose type is over its rate
+// limit is moved to the delayed set instead and nil is returned, so workers
+// never receive tasks faster than the limit allows.
 func (q *RedisTaskQueue) Dequeue(ctx context.Context, workerID string) (*pkg.Task, error) {
-	result, err := q.client.BRPopLPush(ctx, TaskQueueKey, ProcessingQueueKey+":"+workerID, 30*time.Second).Result()
+	processingKey := ProcessingQueueKey + ":" + workerID
+
+	timeout, err := q.promoteDelayedTasks(ctx, 30*time.Second)
+	if err != nil {
+		q.logger.Warn("Failed to promote delayed tasks", zap.Error(err))
+	}
+
+	result, err := q.client.BRPopLPush(ctx, TaskQueueKey, processingKey, timeout).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil
@@ -72,6 +92,18 @@ func (q *RedisTaskQueue) Dequeue(ctx context.Context, workerID string) (*pkg.Tas
 		return nil, fmt.Errorf("failed to unmarshal task: %w", err)
 	}
 
+	delay, err := q.takeToken(ctx, task.Type)
+	if err != nil {
+		// Fail open: a broken limiter must not stall the queue
+		q.logger.Warn("Rate limit check failed", zap.String("task_id", taskID), zap.Error(err))
+	} else if delay > 0 {
+		if err := q.delayTask(ctx, processingKey, taskID, delay); err != nil {
+			return nil, err
+		}
+		q.logger.Debug("Task delayed by rate limit", zap.String("task_id", taskID), zap.String("task_type", task.Type), zap.Duration("delay", delay))
+		return nil, nil
+	}
+
 	task.State = pkg.TaskStateRunning
 	task.WorkerID = workerID
 	now := time.Now()
@@ -85,7 +117,21 @@ func (q *RedisTaskQueue) Dequeue(ctx context.Context, workerID string) (*pkg.Tas
 	return &task, nil
 }
 
+// UpdateTaskState records the outcome of the task's current attempt. A
+// failed attempt with retries left is recorded and the task goes back to the
+// queue as retrying, so the state manager never reports it failed while a
+// retry is still coming.
 func (q *RedisTaskQueue) UpdateTaskState(ctx context.Context, taskID string, state pkg.TaskState, output map[string]interface{}, errMsg string) error {
+	return q.updateTaskState(ctx, taskID, state, output, errMsg, true)
+}
+
+// FailTask fails the task's current attempt, retrying it only when retryable
+// is true and retries are left.
+func (q *RedisTaskQueue) FailTask(ctx context.Context, taskID, errMsg string, retryable bool) error {
+	return q.updateTaskState(ctx, taskID, pkg.TaskStateFailed, nil, errMsg, retryable)
+}
+
+func (q *RedisTaskQueue) updateTaskState(ctx context.Context, taskID string, state pkg.TaskState, output map[string]interface{}, errMsg string, retryable bool) error {
 	taskData, err := q.client.HGet(ctx, QueueTaskPrefix+taskID, "data").Result()
 	if err != nil {
 		return fmt.Errorf("failed to get task data: %w", err)
@@ -96,54 +142,28 @@ func (q *RedisTaskQueue) UpdateTaskState(ctx context.Context, taskID string, sta
 		return fmt.Errorf("failed to unmarshal task: %w", err)
 	}
 
-	task.State = state
-	if output != nil {
-		task.Output = output
-	}
-	if errMsg != "" {
-		task.Error = errMsg
-	}
-
-	if state == pkg.TaskStateCompleted || state == pkg.TaskStateFailed {
-		now := time.Now()
-		task.CompletedAt = &now
-	}
+	result := finishAttempt(&task, state, output, errMsg, retryable)
 
 	if err := q.updateTaskData(ctx, &task); err != nil {
 		return fmt.Errorf("failed to update task data: %w", err)
 	}
 
-	// Also update the state manager (MySQL) with the task state
-	if q.stateManager != nil {
-		if err := q.stateManager.SaveTask(ctx, &task); err != nil {
-			q.logger.Warn("Failed to sync task state to state manager", zap.Error(err))
-		} else {
-			// Clear cache to ensure fresh data is retrieved
-			if mysqlState, ok := q.stateManager.(*cstate.MySQLStateManager); ok {
-				mysqlState.InvalidateCache(ctx, task.WorkflowID)
-			}
-		}
-	}
+	syncTask(ctx, q.stateManager, q.logger, &task)
 
-	if task.WorkerID != "" && (state == pkg.TaskStateCompleted || state == pkg.TaskStateFailed) {
-		q.client.LRem(ctx, ProcessingQueueKey+":"+task.WorkerID, 1, taskID)
+	if result.workerID != "" && result.finished {
+		q.client.LRem(ctx, ProcessingQueueKey+":"+result.workerID, 1, taskID)
 	}
 
-	if state == pkg.TaskStateFailed && task.RetryCount < task.MaxRetries {
-		task.RetryCount++
-		task.State = pkg.TaskStateRetrying
-		task.WorkerID = ""
-		task.StartedAt = nil
-		task.CompletedAt = nil
-
-		if err := q.updateTaskData(ctx, &task); err != nil {
-			return fmt.Errorf("failed to update retry task: %w", err)
-		}
+	recordAttempt(ctx, q.stateManager, q.logger, &task, state, errMsg, retryable, result)
 
+	if result.retry {
 		if err := q.Enqueue(ctx, &task); err != nil {
 			return fmt.Errorf("failed to requeue task for retry: %w", err)
 		}
 
+		recordTaskEvent(ctx, q.stateManager, q.logger, &task, pkg.EventRetryScheduled, "Retry scheduled: "+task.Type, "info", map[string]interface{}{
+			"attempt": task.RetryCount + 1,
+		})
 		q.logger.Info("Task requeued for retry", zap.String("task_id", taskID), zap.Int("retry_count", task.RetryCount))
 	}
 
@@ -2,6 +2,8 @@ package sdk
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/XXueTu/temjob/pkg"
 )
@@ -10,6 +12,13 @@ type WorkflowBuilder struct {
 	name  string
 	tasks map[string]pkg.TaskDefinition
 	flow  []pkg.WorkflowStep
+
+	concurrencyKey    func(input map[string]interface{}) string
+	maxConcurrency    int
+	concurrencyPolicy pkg.ConcurrencyPolicy
+	queries           map[string]pkg.QueryHandler
+	validateInput     func(input map[string]interface{}) error
+	webhooks          []pkg.Webhook
 }
 
 func NewWorkflowBuilder(name string) *WorkflowBuilder {
@@ -29,6 +38,16 @@ func (wb *WorkflowBuilder) AddTask(taskType string, handler pkg.TaskHandler, max
 	return wb
 }
 
+// RateLimit limits how many taskType tasks per second are handed to workers
+// across the whole fleet. Call it after AddTask.
+func (wb *WorkflowBuilder) RateLimit(taskType string, rate float64, burst int) *WorkflowBuilder {
+	if taskDef, exists := wb.tasks[taskType]; exists {
+		taskDef.RateLimit = &pkg.RateLimit{Rate: rate, Burst: burst}
+		wb.tasks[taskType] = taskDef
+	}
+	return wb
+}
+
 func (wb *WorkflowBuilder) AddStep(taskType string) *StepBuilder {
 	return &StepBuilder{
 		workflowBuilder: wb,
@@ -39,11 +58,154 @@ func (wb *WorkflowBuilder) AddStep(taskType string) *StepBuilder {
 	}
 }
 
+// AddMapStep adds a step that runs taskType once per element of the list
+// stored under itemsKey in the workflow context.
+func (wb *WorkflowBuilder) AddMapStep(taskType, itemsKey string) *StepBuilder {
+	return &StepBuilder{
+		workflowBuilder: wb,
+		step: pkg.WorkflowStep{
+			TaskType:  taskType,
+			Kind:      pkg.StepKindMap,
+			DependsOn: []string{},
+			Map: &pkg.MapConfig{
+				ItemsKey:      itemsKey,
+				FailurePolicy: pkg.MapFailFast,
+			},
+		},
+	}
+}
+
+// AddTimerStep adds a step named name that waits for d without occupying a
+// worker. Other steps can depend on it like on any task step.
+func (wb *WorkflowBuilder) AddTimerStep(name string, d time.Duration) *StepBuilder {
+	return &StepBuilder{
+		workflowBuilder: wb,
+		step: pkg.WorkflowStep{
+			TaskType:  name,
+			Kind:      pkg.StepKindTimer,
+			DependsOn: []string{},
+			Timer:     &pkg.TimerConfig{Duration: d},
+		},
+	}
+}
+
+// AddTimerUntilStep adds a timer step that fires at the timestamp stored
+// under untilKey in the workflow context.
+func (wb *WorkflowBuilder) AddTimerUntilStep(name, untilKey string) *StepBuilder {
+	return &StepBuilder{
+		workflowBuilder: wb,
+		step: pkg.WorkflowStep{
+			TaskType:  name,
+			Kind:      pkg.StepKindTimer,
+			DependsOn: []string{},
+			Timer:     &pkg.TimerConfig{UntilKey: untilKey},
+		},
+	}
+}
+
+// AddSignalStep adds a step named name that waits for signalName to be sent
+// to the workflow and merges the signal payload into the context. A zero
+// timeout waits indefinitely.
+func (wb *WorkflowBuilder) AddSignalStep(name, signalName string, timeout time.Duration) *StepBuilder {
+	return &StepBuilder{
+		workflowBuilder: wb,
+		step: pkg.WorkflowStep{
+			TaskType:  name,
+			Kind:      pkg.StepKindSignal,
+			DependsOn: []string{},
+			Signal:    &pkg.SignalConfig{Name: signalName, Timeout: timeout},
+		},
+	}
+}
+
+// AddApprovalStep adds a step named name that pauses the workflow until an
+// operator approves or rejects it. fields lists the context keys shown to the
+// approver. A zero timeout waits indefinitely.
+func (wb *WorkflowBuilder) AddApprovalStep(name string, timeout time.Duration, fields ...string) *StepBuilder {
+	return &StepBuilder{
+		workflowBuilder: wb,
+		step: pkg.WorkflowStep{
+			TaskType:  name,
+			Kind:      pkg.StepKindApproval,
+			DependsOn: []string{},
+			Approval:  &pkg.ApprovalConfig{Fields: fields, Timeout: timeout},
+		},
+	}
+}
+
+// ConcurrencyKey limits runs sharing the key derived from the workflow input
+// to one at a time, or to the count set with MaxConcurrency.
+func (wb *WorkflowBuilder) ConcurrencyKey(key func(input map[string]interface{}) string) *WorkflowBuilder {
+	wb.concurrencyKey = key
+	return wb
+}
+
+// ConcurrencyKeyField uses the input value under field as the concurrency key.
+func (wb *WorkflowBuilder) ConcurrencyKeyField(field string) *WorkflowBuilder {
+	return wb.ConcurrencyKey(func(input map[string]interface{}) string {
+		return fmt.Sprint(input[field])
+	})
+}
+
+// MaxConcurrency limits how many workflows run at once per concurrency key,
+// or across the whole workflow when no key is set.
+func (wb *WorkflowBuilder) MaxConcurrency(n int) *WorkflowBuilder {
+	wb.maxConcurrency = n
+	return wb
+}
+
+// RejectOverLimit fails submissions over the concurrency limit with
+// pkg.ErrConcurrencyLimit instead of queueing them.
+func (wb *WorkflowBuilder) RejectOverLimit() *WorkflowBuilder {
+	wb.concurrencyPolicy = pkg.ConcurrencyReject
+	return wb
+}
+
+// Query registers a named read-only query over the workflow's progress.
+func (wb *WorkflowBuilder) Query(name string, handler pkg.QueryHandler) *WorkflowBuilder {
+	if wb.queries == nil {
+		wb.queries = make(map[string]pkg.QueryHandler)
+	}
+	wb.queries[name] = handler
+	return wb
+}
+
+// ValidateInput rejects submissions whose input fn returns an error for.
+func (wb *WorkflowBuilder) ValidateInput(fn func(input map[string]interface{}) error) *WorkflowBuilder {
+	wb.validateInput = fn
+	return wb
+}
+
+// RequireInput rejects submissions missing any of the given input fields.
+func (wb *WorkflowBuilder) RequireInput(fields ...string) *WorkflowBuilder {
+	return wb.ValidateInput(func(input map[string]interface{}) error {
+		for _, field := range fields {
+			if _, ok := input[field]; !ok {
+				return fmt.Errorf("missing required field: %s", field)
+			}
+		}
+		return nil
+	})
+}
+
+// Webhook notifies url of the given events of every workflow of the
+// definition, or of its terminal events when none are given.
+func (wb *WorkflowBuilder) Webhook(url string, events ...pkg.EventType) *WorkflowBuilder {
+	wb.webhooks = append(wb.webhooks, pkg.Webhook{URL: url, Events: events})
+	return wb
+}
+
 func (wb *WorkflowBuilder) Build() pkg.WorkflowDefinition {
 	return pkg.WorkflowDefinition{
-		Name:  wb.name,
-		Tasks: wb.tasks,
-		Flow:  wb.flow,
+		Name:              wb.name,
+		Tasks:             wb.tasks,
+		Flow:              wb.flow,
+		ConcurrencyKey:    wb.concurrencyKey,
+		MaxConcurrency:    wb.maxConcurrency,
+		ConcurrencyPolicy: wb.concurrencyPolicy,
+		Queries:           wb.queries,
+		ValidateInput:     wb.validateInput,
+		Webhooks:          wb.webhooks,
 	}
 }
 
@@ -67,6 +229,30 @@ func (sb *StepBuilder) OnError(errorHandler string) *StepBuilder {
 	return sb
 }
 
+// MaxParallel limits how many items of a map step run at once.
+func (sb *StepBuilder) MaxParallel(n int) *StepBuilder {
+	if sb.step.Map != nil {
+		sb.step.Map.MaxParallel = n
+	}
+	return sb
+}
+
+// ResultKey sets the context key receiving the ordered outputs of a map step.
+func (sb *StepBuilder) ResultKey(key string) *StepBuilder {
+	if sb.step.Map != nil {
+		sb.step.Map.ResultKey = key
+	}
+	return sb
+}
+
+// CollectErrors lets a map step run every item even when some fail.
+func (sb *StepBuilder) CollectErrors() *StepBuilder {
+	if sb.step.Map != nil {
+		sb.step.Map.FailurePolicy = pkg.MapCollectErrors
+	}
+	return sb
+}
+
 func (sb *StepBuilder) Then() *WorkflowBuilder {
 	sb.workflowBuilder.flow = append(sb.workflowBuilder.flow, sb.step)
 	return sb.workflowBuilder
@@ -74,6 +260,27 @@ func (sb *StepBuilder) Then() *WorkflowBuilder {
 
 type TaskHandlerFunc func(input map[string]interface{}) (map[string]interface{}, error)
 
+// LoggerFromContext returns the logger of the task a handler runs for. Its
+// lines are stored with the task and shown in the workflow detail page.
+func LoggerFromContext(ctx context.Context) pkg.TaskLogger {
+	return pkg.TaskLoggerFromContext(ctx)
+}
+
+// TaskInfoFromContext returns the task, workflow, attempt and timing of the
+// task a handler runs for. The task ID is stable across retries, which makes
+// it a natural idempotency key for calls to external APIs.
+func TaskInfoFromContext(ctx context.Context) (pkg.TaskInfo, bool) {
+	return pkg.TaskInfoFromContext(ctx)
+}
+
+// ReportProgress records the progress of the task a handler runs for. It is
+// stored on the task, shown as a progress bar in the workflow detail page
+// and kept as the last-known progress if the task is retried. Reports are
+// written at most once a second, so handlers may call it freely.
+func ReportProgress(ctx context.Context, progress pkg.TaskProgress) error {
+	return pkg.ProgressFromContext(ctx)(progress)
+}
+
 func SimpleTaskHandler(fn TaskHandlerFunc) pkg.TaskHandler {
 	return func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
 		return fn(input)
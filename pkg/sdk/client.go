@@ -2,6 +2,7 @@ package sdk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/go-redis/redis/v8"
@@ -22,10 +23,41 @@ type Client struct {
 	logger       *zap.Logger
 }
 
+// WorkflowError is returned when a waited-for workflow ends in a state other
+// than completed. Reason is the failure reason of a failed workflow.
+type WorkflowError struct {
+	WorkflowID string
+	State      pkg.WorkflowState
+	Reason     string
+}
+
+func (e *WorkflowError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("workflow %s ended %s: %s", e.WorkflowID, e.State, e.Reason)
+	}
+	return fmt.Sprintf("workflow %s ended %s", e.WorkflowID, e.State)
+}
+
+// workflowResult returns the workflow together with a *WorkflowError unless
+// it completed.
+func workflowResult(workflow *pkg.Workflow) (*pkg.Workflow, error) {
+	if workflow.State == pkg.WorkflowStateCompleted {
+		return workflow, nil
+	}
+	return workflow, &WorkflowError{WorkflowID: workflow.ID, State: workflow.State, Reason: workflow.Error}
+}
+
 type ClientConfig struct {
 	RedisAddr     string
 	RedisPassword string
 	RedisDB       int
+	// WebhookSecret signs the webhook deliveries sent by the client's engine.
+	// Without it the engine rejects workflows with webhooks.
+	WebhookSecret string
+	// InMemory keeps workflows, tasks and the queue in process memory
+	// instead of Redis, for tests and embedded use. The Redis settings are
+	// ignored and all state is lost when the process exits.
+	InMemory bool
 }
 
 func NewClient(config ClientConfig) (*Client, error) {
@@ -34,19 +66,27 @@ func NewClient(config ClientConfig) (*Client, error) {
 		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     config.RedisAddr,
-		Password: config.RedisPassword,
-		DB:       config.RedisDB,
-	})
+	var stateManager pkg.StateManager
+	var taskQueue pkg.TaskQueue
+	if config.InMemory {
+		stateManager = state.NewMemoryStateManager()
+		taskQueue = queue.NewMemoryTaskQueue(logger, stateManager)
+	} else {
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     config.RedisAddr,
+			Password: config.RedisPassword,
+			DB:       config.RedisDB,
+		})
 
-	if err := redisClient.Ping(context.Background()).Err(); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
-	}
+		if err := redisClient.Ping(context.Background()).Err(); err != nil {
+			return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		}
 
-	stateManager := state.NewRedisStateManager(redisClient)
-	taskQueue := queue.NewRedisTaskQueue(redisClient, logger, stateManager)
+		stateManager = state.NewRedisStateManager(redisClient)
+		taskQueue = queue.NewRedisTaskQueue(redisClient, logger, stateManager)
+	}
 	engine := workflow.NewEngine(stateManager, taskQueue, logger)
+	engine.SetWebhookSecret(config.WebhookSecret)
 	workerInstance := worker.NewWorker(taskQueue, stateManager, logger)
 
 	return &Client{
@@ -62,22 +102,181 @@ func (c *Client) RegisterWorkflow(definition pkg.WorkflowDefinition) {
 	c.engine.RegisterWorkflow(definition)
 }
 
+// ListDefinitions describes the workflow definitions registered with the
+// client's engine.
+func (c *Client) ListDefinitions() []pkg.DefinitionInfo {
+	return c.engine.ListDefinitions()
+}
+
 func (c *Client) RegisterTaskHandler(taskType string, handler pkg.TaskHandler) {
 	c.worker.RegisterTaskHandler(taskType, handler)
 }
 
+// Use adds interceptors around every task handler of the client's worker;
+// see pkg.TaskInterceptor.
+func (c *Client) Use(interceptors ...pkg.TaskInterceptor) {
+	c.worker.Use(interceptors...)
+}
+
 func (c *Client) SubmitWorkflow(ctx context.Context, workflowName string, input map[string]interface{}) (string, error) {
 	return c.engine.SubmitWorkflow(ctx, workflowName, input)
 }
 
+// SubmitWorkflowWithOptions submits a workflow under options.WorkflowID when
+// set. If that ID is already taken it returns the existing ID together with
+// an error matching pkg.ErrWorkflowExists.
+func (c *Client) SubmitWorkflowWithOptions(ctx context.Context, workflowName string, input map[string]interface{}, options pkg.SubmitOptions) (string, error) {
+	return c.engine.SubmitWorkflowWithOptions(ctx, workflowName, input, options)
+}
+
+// QueryWorkflow runs a query registered on the workflow's definition and
+// returns its result without changing the workflow.
+func (c *Client) QueryWorkflow(ctx context.Context, workflowID, queryName string, args map[string]interface{}) (interface{}, error) {
+	return c.engine.QueryWorkflow(ctx, workflowID, queryName, args)
+}
+
+// GetWorkflowHistory returns the recorded events of a workflow, oldest first.
+func (c *Client) GetWorkflowHistory(ctx context.Context, workflowID string) ([]*pkg.HistoryEvent, error) {
+	store, ok := c.stateManager.(pkg.HistoryStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not keep workflow history")
+	}
+	return store.GetWorkflowHistory(ctx, workflowID)
+}
+
+// SubscribeEvents streams the events of workflowID, or of every workflow when
+// it is empty, as they are recorded. The channel is closed once ctx is done.
+func (c *Client) SubscribeEvents(ctx context.Context, workflowID string) (<-chan *pkg.HistoryEvent, error) {
+	bus, ok := c.stateManager.(pkg.EventBus)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not stream events")
+	}
+	return bus.SubscribeEvents(ctx, workflowID)
+}
+
+// ListWebhookDeliveries returns the webhook delivery log of a workflow,
+// oldest first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, workflowID string) ([]*pkg.WebhookDelivery, error) {
+	store, ok := c.stateManager.(pkg.WebhookStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not deliver webhooks")
+	}
+	return store.ListWebhookDeliveries(ctx, workflowID)
+}
+
+// RedeliverWebhook queues the payload of a logged delivery to be sent again.
+func (c *Client) RedeliverWebhook(ctx context.Context, deliveryID string) (*pkg.WebhookDelivery, error) {
+	store, ok := c.stateManager.(pkg.WebhookStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not deliver webhooks")
+	}
+
+	original, err := store.GetWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.RedeliverWebhook(ctx, store, original)
+}
+
 func (c *Client) GetWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
 	return c.engine.GetWorkflow(ctx, workflowID)
 }
 
+// WaitForWorkflow blocks until the workflow reaches a terminal state and
+// returns it, waking up on the workflow's end event rather than polling. A
+// failed or canceled workflow is returned together with a *WorkflowError.
+func (c *Client) WaitForWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
+	workflow, err := pkg.WaitForWorkflow(ctx, c.stateManager, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return workflowResult(workflow)
+}
+
+// SubmitAndWait submits a workflow and waits for it like WaitForWorkflow.
+// When options.WorkflowID is already taken it waits for the existing
+// workflow instead, so a retried call returns the result of the first.
+func (c *Client) SubmitAndWait(ctx context.Context, workflowName string, input map[string]interface{}, options pkg.SubmitOptions) (*pkg.Workflow, error) {
+	workflowID, err := c.SubmitWorkflowWithOptions(ctx, workflowName, input, options)
+	if err != nil && !(errors.Is(err, pkg.ErrWorkflowExists) && workflowID != "") {
+		return nil, err
+	}
+	return c.WaitForWorkflow(ctx, workflowID)
+}
+
 func (c *Client) CancelWorkflow(ctx context.Context, workflowID string) error {
 	return c.engine.CancelWorkflow(ctx, workflowID)
 }
 
+func (c *Client) SignalWorkflow(ctx context.Context, workflowID, signalName string, payload map[string]interface{}) error {
+	return c.engine.SignalWorkflow(ctx, workflowID, signalName, payload)
+}
+
+// ApproveStep approves the pending approval step of a workflow. It returns an
+// error matching pkg.ErrNoPendingApproval when the step is not waiting.
+func (c *Client) ApproveStep(ctx context.Context, workflowID, step, approver, comment string) error {
+	return c.decideStep(ctx, workflowID, step, pkg.ApprovalApproved, approver, comment)
+}
+
+// RejectStep rejects the pending approval step, sending the workflow down
+// the step's error path.
+func (c *Client) RejectStep(ctx context.Context, workflowID, step, approver, comment string) error {
+	return c.decideStep(ctx, workflowID, step, pkg.ApprovalRejected, approver, comment)
+}
+
+func (c *Client) decideStep(ctx context.Context, workflowID, step, decision, approver, comment string) error {
+	return c.engine.DecideApproval(ctx, workflowID, step, decision, approver, comment)
+}
+
+func (c *Client) CreateSchedule(ctx context.Context, schedule *pkg.Schedule) (*pkg.Schedule, error) {
+	return c.engine.CreateSchedule(ctx, schedule)
+}
+
+func (c *Client) UpdateSchedule(ctx context.Context, schedule *pkg.Schedule) (*pkg.Schedule, error) {
+	return c.engine.UpdateSchedule(ctx, schedule)
+}
+
+func (c *Client) GetSchedule(ctx context.Context, scheduleID string) (*pkg.Schedule, error) {
+	return c.engine.GetSchedule(ctx, scheduleID)
+}
+
+func (c *Client) ListSchedules(ctx context.Context) ([]*pkg.Schedule, error) {
+	return c.engine.ListSchedules(ctx)
+}
+
+func (c *Client) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	return c.engine.DeleteSchedule(ctx, scheduleID)
+}
+
+func (c *Client) PauseSchedule(ctx context.Context, scheduleID string) error {
+	return c.engine.PauseSchedule(ctx, scheduleID)
+}
+
+func (c *Client) ResumeSchedule(ctx context.Context, scheduleID string) error {
+	return c.engine.ResumeSchedule(ctx, scheduleID)
+}
+
+func (c *Client) TriggerSchedule(ctx context.Context, scheduleID string) (string, error) {
+	return c.engine.TriggerSchedule(ctx, scheduleID)
+}
+
+func (c *Client) Backfill(ctx context.Context, request pkg.BackfillRequest) (*pkg.Backfill, error) {
+	return c.engine.Backfill(ctx, request)
+}
+
+func (c *Client) GetBackfill(ctx context.Context, backfillID string) (*pkg.Backfill, error) {
+	return c.engine.GetBackfill(ctx, backfillID)
+}
+
+// GetTaskLogs returns up to limit log lines of a task logged after afterSeq.
+func (c *Client) GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*pkg.TaskLogEntry, error) {
+	store, ok := c.stateManager.(pkg.TaskLogStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not keep task logs")
+	}
+	return store.GetTaskLogs(ctx, taskID, afterSeq, limit)
+}
+
 func (c *Client) GetTask(ctx context.Context, taskID string) (*pkg.Task, error) {
 	return c.stateManager.GetTask(ctx, taskID)
 }
@@ -0,0 +1,46 @@
+package sdk
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// LoggingInterceptor logs the start and outcome of every task attempt with
+// its duration.
+func LoggingInterceptor(logger *zap.Logger) pkg.TaskInterceptor {
+	return func(ctx context.Context, task *pkg.Task, input map[string]interface{}, next pkg.TaskHandler) (map[string]interface{}, error) {
+		fields := []zap.Field{
+			zap.String("task_id", task.ID),
+			zap.String("task_type", task.Type),
+			zap.String("workflow_id", task.WorkflowID),
+			zap.Int("attempt", task.RetryCount+1),
+		}
+		logger.Info("Task attempt started", fields...)
+
+		start := time.Now()
+		output, err := next(ctx, input)
+		fields = append(fields, zap.Duration("duration", time.Since(start)))
+		if err != nil {
+			logger.Warn("Task attempt failed", append(fields, zap.Error(err))...)
+		} else {
+			logger.Info("Task attempt completed", fields...)
+		}
+		return output, err
+	}
+}
+
+// ClassifyErrors marks handler errors for which retryable returns false as
+// non-retryable, failing the task without using its remaining retries.
+func ClassifyErrors(retryable func(err error) bool) pkg.TaskInterceptor {
+	return func(ctx context.Context, task *pkg.Task, input map[string]interface{}, next pkg.TaskHandler) (map[string]interface{}, error) {
+		output, err := next(ctx, input)
+		if err != nil && !pkg.IsNonRetryable(err) && !retryable(err) {
+			return output, pkg.NonRetryable(err)
+		}
+		return output, err
+	}
+}
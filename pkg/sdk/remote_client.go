@@ -0,0 +1,326 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+var (
+	// ErrNotFound matches API errors for missing workflows, tasks or
+	// definitions.
+	ErrNotFound = errors.New("not found")
+	// ErrBadRequest matches API errors for requests the server rejected as
+	// invalid.
+	ErrBadRequest = errors.New("bad request")
+)
+
+// APIError is returned by RemoteClient when the server answers with an error
+// status. It matches ErrNotFound, ErrBadRequest, pkg.ErrWorkflowExists,
+// pkg.ErrWorkflowEnded and pkg.ErrConcurrencyLimit through errors.Is.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("temjob API error %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case pkg.ErrWorkflowExists, pkg.ErrWorkflowEnded:
+		return e.StatusCode == http.StatusConflict
+	case pkg.ErrConcurrencyLimit:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+type RemoteClientConfig struct {
+	// BaseURL is the address of the temjob server, e.g. http://localhost:8080.
+	BaseURL    string
+	HTTPClient *http.Client
+	// MaxRetries bounds how often a request failing with a network error or
+	// a 5xx status is retried; RetryBackoff is the first delay and doubles
+	// on every retry.
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// RemoteClient submits and observes workflows through the REST API of a
+// temjob server, so producers need neither Redis nor an engine of their own.
+type RemoteClient struct {
+	baseURL      string
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+}
+
+func NewRemoteClient(config RemoteClientConfig) (*RemoteClient, error) {
+	baseURL, err := url.Parse(config.BaseURL)
+	if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid base URL: %q", config.BaseURL)
+	}
+
+	client := &RemoteClient{
+		baseURL:      strings.TrimRight(baseURL.String(), "/") + "/api/v1",
+		httpClient:   config.HTTPClient,
+		maxRetries:   config.MaxRetries,
+		retryBackoff: config.RetryBackoff,
+	}
+	if client.httpClient == nil {
+		// Long enough for a remote worker poll, which waits up to 30s
+		client.httpClient = &http.Client{Timeout: time.Minute}
+	}
+	if client.maxRetries <= 0 {
+		client.maxRetries = 3
+	}
+	if client.retryBackoff <= 0 {
+		client.retryBackoff = 200 * time.Millisecond
+	}
+	return client, nil
+}
+
+func (c *RemoteClient) SubmitWorkflow(ctx context.Context, workflowName string, input map[string]interface{}) (string, error) {
+	return c.SubmitWorkflowWithOptions(ctx, workflowName, input, pkg.SubmitOptions{})
+}
+
+// SubmitWorkflowWithOptions submits a workflow like Client.SubmitWorkflowWithOptions.
+// Without options.WorkflowID an ID is generated up front, so a submission
+// retried after a lost response cannot start a second run.
+func (c *RemoteClient) SubmitWorkflowWithOptions(ctx context.Context, workflowName string, input map[string]interface{}, options pkg.SubmitOptions) (string, error) {
+	generated := options.WorkflowID == ""
+	if generated {
+		options.WorkflowID = pkg.NewWorkflowID()
+	}
+
+	request := map[string]interface{}{
+		"name":            workflowName,
+		"input":           input,
+		"workflow_id":     options.WorkflowID,
+		"id_reuse_policy": options.IDReusePolicy,
+		"priority":        options.Priority,
+		"webhooks":        options.Webhooks,
+	}
+
+	var response struct {
+		WorkflowID string `json:"workflow_id"`
+	}
+	attempts, err := c.do(ctx, http.MethodPost, "/workflows", request, &response)
+	if err != nil {
+		// A generated ID is only taken if an earlier attempt got through
+		if generated && attempts > 1 && errors.Is(err, pkg.ErrWorkflowExists) {
+			return options.WorkflowID, nil
+		}
+		if errors.Is(err, pkg.ErrWorkflowExists) {
+			return options.WorkflowID, err
+		}
+		return "", err
+	}
+	return response.WorkflowID, nil
+}
+
+func (c *RemoteClient) GetWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
+	var workflow pkg.Workflow
+	if _, err := c.do(ctx, http.MethodGet, "/workflows/"+url.PathEscape(workflowID), nil, &workflow); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+func (c *RemoteClient) ListWorkflows(ctx context.Context, limit, offset int) ([]*pkg.Workflow, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+
+	var response struct {
+		Workflows []*pkg.Workflow `json:"workflows"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/workflows?"+query.Encode(), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Workflows, nil
+}
+
+func (c *RemoteClient) GetWorkflowTasks(ctx context.Context, workflowID string) ([]*pkg.Task, error) {
+	var response struct {
+		Tasks []*pkg.Task `json:"tasks"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/workflows/"+url.PathEscape(workflowID)+"/tasks", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Tasks, nil
+}
+
+func (c *RemoteClient) GetTask(ctx context.Context, taskID string) (*pkg.Task, error) {
+	var task pkg.Task
+	if _, err := c.do(ctx, http.MethodGet, "/tasks/"+url.PathEscape(taskID), nil, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetTaskLogs returns up to limit log lines of a task logged after afterSeq.
+func (c *RemoteClient) GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*pkg.TaskLogEntry, error) {
+	query := url.Values{}
+	query.Set("after", strconv.FormatInt(afterSeq, 10))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var response struct {
+		Logs []*pkg.TaskLogEntry `json:"logs"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/tasks/"+url.PathEscape(taskID)+"/logs?"+query.Encode(), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Logs, nil
+}
+
+func (c *RemoteClient) CancelWorkflow(ctx context.Context, workflowID string) error {
+	_, err := c.do(ctx, http.MethodPost, "/workflows/"+url.PathEscape(workflowID)+"/cancel", nil, nil)
+	return err
+}
+
+// SignalWorkflow sends a signal once; it is not retried because a repeated
+// signal would be delivered twice.
+func (c *RemoteClient) SignalWorkflow(ctx context.Context, workflowID, signalName string, payload map[string]interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	path := "/workflows/" + url.PathEscape(workflowID) + "/signals/" + url.PathEscape(signalName)
+	return c.send(ctx, http.MethodPost, path, data, nil)
+}
+
+// WaitForWorkflow blocks until the workflow reaches a terminal state and
+// returns it, long-polling the server's result endpoint. A failed or
+// canceled workflow is returned together with a *WorkflowError.
+func (c *RemoteClient) WaitForWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
+	path := "/workflows/" + url.PathEscape(workflowID) + "/result?wait=30s"
+
+	for {
+		var workflow pkg.Workflow
+		if _, err := c.do(ctx, http.MethodGet, path, nil, &workflow); err != nil {
+			return nil, err
+		}
+		if workflow.State.Terminal() {
+			return workflowResult(&workflow)
+		}
+	}
+}
+
+// SubmitAndWait submits a workflow and waits for it like WaitForWorkflow.
+// When options.WorkflowID is already taken it waits for the existing
+// workflow instead, so a retried call returns the result of the first.
+func (c *RemoteClient) SubmitAndWait(ctx context.Context, workflowName string, input map[string]interface{}, options pkg.SubmitOptions) (*pkg.Workflow, error) {
+	workflowID, err := c.SubmitWorkflowWithOptions(ctx, workflowName, input, options)
+	if err != nil && !(errors.Is(err, pkg.ErrWorkflowExists) && workflowID != "") {
+		return nil, err
+	}
+	return c.WaitForWorkflow(ctx, workflowID)
+}
+
+// do sends a JSON request and decodes the JSON response into out. Network
+// errors and 5xx responses are retried with exponential backoff, so only
+// requests safe to repeat go through it. It returns how many attempts were
+// made.
+func (c *RemoteClient) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		payload = data
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.send(ctx, method, path, payload, out)
+		if err == nil || attempt > c.maxRetries || !retryable(err) {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *RemoteClient) send(ctx context.Context, method, path string, payload []byte, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiError) == nil && apiError.Error != "" {
+			message = apiError.Error
+		}
+		return &APIError{StatusCode: response.StatusCode, Message: message}
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// retryable reports whether a failed request may succeed when repeated.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		return apiError.StatusCode >= http.StatusInternalServerError
+	}
+
+	var networkError *url.Error
+	return errors.As(err, &networkError)
+}
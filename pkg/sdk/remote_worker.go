@@ -0,0 +1,237 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/worker"
+)
+
+// RemoteTaskQueue is a pkg.TaskQueue that pulls tasks from a temjob server
+// over its remote worker API. Dequeued tasks are leased to the worker and a
+// heartbeat renews the lease until their state is reported. Handler log
+// lines are buffered and shipped with the next heartbeat or the report.
+type RemoteTaskQueue struct {
+	client *RemoteClient
+	lease  time.Duration
+	logger *zap.Logger
+
+	mu         sync.Mutex
+	heartbeats map[string]*remoteLease
+}
+
+type remoteLease struct {
+	workerID string
+	// attempt identifies the attempt in reports, so the server recognizes
+	// a report it already recorded.
+	attempt int
+	stop    chan struct{}
+	// logs holds log lines not yet sent to the server, guarded by the
+	// queue's mutex.
+	logs []*pkg.TaskLogEntry
+}
+
+// NewRemoteTaskQueue creates a queue leasing tasks for lease at a time; a
+// zero lease uses the server default of one minute.
+func NewRemoteTaskQueue(client *RemoteClient, lease time.Duration, logger *zap.Logger) *RemoteTaskQueue {
+	if lease <= 0 {
+		lease = time.Minute
+	}
+	return &RemoteTaskQueue{
+		client:     client,
+		lease:      lease,
+		logger:     logger,
+		heartbeats: make(map[string]*remoteLease),
+	}
+}
+
+// NewRemoteWorker creates a worker that executes tasks of a temjob server
+// without access to its Redis. Register handlers on it and call Start as
+// with an in-process worker.
+func NewRemoteWorker(client *RemoteClient, logger *zap.Logger) pkg.Worker {
+	return worker.NewWorker(NewRemoteTaskQueue(client, 0, logger), nil, logger)
+}
+
+func (q *RemoteTaskQueue) Enqueue(ctx context.Context, task *pkg.Task) error {
+	return fmt.Errorf("remote task queue cannot enqueue tasks")
+}
+
+// Dequeue polls the server for a task, waiting up to 30 seconds, and
+// returns nil when none arrived.
+func (q *RemoteTaskQueue) Dequeue(ctx context.Context, workerID string) (*pkg.Task, error) {
+	request := map[string]interface{}{
+		"worker_id": workerID,
+		"lease":     q.lease.String(),
+	}
+
+	var response struct {
+		Task           *pkg.Task `json:"task"`
+		LeaseExpiresAt time.Time `json:"lease_expires_at"`
+	}
+	if _, err := q.client.do(ctx, http.MethodPost, "/worker/poll", request, &response); err != nil {
+		return nil, err
+	}
+	if response.Task == nil {
+		return nil, nil
+	}
+
+	lease := &remoteLease{workerID: workerID, attempt: response.Task.RetryCount + 1, stop: make(chan struct{})}
+	q.mu.Lock()
+	q.heartbeats[response.Task.ID] = lease
+	q.mu.Unlock()
+
+	go q.heartbeat(response.Task.ID, lease)
+	return response.Task, nil
+}
+
+// UpdateTaskState reports the outcome of a dequeued task. Only completed and
+// failed are reported; the server derives every other state itself.
+func (q *RemoteTaskQueue) UpdateTaskState(ctx context.Context, taskID string, state pkg.TaskState, output map[string]interface{}, errMsg string) error {
+	return q.report(ctx, taskID, state, output, errMsg, true)
+}
+
+// FailTask reports a failed attempt of a dequeued task, asking the server
+// not to retry it unless retryable is true.
+func (q *RemoteTaskQueue) FailTask(ctx context.Context, taskID, errMsg string, retryable bool) error {
+	return q.report(ctx, taskID, pkg.TaskStateFailed, nil, errMsg, retryable)
+}
+
+func (q *RemoteTaskQueue) report(ctx context.Context, taskID string, state pkg.TaskState, output map[string]interface{}, errMsg string, retryable bool) error {
+	q.mu.Lock()
+	lease, exists := q.heartbeats[taskID]
+	delete(q.heartbeats, taskID)
+	var logs []*pkg.TaskLogEntry
+	if exists {
+		logs = lease.logs
+	}
+	q.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("task %s was not dequeued by this queue", taskID)
+	}
+	close(lease.stop)
+
+	var path string
+	var request map[string]interface{}
+	switch state {
+	case pkg.TaskStateCompleted:
+		path = "/worker/tasks/" + url.PathEscape(taskID) + "/complete"
+		request = map[string]interface{}{"worker_id": lease.workerID, "attempt": lease.attempt, "output": output, "logs": logs}
+	case pkg.TaskStateFailed:
+		path = "/worker/tasks/" + url.PathEscape(taskID) + "/fail"
+		request = map[string]interface{}{"worker_id": lease.workerID, "attempt": lease.attempt, "error": errMsg, "non_retryable": !retryable, "logs": logs}
+	default:
+		return fmt.Errorf("cannot report task state %s to a remote queue", state)
+	}
+
+	// A retried report whose first delivery got through is answered 200 by
+	// the server, so a conflict always means the outcome was not recorded
+	if _, err := q.client.do(ctx, http.MethodPost, path, request, nil); err != nil {
+		var apiError *APIError
+		if errors.As(err, &apiError) && apiError.StatusCode == http.StatusConflict {
+			return fmt.Errorf("%w: %s", pkg.ErrLeaseLost, apiError.Message)
+		}
+		return err
+	}
+	return nil
+}
+
+// SetTaskProgress reports a dequeued task's progress along with a renewal of
+// its lease and the log lines buffered so far.
+func (q *RemoteTaskQueue) SetTaskProgress(ctx context.Context, taskID string, progress pkg.TaskProgress) error {
+	q.mu.Lock()
+	lease, exists := q.heartbeats[taskID]
+	q.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf("task %s was not dequeued by this queue", taskID)
+	}
+	return q.sendHeartbeat(ctx, taskID, lease, &progress)
+}
+
+// AppendTaskLog buffers a log line of a dequeued task until its next
+// heartbeat or report carries it to the server.
+func (q *RemoteTaskQueue) AppendTaskLog(ctx context.Context, entry *pkg.TaskLogEntry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	lease, exists := q.heartbeats[entry.TaskID]
+	if !exists {
+		return fmt.Errorf("task %s was not dequeued by this queue", entry.TaskID)
+	}
+	lease.logs = append(lease.logs, entry)
+	return nil
+}
+
+// GetTaskLogs returns the log lines the server stored for a task; lines
+// still buffered by this queue are not included.
+func (q *RemoteTaskQueue) GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*pkg.TaskLogEntry, error) {
+	return q.client.GetTaskLogs(ctx, taskID, afterSeq, limit)
+}
+
+// sendHeartbeat renews the task's lease, shipping the buffered log lines
+// with it. The lines are buffered again when the request fails for any
+// reason but a lost lease.
+func (q *RemoteTaskQueue) sendHeartbeat(ctx context.Context, taskID string, lease *remoteLease, progress *pkg.TaskProgress) error {
+	q.mu.Lock()
+	logs := lease.logs
+	lease.logs = nil
+	q.mu.Unlock()
+
+	path := "/worker/tasks/" + url.PathEscape(taskID) + "/heartbeat"
+	request := map[string]interface{}{
+		"worker_id": lease.workerID,
+		"lease":     q.lease.String(),
+		"logs":      logs,
+	}
+	if progress != nil {
+		request["progress"] = progress
+	}
+
+	_, err := q.client.do(ctx, http.MethodPost, path, request, nil)
+	if err == nil {
+		return nil
+	}
+
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%w: %s", pkg.ErrLeaseLost, apiError.Message)
+	}
+	q.mu.Lock()
+	lease.logs = append(logs, lease.logs...)
+	q.mu.Unlock()
+	return err
+}
+
+// heartbeat renews the task's lease at a third of its length until the task
+// is reported or the lease is lost.
+func (q *RemoteTaskQueue) heartbeat(taskID string, lease *remoteLease) {
+	ticker := time.NewTicker(q.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lease.stop:
+			return
+		case <-ticker.C:
+			err := q.sendHeartbeat(context.Background(), taskID, lease, nil)
+			if err == nil {
+				continue
+			}
+
+			if errors.Is(err, pkg.ErrLeaseLost) {
+				q.logger.Warn("Task lease lost", zap.String("task_id", taskID))
+				return
+			}
+			q.logger.Warn("Failed to renew task lease", zap.String("task_id", taskID), zap.Error(err))
+		}
+	}
+}
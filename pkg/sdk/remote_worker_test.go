@@ -0,0 +1,89 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// stubWorkerServer hands out one task on poll and answers its reports with
+// the given statuses in turn, recording each report's body.
+type stubWorkerServer struct {
+	mu       sync.Mutex
+	statuses []int
+	reports  []map[string]interface{}
+}
+
+func (s *stubWorkerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/worker/poll" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"task":             pkg.Task{ID: "task-1", Type: "remote", RetryCount: 1},
+			"lease_expires_at": time.Now().Add(time.Minute),
+		})
+		return
+	}
+
+	var report map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&report)
+
+	s.mu.Lock()
+	s.reports = append(s.reports, report)
+	status := s.statuses[0]
+	s.statuses = s.statuses[1:]
+	s.mu.Unlock()
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(status)})
+}
+
+func newStubQueue(t *testing.T, statuses ...int) (*RemoteTaskQueue, *stubWorkerServer) {
+	t.Helper()
+
+	stub := &stubWorkerServer{statuses: statuses}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	client, err := NewRemoteClient(RemoteClientConfig{BaseURL: server.URL, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	q := NewRemoteTaskQueue(client, time.Minute, zap.NewNop())
+	if _, err := q.Dequeue(context.Background(), "remote-1"); err != nil {
+		t.Fatalf("failed to dequeue: %v", err)
+	}
+	return q, stub
+}
+
+func TestRemoteReportRetriedAfterServerError(t *testing.T) {
+	q, stub := newStubQueue(t, http.StatusInternalServerError, http.StatusOK)
+
+	if err := q.UpdateTaskState(context.Background(), "task-1", pkg.TaskStateCompleted, nil, ""); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if len(stub.reports) != 2 {
+		t.Fatalf("sent %d reports, want a retry", len(stub.reports))
+	}
+	if stub.reports[1]["attempt"] != float64(2) {
+		t.Errorf("attempt = %v, want the polled attempt 2", stub.reports[1]["attempt"])
+	}
+}
+
+func TestRemoteReportConflictLosesLease(t *testing.T) {
+	// A retried report still conflicts when the server did not record it,
+	// e.g. because the lease was reclaimed between the attempts
+	q, _ := newStubQueue(t, http.StatusInternalServerError, http.StatusConflict)
+
+	err := q.FailTask(context.Background(), "task-1", "boom", true)
+	if !errors.Is(err, pkg.ErrLeaseLost) {
+		t.Errorf("report after a conflict: err = %v, want ErrLeaseLost", err)
+	}
+}
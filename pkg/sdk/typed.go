@@ -0,0 +1,85 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// Validator is implemented by typed inputs that check themselves after
+// decoding. TypedHandler and ValidateInputAs call Validate on the decoded
+// value.
+type Validator interface {
+	Validate() error
+}
+
+// DecodeInput decodes a task or workflow input into a T through JSON. Fields
+// of the input that T does not declare, such as the outputs of other steps,
+// are ignored. When T implements Validator the decoded value is validated.
+func DecodeInput[T any](input map[string]interface{}) (T, error) {
+	var value T
+	data, err := json.Marshal(input)
+	if err != nil {
+		return value, fmt.Errorf("failed to encode input: %w", err)
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("failed to decode input: %w", err)
+	}
+	if validator, ok := any(&value).(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return value, fmt.Errorf("invalid input: %w", err)
+		}
+	}
+	return value, nil
+}
+
+// EncodeInput encodes value into the map form of a task or workflow input
+// through JSON. value must encode to a JSON object.
+func EncodeInput(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", value, err)
+	}
+	var input map[string]interface{}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("%T does not encode to a JSON object: %w", value, err)
+	}
+	return input, nil
+}
+
+// TypedHandler adapts fn to a pkg.TaskHandler. The task input is decoded
+// into In and the Out fn returns is encoded as the task output, both through
+// JSON. Input that does not decode or validate and output that does not
+// encode to an object fail the task without retrying it; errors fn returns
+// are retried unless wrapped with pkg.NonRetryable.
+func TypedHandler[In, Out any](fn func(ctx context.Context, input In) (Out, error)) pkg.TaskHandler {
+	return func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		typedInput, err := DecodeInput[In](input)
+		if err != nil {
+			return nil, pkg.NonRetryable(err)
+		}
+
+		typedOutput, err := fn(ctx, typedInput)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := EncodeInput(typedOutput)
+		if err != nil {
+			return nil, pkg.NonRetryable(fmt.Errorf("failed to encode output: %w", err))
+		}
+		return output, nil
+	}
+}
+
+// ValidateInputAs returns a validator for WorkflowBuilder.ValidateInput that
+// rejects submissions whose input does not decode into a T or, when T
+// implements Validator, does not validate.
+func ValidateInputAs[T any]() func(input map[string]interface{}) error {
+	return func(input map[string]interface{}) error {
+		_, err := DecodeInput[T](input)
+		return err
+	}
+}
@@ -0,0 +1,98 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+type testOrder struct {
+	ID     string  `json:"id"`
+	Amount float64 `json:"amount"`
+}
+
+func (o *testOrder) Validate() error {
+	if o.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	return nil
+}
+
+type testReceipt struct {
+	OrderID string  `json:"order_id"`
+	Total   float64 `json:"total"`
+}
+
+func TestDecodeInputIgnoresUnknownFields(t *testing.T) {
+	order, err := DecodeInput[testOrder](map[string]interface{}{"id": "a", "amount": 5, "other_step": true})
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if order.ID != "a" || order.Amount != 5 {
+		t.Errorf("order = %+v", order)
+	}
+}
+
+func TestDecodeInputValidates(t *testing.T) {
+	if _, err := DecodeInput[testOrder](map[string]interface{}{"id": "a", "amount": 0}); err == nil {
+		t.Error("invalid order decoded without error")
+	}
+	if err := ValidateInputAs[testOrder]()(map[string]interface{}{"amount": "ten"}); err == nil {
+		t.Error("undecodable input passed validation")
+	}
+}
+
+func TestEncodeInputRequiresObject(t *testing.T) {
+	if _, err := EncodeInput([]int{1, 2}); err == nil {
+		t.Error("slice encoded as an input")
+	}
+
+	input, err := EncodeInput(testReceipt{OrderID: "a", Total: 2})
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if input["order_id"] != "a" || input["total"] != float64(2) {
+		t.Errorf("input = %v", input)
+	}
+}
+
+func TestTypedHandler(t *testing.T) {
+	handler := TypedHandler(func(ctx context.Context, order testOrder) (testReceipt, error) {
+		if order.ID == "retry" {
+			return testReceipt{}, errors.New("temporary")
+		}
+		return testReceipt{OrderID: order.ID, Total: order.Amount * 2}, nil
+	})
+	ctx := context.Background()
+
+	output, err := handler(ctx, map[string]interface{}{"id": "a", "amount": 21.0})
+	if err != nil {
+		t.Fatalf("handler failed: %v", err)
+	}
+	if output["order_id"] != "a" || output["total"] != float64(42) {
+		t.Errorf("output = %v", output)
+	}
+
+	_, err = handler(ctx, map[string]interface{}{"id": "a", "amount": -1.0})
+	if err == nil || !pkg.IsNonRetryable(err) {
+		t.Errorf("invalid input: err = %v, want a non-retryable error", err)
+	}
+
+	_, err = handler(ctx, map[string]interface{}{"id": "retry", "amount": 1.0})
+	if err == nil || pkg.IsNonRetryable(err) {
+		t.Errorf("handler error: err = %v, want a retryable error", err)
+	}
+}
+
+func TestTypedHandlerRejectsNonObjectOutput(t *testing.T) {
+	handler := TypedHandler(func(ctx context.Context, order testOrder) (string, error) {
+		return "done", nil
+	})
+
+	_, err := handler(context.Background(), map[string]interface{}{"id": "a", "amount": 1.0})
+	if err == nil || !pkg.IsNonRetryable(err) {
+		t.Errorf("err = %v, want a non-retryable encoding error", err)
+	}
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// Both state managers share Redis pub/sub for live events: each event is
+// published on its workflow's channel and global subscribers match them all
+// with a pattern.
+
+func publishEvent(ctx context.Context, client *redis.Client, event *pkg.HistoryEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := client.Publish(ctx, EventChannelPrefix+event.WorkflowID, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+func subscribeEvents(ctx context.Context, client *redis.Client, workflowID string) (<-chan *pkg.HistoryEvent, error) {
+	var pubsub *redis.PubSub
+	if workflowID == "" {
+		pubsub = client.PSubscribe(ctx, EventChannelPrefix+"*")
+	} else {
+		pubsub = client.Subscribe(ctx, EventChannelPrefix+workflowID)
+	}
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to events: %w", err)
+	}
+
+	events := make(chan *pkg.HistoryEvent, 64)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var event pkg.HistoryEvent
+				if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+					continue
+				}
+
+				select {
+				case events <- &event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,634 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// memoryEventBuffer is how many events a subscriber may fall behind before
+// further events are dropped, as a slow Redis subscriber would lose them.
+const memoryEventBuffer = 64
+
+// MemoryStateManager keeps all state in process memory, for tests and for
+// embedding temjob without Redis or MySQL. It implements the same optional
+// interfaces as RedisStateManager. Values are stored JSON-encoded, so callers
+// get copies and inputs round-trip exactly as they would through Redis, with
+// numbers decoded as float64. Nothing is shared with other processes or kept
+// across restarts.
+type MemoryStateManager struct {
+	mu           sync.RWMutex
+	workflows    map[string][]byte
+	tasks        map[string][]byte
+	signals      map[string]map[string][][]byte
+	schedules    map[string][]byte
+	concurrency  map[string]map[string]bool
+	history      map[string][][]byte
+	taskLogs     map[string][][]byte
+	webhooks     map[string][]byte
+	webhookLists map[string][]string
+	webhooksDue  map[string]time.Time
+	backfills    map[string][]byte
+
+	subscribersMu sync.Mutex
+	subscribers   map[chan *pkg.HistoryEvent]string
+}
+
+func NewMemoryStateManager() *MemoryStateManager {
+	return &MemoryStateManager{
+		workflows:    make(map[string][]byte),
+		tasks:        make(map[string][]byte),
+		signals:      make(map[string]map[string][][]byte),
+		schedules:    make(map[string][]byte),
+		concurrency:  make(map[string]map[string]bool),
+		history:      make(map[string][][]byte),
+		taskLogs:     make(map[string][][]byte),
+		webhooks:     make(map[string][]byte),
+		webhookLists: make(map[string][]string),
+		webhooksDue:  make(map[string]time.Time),
+		backfills:    make(map[string][]byte),
+		subscribers:  make(map[chan *pkg.HistoryEvent]string),
+	}
+}
+
+func (s *MemoryStateManager) SaveWorkflow(ctx context.Context, workflow *pkg.Workflow) error {
+	data, err := json.Marshal(workflow)
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workflows[workflow.ID] = data
+	return nil
+}
+
+func (s *MemoryStateManager) CreateWorkflow(ctx context.Context, workflow *pkg.Workflow, policy pkg.WorkflowIDReusePolicy) error {
+	data, err := json.Marshal(workflow)
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.workflows[workflow.ID]; ok {
+		var current pkg.Workflow
+		if err := json.Unmarshal(existing, &current); err != nil {
+			return fmt.Errorf("failed to unmarshal workflow: %w", err)
+		}
+		if !policy.Allows(current.State) {
+			return fmt.Errorf("%w: %s is %s", pkg.ErrWorkflowExists, workflow.ID, current.State)
+		}
+
+		// Drop the previous run's tasks, history and undelivered signals
+		for _, taskID := range current.Tasks {
+			delete(s.tasks, taskID)
+			delete(s.taskLogs, taskID)
+		}
+		delete(s.history, workflow.ID)
+		delete(s.signals, workflow.ID)
+	}
+
+	s.workflows[workflow.ID] = data
+	return nil
+}
+
+func (s *MemoryStateManager) UpdateWorkflow(ctx context.Context, workflowID string, update func(*pkg.Workflow) error) (*pkg.Workflow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.workflows[workflowID]
+	if !ok {
+		return nil, fmt.Errorf("workflow not found: %s", workflowID)
+	}
+
+	var workflow pkg.Workflow
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow: %w", err)
+	}
+	if err := update(&workflow); err != nil {
+		return nil, err
+	}
+
+	updated, err := json.Marshal(&workflow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal workflow: %w", err)
+	}
+	s.workflows[workflowID] = updated
+	return &workflow, nil
+}
+
+func (s *MemoryStateManager) GetWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
+	s.mu.RLock()
+	data, ok := s.workflows[workflowID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("workflow not found: %s", workflowID)
+	}
+
+	var workflow pkg.Workflow
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow: %w", err)
+	}
+
+	return &workflow, nil
+}
+
+func (s *MemoryStateManager) SaveTask(ctx context.Context, task *pkg.Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[task.ID] = data
+	return nil
+}
+
+func (s *MemoryStateManager) GetTask(ctx context.Context, taskID string) (*pkg.Task, error) {
+	s.mu.RLock()
+	data, ok := s.tasks[taskID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("task not found: %s", taskID)
+	}
+
+	var task pkg.Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+
+	return &task, nil
+}
+
+func (s *MemoryStateManager) GetWorkflowTasks(ctx context.Context, workflowID string) ([]*pkg.Task, error) {
+	workflow, err := s.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*pkg.Task, 0, len(workflow.Tasks))
+	for _, taskID := range workflow.Tasks {
+		task, err := s.GetTask(ctx, taskID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get task %s: %w", taskID, err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// ListWorkflows returns workflows newest first, as RedisStateManager does.
+func (s *MemoryStateManager) ListWorkflows(ctx context.Context, limit, offset int) ([]*pkg.Workflow, error) {
+	s.mu.RLock()
+	workflows := make([]*pkg.Workflow, 0, len(s.workflows))
+	for _, data := range s.workflows {
+		var workflow pkg.Workflow
+		if err := json.Unmarshal(data, &workflow); err != nil {
+			continue
+		}
+		workflows = append(workflows, &workflow)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(workflows, func(i, j int) bool {
+		if !workflows[i].CreatedAt.Equal(workflows[j].CreatedAt) {
+			return workflows[i].CreatedAt.After(workflows[j].CreatedAt)
+		}
+		return workflows[i].ID > workflows[j].ID
+	})
+
+	if offset >= len(workflows) {
+		return []*pkg.Workflow{}, nil
+	}
+	workflows = workflows[offset:]
+	if limit >= 0 && limit < len(workflows) {
+		workflows = workflows[:limit]
+	}
+	return workflows, nil
+}
+
+func (s *MemoryStateManager) UpdateWorkflowState(ctx context.Context, workflowID string, state pkg.WorkflowState) error {
+	workflow, err := s.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+
+	workflow.State = state
+	return s.SaveWorkflow(ctx, workflow)
+}
+
+func (s *MemoryStateManager) GetWorkflowStats(ctx context.Context) (map[string]int64, error) {
+	workflows, err := s.ListWorkflows(ctx, 1000, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]int64)
+	for _, workflow := range workflows {
+		stats[string(workflow.State)]++
+	}
+
+	return stats, nil
+}
+
+func (s *MemoryStateManager) SaveSignal(ctx context.Context, signal *pkg.Signal) error {
+	data, err := json.Marshal(signal)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signal: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.signals[signal.WorkflowID]
+	if pending == nil {
+		pending = make(map[string][][]byte)
+		s.signals[signal.WorkflowID] = pending
+	}
+	pending[signal.Name] = append(pending[signal.Name], data)
+	return nil
+}
+
+func (s *MemoryStateManager) ConsumeSignal(ctx context.Context, workflowID, signalName string) (*pkg.Signal, error) {
+	s.mu.Lock()
+	pending := s.signals[workflowID][signalName]
+	if len(pending) == 0 {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	data := pending[0]
+	if len(pending) == 1 {
+		delete(s.signals[workflowID], signalName)
+	} else {
+		s.signals[workflowID][signalName] = pending[1:]
+	}
+	s.mu.Unlock()
+
+	var signal pkg.Signal
+	if err := json.Unmarshal(data, &signal); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signal: %w", err)
+	}
+
+	return &signal, nil
+}
+
+func (s *MemoryStateManager) SaveSchedule(ctx context.Context, schedule *pkg.Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[schedule.ID] = data
+	return nil
+}
+
+func (s *MemoryStateManager) GetSchedule(ctx context.Context, scheduleID string) (*pkg.Schedule, error) {
+	s.mu.RLock()
+	data, ok := s.schedules[scheduleID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("schedule not found: %s", scheduleID)
+	}
+
+	var schedule pkg.Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+func (s *MemoryStateManager) UpdateSchedule(ctx context.Context, scheduleID string, update func(*pkg.Schedule) error) (*pkg.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.schedules[scheduleID]
+	if !ok {
+		return nil, fmt.Errorf("schedule not found: %s", scheduleID)
+	}
+
+	var schedule pkg.Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+	if err := update(&schedule); err != nil {
+		return nil, err
+	}
+
+	updated, err := json.Marshal(&schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+	s.schedules[scheduleID] = updated
+	return &schedule, nil
+}
+
+func (s *MemoryStateManager) ListSchedules(ctx context.Context) ([]*pkg.Schedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]*pkg.Schedule, 0, len(s.schedules))
+	for _, data := range s.schedules {
+		var schedule pkg.Schedule
+		if err := json.Unmarshal(data, &schedule); err != nil {
+			continue
+		}
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, nil
+}
+
+func (s *MemoryStateManager) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[scheduleID]; !ok {
+		return fmt.Errorf("schedule not found: %s", scheduleID)
+	}
+	delete(s.schedules, scheduleID)
+	return nil
+}
+
+func (s *MemoryStateManager) AcquireConcurrencySlot(ctx context.Context, key, workflowID string, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	holders := s.concurrency[key]
+	if holders[workflowID] || len(holders) >= limit {
+		return false, nil
+	}
+	if holders == nil {
+		holders = make(map[string]bool)
+		s.concurrency[key] = holders
+	}
+	holders[workflowID] = true
+	return true, nil
+}
+
+func (s *MemoryStateManager) ReleaseConcurrencySlot(ctx context.Context, key, workflowID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.concurrency[key], workflowID)
+	if len(s.concurrency[key]) == 0 {
+		delete(s.concurrency, key)
+	}
+	return nil
+}
+
+// AppendHistoryEvent numbers events by their position in the workflow's
+// history, as RedisStateManager does.
+func (s *MemoryStateManager) AppendHistoryEvent(ctx context.Context, event *pkg.HistoryEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history[event.WorkflowID] = append(s.history[event.WorkflowID], data)
+	event.ID = int64(len(s.history[event.WorkflowID]))
+	return nil
+}
+
+func (s *MemoryStateManager) GetWorkflowHistory(ctx context.Context, workflowID string) ([]*pkg.HistoryEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := s.history[workflowID]
+	events := make([]*pkg.HistoryEvent, 0, len(values))
+	for i, data := range values {
+		var event pkg.HistoryEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal history event: %w", err)
+		}
+		event.ID = int64(i + 1)
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+// PublishEvent hands a copy of event to every matching subscriber without
+// blocking; a subscriber whose buffer is full misses it.
+func (s *MemoryStateManager) PublishEvent(ctx context.Context, event *pkg.HistoryEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	for events, workflowID := range s.subscribers {
+		if workflowID != "" && workflowID != event.WorkflowID {
+			continue
+		}
+
+		var copied pkg.HistoryEvent
+		if err := json.Unmarshal(data, &copied); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w", err)
+		}
+		select {
+		case events <- &copied:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStateManager) SubscribeEvents(ctx context.Context, workflowID string) (<-chan *pkg.HistoryEvent, error) {
+	events := make(chan *pkg.HistoryEvent, memoryEventBuffer)
+
+	s.subscribersMu.Lock()
+	s.subscribers[events] = workflowID
+	s.subscribersMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.subscribersMu.Lock()
+		delete(s.subscribers, events)
+		close(events)
+		s.subscribersMu.Unlock()
+	}()
+
+	return events, nil
+}
+
+// AppendTaskLog numbers a task's lines by their position in its log, as
+// RedisStateManager does.
+func (s *MemoryStateManager) AppendTaskLog(ctx context.Context, entry *pkg.TaskLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task log: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.taskLogs[entry.TaskID] = append(s.taskLogs[entry.TaskID], data)
+	entry.Seq = int64(len(s.taskLogs[entry.TaskID]))
+	return nil
+}
+
+func (s *MemoryStateManager) GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*pkg.TaskLogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := s.taskLogs[taskID]
+	if afterSeq < 0 {
+		afterSeq = 0
+	}
+	if afterSeq >= int64(len(values)) {
+		return []*pkg.TaskLogEntry{}, nil
+	}
+	values = values[afterSeq:]
+	if limit >= 0 && limit < len(values) {
+		values = values[:limit]
+	}
+
+	entries := make([]*pkg.TaskLogEntry, 0, len(values))
+	for i, data := range values {
+		var entry pkg.TaskLogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal task log: %w", err)
+		}
+		entry.Seq = afterSeq + int64(i) + 1
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+func (s *MemoryStateManager) SaveWebhookDelivery(ctx context.Context, delivery *pkg.WebhookDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook delivery: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[delivery.ID]; !ok {
+		s.webhookLists[delivery.WorkflowID] = append(s.webhookLists[delivery.WorkflowID], delivery.ID)
+	}
+	s.webhooks[delivery.ID] = data
+	if delivery.NextAttemptAt != nil {
+		s.webhooksDue[delivery.ID] = *delivery.NextAttemptAt
+	} else {
+		delete(s.webhooksDue, delivery.ID)
+	}
+	return nil
+}
+
+func (s *MemoryStateManager) GetWebhookDelivery(ctx context.Context, deliveryID string) (*pkg.WebhookDelivery, error) {
+	s.mu.RLock()
+	data, ok := s.webhooks[deliveryID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("webhook delivery not found: %s", deliveryID)
+	}
+
+	var delivery pkg.WebhookDelivery
+	if err := json.Unmarshal(data, &delivery); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook delivery: %w", err)
+	}
+
+	return &delivery, nil
+}
+
+func (s *MemoryStateManager) ListWebhookDeliveries(ctx context.Context, workflowID string) ([]*pkg.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getWebhookDeliveries(s.webhookLists[workflowID]), nil
+}
+
+// ClaimWebhookDeliveries claims the deliveries due earliest, pushing their
+// next attempt back by lease.
+func (s *MemoryStateManager) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*pkg.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []string
+	for deliveryID, dueAt := range s.webhooksDue {
+		if !dueAt.After(now) {
+			due = append(due, deliveryID)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return s.webhooksDue[due[i]].Before(s.webhooksDue[due[j]])
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimedUntil := now.Add(lease)
+	for _, deliveryID := range due {
+		s.webhooksDue[deliveryID] = claimedUntil
+	}
+
+	return s.getWebhookDeliveries(due), nil
+}
+
+// getWebhookDeliveries decodes the given deliveries; s.mu must be held.
+func (s *MemoryStateManager) getWebhookDeliveries(deliveryIDs []string) []*pkg.WebhookDelivery {
+	deliveries := make([]*pkg.WebhookDelivery, 0, len(deliveryIDs))
+	for _, deliveryID := range deliveryIDs {
+		var delivery pkg.WebhookDelivery
+		if err := json.Unmarshal(s.webhooks[deliveryID], &delivery); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries
+}
+
+// SaveBackfill drops the backfills not updated for pkg.BackfillRetention
+// as it stores a new state, like Redis expires them.
+func (s *MemoryStateManager) SaveBackfill(ctx context.Context, backfill *pkg.Backfill) error {
+	data, err := json.Marshal(backfill)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backfill: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-pkg.BackfillRetention)
+	for id, stored := range s.backfills {
+		var existing pkg.Backfill
+		if json.Unmarshal(stored, &existing) != nil || existing.UpdatedAt.Before(cutoff) {
+			delete(s.backfills, id)
+		}
+	}
+
+	s.backfills[backfill.ID] = data
+	return nil
+}
+
+func (s *MemoryStateManager) GetBackfill(ctx context.Context, backfillID string) (*pkg.Backfill, error) {
+	s.mu.RLock()
+	data, ok := s.backfills[backfillID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("backfill not found: %s", backfillID)
+	}
+
+	var backfill pkg.Backfill
+	if err := json.Unmarshal(data, &backfill); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backfill: %w", err)
+	}
+
+	return &backfill, nil
+}
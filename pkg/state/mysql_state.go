@@ -3,12 +3,14 @@ package state
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/XXueTu/temjob/pkg"
 	"github.com/XXueTu/temjob/pkg/models"
@@ -31,19 +33,7 @@ func NewMySQLStateManager(db *gorm.DB, redis *redis.Client, logger *zap.Logger)
 }
 
 func (s *MySQLStateManager) SaveWorkflow(ctx context.Context, workflow *pkg.Workflow) error {
-	inputJSON, _ := json.Marshal(workflow.Input)
-	outputJSON, _ := json.Marshal(workflow.Output)
-
-	workflowModel := &models.WorkflowModel{
-		ID:        workflow.ID,
-		Name:      workflow.Name,
-		Input:     string(inputJSON),
-		Output:    string(outputJSON),
-		State:     string(workflow.State),
-		CreatedAt: workflow.CreatedAt,
-		StartedAt: workflow.StartedAt,
-		EndedAt:   workflow.EndedAt,
-	}
+	workflowModel := workflowToModel(workflow)
 
 	err := s.db.WithContext(ctx).Save(workflowModel).Error
 	if err != nil {
@@ -58,6 +48,102 @@ func (s *MySQLStateManager) SaveWorkflow(ctx context.Context, workflow *pkg.Work
 	return nil
 }
 
+// CreateWorkflow inserts the workflow, or replaces an existing one the
+// policy allows reusing together with its tasks, task logs, history and
+// signals, all in one transaction.
+func (s *MySQLStateManager) CreateWorkflow(ctx context.Context, workflow *pkg.Workflow, policy pkg.WorkflowIDReusePolicy) error {
+	workflowModel := workflowToModel(workflow)
+	var staleTaskIDs []string
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(workflowModel)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+
+		var existing models.WorkflowModel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", workflow.ID).First(&existing).Error; err != nil {
+			return err
+		}
+		if !policy.Allows(pkg.WorkflowState(existing.State)) {
+			return fmt.Errorf("%w: %s is %s", pkg.ErrWorkflowExists, workflow.ID, existing.State)
+		}
+
+		if err := tx.Model(&models.TaskModel{}).Where("workflow_id = ?", workflow.ID).Pluck("id", &staleTaskIDs).Error; err != nil {
+			return err
+		}
+		for _, stale := range []interface{}{
+			&models.TaskModel{},
+			&models.TaskLogModel{},
+			&models.WorkflowExecutionLog{},
+			&models.WorkflowSignal{},
+		} {
+			if err := tx.Where("workflow_id = ?", workflow.ID).Delete(stale).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(workflowModel).Error
+	})
+	if err != nil {
+		if errors.Is(err, pkg.ErrWorkflowExists) {
+			return err
+		}
+		return fmt.Errorf("failed to create workflow in MySQL: %w", err)
+	}
+
+	workflowJSON, _ := json.Marshal(workflow)
+	pipe := s.redis.Pipeline()
+	pipe.Set(ctx, "workflow:"+workflow.ID, workflowJSON, s.cacheTTL)
+	pipe.Del(ctx, "workflow_tasks:"+workflow.ID)
+	for _, taskID := range staleTaskIDs {
+		pipe.Del(ctx, "task:"+taskID)
+	}
+	pipe.Exec(ctx)
+
+	s.logger.Info("Workflow created", zap.String("workflow_id", workflow.ID))
+	return nil
+}
+
+// UpdateWorkflow applies update to the workflow row under a row lock, so
+// concurrent updates run one after the other against fresh state.
+func (s *MySQLStateManager) UpdateWorkflow(ctx context.Context, workflowID string, update func(*pkg.Workflow) error) (*pkg.Workflow, error) {
+	var workflow *pkg.Workflow
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var workflowModel models.WorkflowModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Tasks", func(db *gorm.DB) *gorm.DB { return db.Select("id", "workflow_id").Order("created_at") }).
+			First(&workflowModel, "id = ?", workflowID).Error
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("workflow not found: %s", workflowID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get workflow from MySQL: %w", err)
+		}
+
+		workflow = s.modelToWorkflow(&workflowModel)
+		if err := update(workflow); err != nil {
+			return err
+		}
+		if err := tx.Save(workflowToModel(workflow)).Error; err != nil {
+			return fmt.Errorf("failed to save workflow to MySQL: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	workflowJSON, _ := json.Marshal(workflow)
+	s.redis.Set(ctx, "workflow:"+workflow.ID, workflowJSON, s.cacheTTL)
+
+	s.logger.Info("Workflow updated", zap.String("workflow_id", workflow.ID))
+	return workflow, nil
+}
+
 func (s *MySQLStateManager) GetWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
 	cacheKey := "workflow:" + workflowID
 
@@ -89,11 +175,15 @@ func (s *MySQLStateManager) GetWorkflow(ctx context.Context, workflowID string)
 func (s *MySQLStateManager) SaveTask(ctx context.Context, task *pkg.Task) error {
 	inputJSON, _ := json.Marshal(task.Input)
 	outputJSON, _ := json.Marshal(task.Output)
+	approvalJSON, _ := json.Marshal(task.Approval)
+	attemptsJSON, _ := json.Marshal(task.Attempts)
+	progressJSON, _ := json.Marshal(task.Progress)
 
 	taskModel := &models.TaskModel{
 		ID:          task.ID,
 		WorkflowID:  task.WorkflowID,
 		Type:        task.Type,
+		Kind:        string(task.Kind),
 		Input:       string(inputJSON),
 		Output:      string(outputJSON),
 		State:       string(task.State),
@@ -104,6 +194,11 @@ func (s *MySQLStateManager) SaveTask(ctx context.Context, task *pkg.Task) error
 		StartedAt:   task.StartedAt,
 		CompletedAt: task.CompletedAt,
 		WorkerID:    task.WorkerID,
+		WakeAt:      task.WakeAt,
+		Approval:    string(approvalJSON),
+		Attempts:    string(attemptsJSON),
+		Priority:    task.Priority,
+		Progress:    string(progressJSON),
 	}
 
 	err := s.db.WithContext(ctx).Save(taskModel).Error
@@ -190,26 +285,56 @@ func (s *MySQLStateManager) ListWorkflows(ctx context.Context, limit, offset int
 	return workflows, nil
 }
 
+func workflowToModel(workflow *pkg.Workflow) *models.WorkflowModel {
+	inputJSON, _ := json.Marshal(workflow.Input)
+	outputJSON, _ := json.Marshal(workflow.Output)
+	webhooksJSON, _ := json.Marshal(workflow.Webhooks)
+
+	return &models.WorkflowModel{
+		ID:             workflow.ID,
+		Name:           workflow.Name,
+		Input:          string(inputJSON),
+		Output:         string(outputJSON),
+		State:          string(workflow.State),
+		Error:          workflow.Error,
+		CreatedAt:      workflow.CreatedAt,
+		StartedAt:      workflow.StartedAt,
+		EndedAt:        workflow.EndedAt,
+		ConcurrencyKey: workflow.ConcurrencyKey,
+		WaitingReason:  workflow.WaitingReason,
+		Priority:       workflow.Priority,
+		Webhooks:       string(webhooksJSON),
+	}
+}
+
 func (s *MySQLStateManager) modelToWorkflow(model *models.WorkflowModel) *pkg.Workflow {
 	var input, output map[string]interface{}
 	json.Unmarshal([]byte(model.Input), &input)
 	json.Unmarshal([]byte(model.Output), &output)
 
+	var webhooks []pkg.Webhook
+	json.Unmarshal([]byte(model.Webhooks), &webhooks)
+
 	var taskIDs []string
 	for _, task := range model.Tasks {
 		taskIDs = append(taskIDs, task.ID)
 	}
 
 	return &pkg.Workflow{
-		ID:        model.ID,
-		Name:      model.Name,
-		Input:     input,
-		Output:    output,
-		State:     pkg.WorkflowState(model.State),
-		Tasks:     taskIDs,
-		CreatedAt: model.CreatedAt,
-		StartedAt: model.StartedAt,
-		EndedAt:   model.EndedAt,
+		ID:             model.ID,
+		Name:           model.Name,
+		Input:          input,
+		Output:         output,
+		State:          pkg.WorkflowState(model.State),
+		Error:          model.Error,
+		Tasks:          taskIDs,
+		CreatedAt:      model.CreatedAt,
+		StartedAt:      model.StartedAt,
+		EndedAt:        model.EndedAt,
+		ConcurrencyKey: model.ConcurrencyKey,
+		WaitingReason:  model.WaitingReason,
+		Priority:       model.Priority,
+		Webhooks:       webhooks,
 	}
 }
 
@@ -218,10 +343,20 @@ func (s *MySQLStateManager) modelToTask(model *models.TaskModel) *pkg.Task {
 	json.Unmarshal([]byte(model.Input), &input)
 	json.Unmarshal([]byte(model.Output), &output)
 
+	var approval *pkg.ApprovalDecision
+	json.Unmarshal([]byte(model.Approval), &approval)
+
+	var attempts []pkg.TaskAttempt
+	json.Unmarshal([]byte(model.Attempts), &attempts)
+
+	var progress *pkg.TaskProgress
+	json.Unmarshal([]byte(model.Progress), &progress)
+
 	return &pkg.Task{
 		ID:          model.ID,
 		WorkflowID:  model.WorkflowID,
 		Type:        model.Type,
+		Kind:        pkg.StepKind(model.Kind),
 		Input:       input,
 		Output:      output,
 		State:       pkg.TaskState(model.State),
@@ -232,6 +367,11 @@ func (s *MySQLStateManager) modelToTask(model *models.TaskModel) *pkg.Task {
 		StartedAt:   model.StartedAt,
 		CompletedAt: model.CompletedAt,
 		WorkerID:    model.WorkerID,
+		WakeAt:      model.WakeAt,
+		Approval:    approval,
+		Attempts:    attempts,
+		Priority:    model.Priority,
+		Progress:    progress,
 	}
 }
 
@@ -272,3 +412,511 @@ func (s *MySQLStateManager) LogWorkflowExecution(ctx context.Context, workflowID
 
 	return s.db.WithContext(ctx).Create(log).Error
 }
+
+func (s *MySQLStateManager) AppendHistoryEvent(ctx context.Context, event *pkg.HistoryEvent) error {
+	metadataJSON, _ := json.Marshal(event.Metadata)
+
+	log := &models.WorkflowExecutionLog{
+		WorkflowID: event.WorkflowID,
+		TaskID:     event.TaskID,
+		EventType:  string(event.Type),
+		Level:      event.Level,
+		Message:    event.Message,
+		Metadata:   string(metadataJSON),
+		CreatedAt:  event.CreatedAt,
+	}
+
+	if err := s.db.WithContext(ctx).Create(log).Error; err != nil {
+		return fmt.Errorf("failed to append history event to MySQL: %w", err)
+	}
+
+	event.ID = int64(log.ID)
+	return nil
+}
+
+func (s *MySQLStateManager) GetWorkflowHistory(ctx context.Context, workflowID string) ([]*pkg.HistoryEvent, error) {
+	var logs []models.WorkflowExecutionLog
+	err := s.db.WithContext(ctx).Where("workflow_id = ?", workflowID).Order("id").Find(&logs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow history from MySQL: %w", err)
+	}
+
+	events := make([]*pkg.HistoryEvent, len(logs))
+	for i, log := range logs {
+		var metadata map[string]interface{}
+		json.Unmarshal([]byte(log.Metadata), &metadata)
+
+		events[i] = &pkg.HistoryEvent{
+			ID:         int64(log.ID),
+			WorkflowID: log.WorkflowID,
+			TaskID:     log.TaskID,
+			Type:       pkg.EventType(log.EventType),
+			Level:      log.Level,
+			Message:    log.Message,
+			Metadata:   metadata,
+			CreatedAt:  log.CreatedAt,
+		}
+	}
+
+	return events, nil
+}
+
+func (s *MySQLStateManager) PublishEvent(ctx context.Context, event *pkg.HistoryEvent) error {
+	return publishEvent(ctx, s.redis, event)
+}
+
+func (s *MySQLStateManager) SubscribeEvents(ctx context.Context, workflowID string) (<-chan *pkg.HistoryEvent, error) {
+	return subscribeEvents(ctx, s.redis, workflowID)
+}
+
+func (s *MySQLStateManager) SaveSignal(ctx context.Context, signal *pkg.Signal) error {
+	payloadJSON, _ := json.Marshal(signal.Payload)
+
+	signalModel := &models.WorkflowSignal{
+		ID:         signal.ID,
+		WorkflowID: signal.WorkflowID,
+		Name:       signal.Name,
+		Payload:    string(payloadJSON),
+		CreatedAt:  signal.CreatedAt,
+	}
+
+	if err := s.db.WithContext(ctx).Create(signalModel).Error; err != nil {
+		return fmt.Errorf("failed to save signal to MySQL: %w", err)
+	}
+
+	s.logger.Info("Signal saved", zap.String("workflow_id", signal.WorkflowID), zap.String("signal", signal.Name))
+	return nil
+}
+
+// ConsumeSignal marks the oldest unconsumed signal as consumed inside a
+// locking transaction so concurrent engines never deliver it twice.
+func (s *MySQLStateManager) ConsumeSignal(ctx context.Context, workflowID, signalName string) (*pkg.Signal, error) {
+	var signalModel models.WorkflowSignal
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("workflow_id = ? AND name = ? AND consumed_at IS NULL", workflowID, signalName).
+			Order("created_at").
+			First(&signalModel).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		signalModel.ConsumedAt = &now
+		return tx.Model(&signalModel).Update("consumed_at", now).Error
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume signal from MySQL: %w", err)
+	}
+
+	var payload map[string]interface{}
+	json.Unmarshal([]byte(signalModel.Payload), &payload)
+
+	return &pkg.Signal{
+		ID:         signalModel.ID,
+		WorkflowID: signalModel.WorkflowID,
+		Name:       signalModel.Name,
+		Payload:    payload,
+		CreatedAt:  signalModel.CreatedAt,
+	}, nil
+}
+
+func (s *MySQLStateManager) SaveSchedule(ctx context.Context, schedule *pkg.Schedule) error {
+	if err := s.db.WithContext(ctx).Save(scheduleToModel(schedule)).Error; err != nil {
+		return fmt.Errorf("failed to save schedule to MySQL: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStateManager) GetSchedule(ctx context.Context, scheduleID string) (*pkg.Schedule, error) {
+	var scheduleModel models.ScheduleModel
+	err := s.db.WithContext(ctx).First(&scheduleModel, "id = ?", scheduleID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("schedule not found: %s", scheduleID)
+		}
+		return nil, fmt.Errorf("failed to get schedule from MySQL: %w", err)
+	}
+
+	return s.modelToSchedule(&scheduleModel), nil
+}
+
+// UpdateSchedule locks the schedule row for the transaction, so concurrent
+// updates of the same schedule apply one after another.
+func (s *MySQLStateManager) UpdateSchedule(ctx context.Context, scheduleID string, update func(*pkg.Schedule) error) (*pkg.Schedule, error) {
+	var schedule *pkg.Schedule
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var scheduleModel models.ScheduleModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&scheduleModel, "id = ?", scheduleID).Error
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("schedule not found: %s", scheduleID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get schedule from MySQL: %w", err)
+		}
+
+		schedule = s.modelToSchedule(&scheduleModel)
+		if err := update(schedule); err != nil {
+			return err
+		}
+		if err := tx.Save(scheduleToModel(schedule)).Error; err != nil {
+			return fmt.Errorf("failed to save schedule to MySQL: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s *MySQLStateManager) ListSchedules(ctx context.Context) ([]*pkg.Schedule, error) {
+	var scheduleModels []models.ScheduleModel
+	if err := s.db.WithContext(ctx).Order("created_at").Find(&scheduleModels).Error; err != nil {
+		return nil, fmt.Errorf("failed to list schedules from MySQL: %w", err)
+	}
+
+	schedules := make([]*pkg.Schedule, len(scheduleModels))
+	for i, scheduleModel := range scheduleModels {
+		schedules[i] = s.modelToSchedule(&scheduleModel)
+	}
+
+	return schedules, nil
+}
+
+func (s *MySQLStateManager) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	result := s.db.WithContext(ctx).Delete(&models.ScheduleModel{}, "id = ?", scheduleID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete schedule from MySQL: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("schedule not found: %s", scheduleID)
+	}
+	return nil
+}
+
+func scheduleToModel(schedule *pkg.Schedule) *models.ScheduleModel {
+	inputJSON, _ := json.Marshal(schedule.InputTemplate)
+	bufferedJSON, _ := json.Marshal(schedule.BufferedRuns)
+
+	return &models.ScheduleModel{
+		ID:             schedule.ID,
+		WorkflowName:   schedule.WorkflowName,
+		CronExpr:       schedule.CronExpr,
+		IntervalMs:     schedule.Interval.Milliseconds(),
+		Timezone:       schedule.Timezone,
+		InputTemplate:  string(inputJSON),
+		OverlapPolicy:  string(schedule.OverlapPolicy),
+		JitterMs:       schedule.Jitter.Milliseconds(),
+		Paused:         schedule.Paused,
+		NextRunAt:      schedule.NextRunAt,
+		LastRunAt:      schedule.LastRunAt,
+		LastWorkflowID: schedule.LastWorkflowID,
+		BufferedRuns:   string(bufferedJSON),
+		CreatedAt:      schedule.CreatedAt,
+		UpdatedAt:      schedule.UpdatedAt,
+	}
+}
+
+func (s *MySQLStateManager) modelToSchedule(model *models.ScheduleModel) *pkg.Schedule {
+	var inputTemplate map[string]interface{}
+	json.Unmarshal([]byte(model.InputTemplate), &inputTemplate)
+
+	var bufferedRuns []time.Time
+	json.Unmarshal([]byte(model.BufferedRuns), &bufferedRuns)
+
+	return &pkg.Schedule{
+		ID:             model.ID,
+		WorkflowName:   model.WorkflowName,
+		CronExpr:       model.CronExpr,
+		Interval:       time.Duration(model.IntervalMs) * time.Millisecond,
+		Timezone:       model.Timezone,
+		InputTemplate:  inputTemplate,
+		OverlapPolicy:  pkg.OverlapPolicy(model.OverlapPolicy),
+		Jitter:         time.Duration(model.JitterMs) * time.Millisecond,
+		Paused:         model.Paused,
+		NextRunAt:      model.NextRunAt,
+		LastRunAt:      model.LastRunAt,
+		LastWorkflowID: model.LastWorkflowID,
+		BufferedRuns:   bufferedRuns,
+		CreatedAt:      model.CreatedAt,
+		UpdatedAt:      model.UpdatedAt,
+	}
+}
+
+// AcquireConcurrencySlot locks the key's row in concurrency_keys, creating it
+// on first use, so concurrent engines count and insert one at a time. Locking
+// that single row instead of the possibly empty range of slot rows avoids the
+// gap locks on which concurrent first acquisitions deadlock.
+func (s *MySQLStateManager) AcquireConcurrencySlot(ctx context.Context, key, workflowID string, limit int) (bool, error) {
+	acquired := false
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		keyLock := &models.ConcurrencyKeyModel{SlotKey: key}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(keyLock).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(keyLock, "slot_key = ?", key).Error; err != nil {
+			return err
+		}
+
+		var slots []models.ConcurrencySlotModel
+		if err := tx.Where("slot_key = ?", key).Find(&slots).Error; err != nil {
+			return err
+		}
+
+		if len(slots) >= limit {
+			return nil
+		}
+		for _, slot := range slots {
+			if slot.WorkflowID == workflowID {
+				return nil
+			}
+		}
+
+		acquired = true
+		return tx.Create(&models.ConcurrencySlotModel{
+			SlotKey:    key,
+			WorkflowID: workflowID,
+			CreatedAt:  time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire concurrency slot in MySQL: %w", err)
+	}
+
+	return acquired, nil
+}
+
+func (s *MySQLStateManager) ReleaseConcurrencySlot(ctx context.Context, key, workflowID string) error {
+	err := s.db.WithContext(ctx).
+		Where("slot_key = ? AND workflow_id = ?", key, workflowID).
+		Delete(&models.ConcurrencySlotModel{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release concurrency slot in MySQL: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStateManager) AppendTaskLog(ctx context.Context, entry *pkg.TaskLogEntry) error {
+	model := &models.TaskLogModel{
+		TaskID:     entry.TaskID,
+		WorkflowID: entry.WorkflowID,
+		Attempt:    entry.Attempt,
+		Level:      entry.Level,
+		Message:    entry.Message,
+		CreatedAt:  entry.CreatedAt,
+	}
+
+	if err := s.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to append task log to MySQL: %w", err)
+	}
+
+	entry.Seq = model.ID
+	return nil
+}
+
+func (s *MySQLStateManager) GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*pkg.TaskLogEntry, error) {
+	var logModels []models.TaskLogModel
+	err := s.db.WithContext(ctx).
+		Where("task_id = ? AND id > ?", taskID, afterSeq).
+		Order("id").
+		Limit(limit).
+		Find(&logModels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task logs from MySQL: %w", err)
+	}
+
+	entries := make([]*pkg.TaskLogEntry, len(logModels))
+	for i, model := range logModels {
+		entries[i] = &pkg.TaskLogEntry{
+			Seq:        model.ID,
+			TaskID:     model.TaskID,
+			WorkflowID: model.WorkflowID,
+			Attempt:    model.Attempt,
+			Level:      model.Level,
+			Message:    model.Message,
+			CreatedAt:  model.CreatedAt,
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *MySQLStateManager) SaveWebhookDelivery(ctx context.Context, delivery *pkg.WebhookDelivery) error {
+	model := &models.WebhookDeliveryModel{
+		ID:             delivery.ID,
+		WorkflowID:     delivery.WorkflowID,
+		TaskID:         delivery.TaskID,
+		URL:            delivery.URL,
+		Event:          string(delivery.Event),
+		Payload:        string(delivery.Payload),
+		State:          string(delivery.State),
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		Error:          delivery.Error,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		DeliveredAt:    delivery.DeliveredAt,
+		RedeliveryOf:   delivery.RedeliveryOf,
+		CreatedAt:      delivery.CreatedAt,
+	}
+
+	if err := s.db.WithContext(ctx).Save(model).Error; err != nil {
+		return fmt.Errorf("failed to save webhook delivery to MySQL: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStateManager) GetWebhookDelivery(ctx context.Context, deliveryID string) (*pkg.WebhookDelivery, error) {
+	var model models.WebhookDeliveryModel
+	err := s.db.WithContext(ctx).First(&model, "id = ?", deliveryID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("webhook delivery not found: %s", deliveryID)
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery from MySQL: %w", err)
+	}
+
+	return modelToWebhookDelivery(&model), nil
+}
+
+func (s *MySQLStateManager) ListWebhookDeliveries(ctx context.Context, workflowID string) ([]*pkg.WebhookDelivery, error) {
+	var deliveryModels []models.WebhookDeliveryModel
+	err := s.db.WithContext(ctx).
+		Where("workflow_id = ?", workflowID).
+		Order("created_at").
+		Find(&deliveryModels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries from MySQL: %w", err)
+	}
+
+	deliveries := make([]*pkg.WebhookDelivery, len(deliveryModels))
+	for i, model := range deliveryModels {
+		deliveries[i] = modelToWebhookDelivery(&model)
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries moves each due delivery's next attempt only if it
+// is unchanged since it was read, so concurrent engines claim disjoint
+// deliveries.
+func (s *MySQLStateManager) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*pkg.WebhookDelivery, error) {
+	var dueModels []models.WebhookDeliveryModel
+	err := s.db.WithContext(ctx).
+		Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&dueModels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due webhook deliveries in MySQL: %w", err)
+	}
+
+	leaseUntil := now.Add(lease)
+	deliveries := make([]*pkg.WebhookDelivery, 0, len(dueModels))
+	for _, model := range dueModels {
+		result := s.db.WithContext(ctx).
+			Model(&models.WebhookDeliveryModel{}).
+			Where("id = ? AND next_attempt_at = ?", model.ID, model.NextAttemptAt).
+			Update("next_attempt_at", leaseUntil)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to claim webhook delivery in MySQL: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			deliveries = append(deliveries, modelToWebhookDelivery(&model))
+		}
+	}
+
+	return deliveries, nil
+}
+
+func modelToWebhookDelivery(model *models.WebhookDeliveryModel) *pkg.WebhookDelivery {
+	return &pkg.WebhookDelivery{
+		ID:             model.ID,
+		WorkflowID:     model.WorkflowID,
+		TaskID:         model.TaskID,
+		URL:            model.URL,
+		Event:          pkg.EventType(model.Event),
+		Payload:        json.RawMessage(model.Payload),
+		State:          pkg.WebhookDeliveryState(model.State),
+		Attempts:       model.Attempts,
+		ResponseStatus: model.ResponseStatus,
+		Error:          model.Error,
+		NextAttemptAt:  model.NextAttemptAt,
+		DeliveredAt:    model.DeliveredAt,
+		RedeliveryOf:   model.RedeliveryOf,
+		CreatedAt:      model.CreatedAt,
+	}
+}
+
+// SaveBackfill deletes the backfills not updated for pkg.BackfillRetention
+// whenever a backfill finishes, so the table only holds recent ones.
+func (s *MySQLStateManager) SaveBackfill(ctx context.Context, backfill *pkg.Backfill) error {
+	workflowIDsJSON, _ := json.Marshal(backfill.WorkflowIDs)
+
+	backfillModel := &models.BackfillModel{
+		ID:           backfill.ID,
+		ScheduleID:   backfill.ScheduleID,
+		WorkflowName: backfill.WorkflowName,
+		Start:        backfill.Start,
+		End:          backfill.End,
+		State:        string(backfill.State),
+		TotalRuns:    backfill.TotalRuns,
+		WorkflowIDs:  string(workflowIDsJSON),
+		Error:        backfill.Error,
+		CreatedAt:    backfill.CreatedAt,
+		UpdatedAt:    backfill.UpdatedAt,
+		EndedAt:      backfill.EndedAt,
+	}
+
+	if err := s.db.WithContext(ctx).Save(backfillModel).Error; err != nil {
+		return fmt.Errorf("failed to save backfill to MySQL: %w", err)
+	}
+
+	if backfill.State != pkg.BackfillStateRunning {
+		cutoff := time.Now().Add(-pkg.BackfillRetention)
+		if err := s.db.WithContext(ctx).Where("updated_at < ?", cutoff).Delete(&models.BackfillModel{}).Error; err != nil {
+			s.logger.Warn("Failed to prune backfills", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+func (s *MySQLStateManager) GetBackfill(ctx context.Context, backfillID string) (*pkg.Backfill, error) {
+	var backfillModel models.BackfillModel
+	err := s.db.WithContext(ctx).First(&backfillModel, "id = ?", backfillID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("backfill not found: %s", backfillID)
+		}
+		return nil, fmt.Errorf("failed to get backfill from MySQL: %w", err)
+	}
+	if backfillModel.UpdatedAt.Before(time.Now().Add(-pkg.BackfillRetention)) {
+		return nil, fmt.Errorf("backfill not found: %s", backfillID)
+	}
+
+	var workflowIDs []string
+	json.Unmarshal([]byte(backfillModel.WorkflowIDs), &workflowIDs)
+
+	return &pkg.Backfill{
+		ID:           backfillModel.ID,
+		ScheduleID:   backfillModel.ScheduleID,
+		WorkflowName: backfillModel.WorkflowName,
+		Start:        backfillModel.Start,
+		End:          backfillModel.End,
+		State:        pkg.BackfillState(backfillModel.State),
+		TotalRuns:    backfillModel.TotalRuns,
+		WorkflowIDs:  workflowIDs,
+		Error:        backfillModel.Error,
+		CreatedAt:    backfillModel.CreatedAt,
+		UpdatedAt:    backfillModel.UpdatedAt,
+		EndedAt:      backfillModel.EndedAt,
+	}, nil
+}
@@ -3,7 +3,9 @@ package state
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 
@@ -11,9 +13,20 @@ import (
 )
 
 const (
-	WorkflowPrefix  = "temjob:workflow:"
-	TaskPrefix      = "temjob:task:"
-	WorkflowListKey = "temjob:workflows"
+	WorkflowPrefix     = "temjob:workflow:"
+	TaskPrefix         = "temjob:task:"
+	WorkflowListKey    = "temjob:workflows"
+	SignalPrefix       = "temjob:signals:"
+	SignalNamesPrefix  = "temjob:signalnames:"
+	ScheduleKey        = "temjob:schedules"
+	ConcurrencyPrefix  = "temjob:concurrency:"
+	HistoryPrefix      = "temjob:history:"
+	TaskLogPrefix      = "temjob:tasklogs:"
+	EventChannelPrefix = "temjob:events:"
+	WebhookPrefix      = "temjob:webhook:"
+	WebhookListPrefix  = "temjob:webhooks:"
+	WebhookDueKey      = "temjob:webhooks:due"
+	BackfillPrefix     = "temjob:backfill:"
 )
 
 type RedisStateManager struct {
@@ -47,6 +60,137 @@ func (s *RedisStateManager) SaveWorkflow(ctx context.Context, workflow *pkg.Work
 	return nil
 }
 
+// CreateWorkflow watches the workflow key so the policy check and the write
+// happen atomically; a concurrent writer aborts the transaction and the check
+// is repeated against the new state.
+func (s *RedisStateManager) CreateWorkflow(ctx context.Context, workflow *pkg.Workflow, policy pkg.WorkflowIDReusePolicy) error {
+	data, err := json.Marshal(workflow)
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow: %w", err)
+	}
+
+	key := WorkflowPrefix + workflow.ID
+	create := func(tx *redis.Tx) error {
+		existing, err := tx.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		// Keys of the previous run, so the new one starts without its
+		// tasks, history or undelivered signals
+		var stale []string
+		if err == nil {
+			var current pkg.Workflow
+			if err := json.Unmarshal([]byte(existing), &current); err != nil {
+				return fmt.Errorf("failed to unmarshal workflow: %w", err)
+			}
+			if !policy.Allows(current.State) {
+				return fmt.Errorf("%w: %s is %s", pkg.ErrWorkflowExists, workflow.ID, current.State)
+			}
+
+			if stale, err = s.runKeys(ctx, tx, &current); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(stale) > 0 {
+				pipe.Del(ctx, stale...)
+			}
+			pipe.Set(ctx, key, data, 0)
+			pipe.ZAdd(ctx, WorkflowListKey, &redis.Z{
+				Score:  float64(workflow.CreatedAt.Unix()),
+				Member: workflow.ID,
+			})
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		err = s.client.Watch(ctx, create, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, pkg.ErrWorkflowExists) {
+			return err
+		}
+		return fmt.Errorf("failed to create workflow: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateWorkflow watches the workflow key like CreateWorkflow, so update
+// is applied again to the new state when a concurrent write lands first.
+func (s *RedisStateManager) UpdateWorkflow(ctx context.Context, workflowID string, update func(*pkg.Workflow) error) (*pkg.Workflow, error) {
+	key := WorkflowPrefix + workflowID
+	var workflow *pkg.Workflow
+
+	apply := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return fmt.Errorf("workflow not found: %s", workflowID)
+		}
+		if err != nil {
+			return err
+		}
+
+		workflow = &pkg.Workflow{}
+		if err := json.Unmarshal([]byte(data), workflow); err != nil {
+			return fmt.Errorf("failed to unmarshal workflow: %w", err)
+		}
+		if err := update(workflow); err != nil {
+			return err
+		}
+
+		updated, err := json.Marshal(workflow)
+		if err != nil {
+			return fmt.Errorf("failed to marshal workflow: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updated, 0)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < 10; i++ {
+		err = s.client.Watch(ctx, apply, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return workflow, nil
+}
+
+// runKeys lists the keys holding a workflow run's tasks, task logs, history
+// and pending signals.
+func (s *RedisStateManager) runKeys(ctx context.Context, tx *redis.Tx, workflow *pkg.Workflow) ([]string, error) {
+	keys := []string{HistoryPrefix + workflow.ID}
+	for _, taskID := range workflow.Tasks {
+		keys = append(keys, TaskPrefix+taskID, TaskLogPrefix+taskID)
+	}
+
+	signalNames, err := tx.SMembers(ctx, SignalNamesPrefix+workflow.ID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workflow signals: %w", err)
+	}
+	for _, signalName := range signalNames {
+		keys = append(keys, signalKey(workflow.ID, signalName))
+	}
+	keys = append(keys, SignalNamesPrefix+workflow.ID)
+
+	return keys, nil
+}
+
 func (s *RedisStateManager) GetWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
 	data, err := s.client.Get(ctx, WorkflowPrefix+workflowID).Result()
 	if err != nil {
@@ -154,3 +298,394 @@ func (s *RedisStateManager) GetWorkflowStats(ctx context.Context) (map[string]in
 
 	return stats, nil
 }
+
+func signalKey(workflowID, signalName string) string {
+	return SignalPrefix + workflowID + ":" + signalName
+}
+
+func (s *RedisStateManager) SaveSignal(ctx context.Context, signal *pkg.Signal) error {
+	data, err := json.Marshal(signal)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signal: %w", err)
+	}
+
+	// The name set lets a reused workflow ID drop the signals left for its
+	// previous run
+	pipe := s.client.TxPipeline()
+	pipe.RPush(ctx, signalKey(signal.WorkflowID, signal.Name), data)
+	pipe.SAdd(ctx, SignalNamesPrefix+signal.WorkflowID, signal.Name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save signal: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisStateManager) ConsumeSignal(ctx context.Context, workflowID, signalName string) (*pkg.Signal, error) {
+	data, err := s.client.LPop(ctx, signalKey(workflowID, signalName)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to consume signal: %w", err)
+	}
+
+	var signal pkg.Signal
+	if err := json.Unmarshal([]byte(data), &signal); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signal: %w", err)
+	}
+
+	return &signal, nil
+}
+
+func (s *RedisStateManager) SaveSchedule(ctx context.Context, schedule *pkg.Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	if err := s.client.HSet(ctx, ScheduleKey, schedule.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to save schedule: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisStateManager) GetSchedule(ctx context.Context, scheduleID string) (*pkg.Schedule, error) {
+	data, err := s.client.HGet(ctx, ScheduleKey, scheduleID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("schedule not found: %s", scheduleID)
+		}
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	var schedule pkg.Schedule
+	if err := json.Unmarshal([]byte(data), &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// UpdateSchedule watches the schedule hash, so update is applied again to
+// the new state when a concurrent write to any schedule lands first.
+func (s *RedisStateManager) UpdateSchedule(ctx context.Context, scheduleID string, update func(*pkg.Schedule) error) (*pkg.Schedule, error) {
+	var schedule *pkg.Schedule
+
+	apply := func(tx *redis.Tx) error {
+		data, err := tx.HGet(ctx, ScheduleKey, scheduleID).Result()
+		if err == redis.Nil {
+			return fmt.Errorf("schedule not found: %s", scheduleID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get schedule: %w", err)
+		}
+
+		schedule = &pkg.Schedule{}
+		if err := json.Unmarshal([]byte(data), schedule); err != nil {
+			return fmt.Errorf("failed to unmarshal schedule: %w", err)
+		}
+		if err := update(schedule); err != nil {
+			return err
+		}
+
+		updated, err := json.Marshal(schedule)
+		if err != nil {
+			return fmt.Errorf("failed to marshal schedule: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, ScheduleKey, scheduleID, updated)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < 10; i++ {
+		err = s.client.Watch(ctx, apply, ScheduleKey)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s *RedisStateManager) ListSchedules(ctx context.Context) ([]*pkg.Schedule, error) {
+	values, err := s.client.HVals(ctx, ScheduleKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	schedules := make([]*pkg.Schedule, 0, len(values))
+	for _, data := range values {
+		var schedule pkg.Schedule
+		if err := json.Unmarshal([]byte(data), &schedule); err != nil {
+			continue
+		}
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, nil
+}
+
+func (s *RedisStateManager) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	deleted, err := s.client.HDel(ctx, ScheduleKey, scheduleID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("schedule not found: %s", scheduleID)
+	}
+	return nil
+}
+
+// acquireSlotScript adds ARGV[1] to the slot set KEYS[1] if it holds fewer
+// than ARGV[2] members, returning 1 only when the member was newly added.
+var acquireSlotScript = redis.NewScript(`
+if redis.call("SISMEMBER", KEYS[1], ARGV[1]) == 1 then
+	return 0
+end
+if redis.call("SCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("SADD", KEYS[1], ARGV[1])
+return 1
+`)
+
+func (s *RedisStateManager) AcquireConcurrencySlot(ctx context.Context, key, workflowID string, limit int) (bool, error) {
+	acquired, err := acquireSlotScript.Run(ctx, s.client, []string{ConcurrencyPrefix + key}, workflowID, limit).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire concurrency slot: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+func (s *RedisStateManager) ReleaseConcurrencySlot(ctx context.Context, key, workflowID string) error {
+	if err := s.client.SRem(ctx, ConcurrencyPrefix+key, workflowID).Err(); err != nil {
+		return fmt.Errorf("failed to release concurrency slot: %w", err)
+	}
+	return nil
+}
+
+// AppendHistoryEvent keeps events in a list per workflow; an event's ID is
+// its position in that list.
+func (s *RedisStateManager) AppendHistoryEvent(ctx context.Context, event *pkg.HistoryEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history event: %w", err)
+	}
+
+	length, err := s.client.RPush(ctx, HistoryPrefix+event.WorkflowID, data).Result()
+	if err != nil {
+		return fmt.Errorf("failed to append history event: %w", err)
+	}
+
+	event.ID = length
+	return nil
+}
+
+func (s *RedisStateManager) GetWorkflowHistory(ctx context.Context, workflowID string) ([]*pkg.HistoryEvent, error) {
+	values, err := s.client.LRange(ctx, HistoryPrefix+workflowID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow history: %w", err)
+	}
+
+	events := make([]*pkg.HistoryEvent, 0, len(values))
+	for i, data := range values {
+		var event pkg.HistoryEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal history event: %w", err)
+		}
+		event.ID = int64(i + 1)
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+func (s *RedisStateManager) PublishEvent(ctx context.Context, event *pkg.HistoryEvent) error {
+	return publishEvent(ctx, s.client, event)
+}
+
+func (s *RedisStateManager) SubscribeEvents(ctx context.Context, workflowID string) (<-chan *pkg.HistoryEvent, error) {
+	return subscribeEvents(ctx, s.client, workflowID)
+}
+
+// AppendTaskLog keeps a task's lines in a list; an entry's Seq is its
+// position in that list.
+func (s *RedisStateManager) AppendTaskLog(ctx context.Context, entry *pkg.TaskLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task log: %w", err)
+	}
+
+	length, err := s.client.RPush(ctx, TaskLogPrefix+entry.TaskID, data).Result()
+	if err != nil {
+		return fmt.Errorf("failed to append task log: %w", err)
+	}
+
+	entry.Seq = length
+	return nil
+}
+
+func (s *RedisStateManager) GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*pkg.TaskLogEntry, error) {
+	values, err := s.client.LRange(ctx, TaskLogPrefix+taskID, afterSeq, afterSeq+int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task logs: %w", err)
+	}
+
+	entries := make([]*pkg.TaskLogEntry, 0, len(values))
+	for i, data := range values {
+		var entry pkg.TaskLogEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal task log: %w", err)
+		}
+		entry.Seq = afterSeq + int64(i) + 1
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+// SaveWebhookDelivery stores the delivery and keeps the due set, scored by
+// next attempt in milliseconds, in line with its NextAttemptAt.
+func (s *RedisStateManager) SaveWebhookDelivery(ctx context.Context, delivery *pkg.WebhookDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook delivery: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, WebhookPrefix+delivery.ID, data, 0)
+	pipe.ZAddNX(ctx, WebhookListPrefix+delivery.WorkflowID, &redis.Z{
+		Score:  float64(delivery.CreatedAt.UnixNano()),
+		Member: delivery.ID,
+	})
+	if delivery.NextAttemptAt != nil {
+		pipe.ZAdd(ctx, WebhookDueKey, &redis.Z{
+			Score:  float64(delivery.NextAttemptAt.UnixMilli()),
+			Member: delivery.ID,
+		})
+	} else {
+		pipe.ZRem(ctx, WebhookDueKey, delivery.ID)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStateManager) GetWebhookDelivery(ctx context.Context, deliveryID string) (*pkg.WebhookDelivery, error) {
+	data, err := s.client.Get(ctx, WebhookPrefix+deliveryID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("webhook delivery not found: %s", deliveryID)
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+
+	var delivery pkg.WebhookDelivery
+	if err := json.Unmarshal([]byte(data), &delivery); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook delivery: %w", err)
+	}
+
+	return &delivery, nil
+}
+
+func (s *RedisStateManager) ListWebhookDeliveries(ctx context.Context, workflowID string) ([]*pkg.WebhookDelivery, error) {
+	deliveryIDs, err := s.client.ZRange(ctx, WebhookListPrefix+workflowID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	return s.getWebhookDeliveries(ctx, deliveryIDs)
+}
+
+// claimWebhooksScript pushes the next attempt of up to ARGV[3] deliveries
+// due at ARGV[1] back to ARGV[2] and returns their IDs.
+var claimWebhooksScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, tonumber(ARGV[3]))
+for _, id in ipairs(ids) do
+	redis.call("ZADD", KEYS[1], ARGV[2], id)
+end
+return ids
+`)
+
+func (s *RedisStateManager) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*pkg.WebhookDelivery, error) {
+	deliveryIDs, err := claimWebhooksScript.Run(ctx, s.client, []string{WebhookDueKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	return s.getWebhookDeliveries(ctx, deliveryIDs)
+}
+
+func (s *RedisStateManager) getWebhookDeliveries(ctx context.Context, deliveryIDs []string) ([]*pkg.WebhookDelivery, error) {
+	deliveries := make([]*pkg.WebhookDelivery, 0, len(deliveryIDs))
+	if len(deliveryIDs) == 0 {
+		return deliveries, nil
+	}
+
+	keys := make([]string, len(deliveryIDs))
+	for i, deliveryID := range deliveryIDs {
+		keys[i] = WebhookPrefix + deliveryID
+	}
+
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var delivery pkg.WebhookDelivery
+		if err := json.Unmarshal([]byte(data), &delivery); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return deliveries, nil
+}
+
+// SaveBackfill stores the backfill with an expiry of pkg.BackfillRetention,
+// renewed by every save.
+func (s *RedisStateManager) SaveBackfill(ctx context.Context, backfill *pkg.Backfill) error {
+	data, err := json.Marshal(backfill)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backfill: %w", err)
+	}
+
+	if err := s.client.Set(ctx, BackfillPrefix+backfill.ID, data, pkg.BackfillRetention).Err(); err != nil {
+		return fmt.Errorf("failed to save backfill: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisStateManager) GetBackfill(ctx context.Context, backfillID string) (*pkg.Backfill, error) {
+	data, err := s.client.Get(ctx, BackfillPrefix+backfillID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("backfill not found: %s", backfillID)
+		}
+		return nil, fmt.Errorf("failed to get backfill: %w", err)
+	}
+
+	var backfill pkg.Backfill
+	if err := json.Unmarshal([]byte(data), &backfill); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backfill: %w", err)
+	}
+
+	return &backfill, nil
+}
@@ -2,6 +2,8 @@ package pkg
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +18,9 @@ const (
 	TaskStateFailed    TaskState = "failed"
 	TaskStateRetrying  TaskState = "retrying"
 	TaskStateCanceled  TaskState = "canceled"
+	// TaskStateWaiting marks engine-managed steps (timers) that hold no
+	// worker slot while they wait.
+	TaskStateWaiting TaskState = "waiting"
 )
 
 type WorkflowState string
@@ -28,10 +33,132 @@ const (
 	WorkflowStateCanceled  WorkflowState = "canceled"
 )
 
+// Terminal reports whether a workflow in state s has ended.
+func (s WorkflowState) Terminal() bool {
+	return s == WorkflowStateCompleted || s == WorkflowStateFailed || s == WorkflowStateCanceled
+}
+
+// ErrWorkflowExists is returned when a caller-supplied workflow ID is already
+// taken and the reuse policy forbids starting another run under it.
+var ErrWorkflowExists = errors.New("workflow already exists")
+
+// ErrWorkflowEnded is returned when a signal is sent to a workflow that has
+// already completed, failed or been canceled.
+var ErrWorkflowEnded = errors.New("workflow already ended")
+
+// ErrQueryNotFound is returned when a workflow's definition registers no
+// query of the requested name.
+var ErrQueryNotFound = errors.New("query not found")
+
+// ErrDefinitionNotFound is returned when no workflow definition of the
+// requested name is registered.
+var ErrDefinitionNotFound = errors.New("workflow definition not found")
+
+// ErrInvalidInput is returned when a definition's ValidateInput rejects the
+// input of a submission.
+var ErrInvalidInput = errors.New("invalid workflow input")
+
+// ErrLeaseLost is returned when a worker reports on a task whose lease it no
+// longer holds, typically because the lease expired and the task was retried.
+var ErrLeaseLost = errors.New("task lease lost")
+
+// ErrConcurrencyLimit is returned when a submission exceeds its definition's
+// concurrency limit under ConcurrencyReject.
+var ErrConcurrencyLimit = errors.New("workflow concurrency limit reached")
+
+// ErrNoPendingApproval is returned when an approval decision names a step
+// that is not currently waiting for one.
+var ErrNoPendingApproval = errors.New("no pending approval")
+
+// NonRetryableError marks a task failure that retrying cannot fix, such as
+// input the handler cannot decode. The attempt fails the task outright even
+// when retries are left.
+type NonRetryableError struct {
+	Err error
+}
+
+func (e *NonRetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NonRetryableError) Unwrap() error {
+	return e.Err
+}
+
+// NonRetryable wraps err so that a task handler returning it is not retried.
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &NonRetryableError{Err: err}
+}
+
+// PanicError is the error of a task attempt whose handler panicked. Stack is
+// the stack trace of the panicking goroutine.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task handler panicked: %v\n%s", e.Value, e.Stack)
+}
+
+// IsNonRetryable reports whether err or any error it wraps is a
+// NonRetryableError.
+func IsNonRetryable(err error) bool {
+	var nonRetryable *NonRetryableError
+	return errors.As(err, &nonRetryable)
+}
+
+// MaxWorkflowIDLength bounds caller-supplied workflow IDs.
+const MaxWorkflowIDLength = 128
+
+// WorkflowIDReusePolicy decides whether a caller-supplied workflow ID may be
+// used again once a workflow with that ID exists.
+type WorkflowIDReusePolicy string
+
+const (
+	// WorkflowIDReuseRejectDuplicate never reuses an ID. It is the default.
+	WorkflowIDReuseRejectDuplicate WorkflowIDReusePolicy = "reject_duplicate"
+	// WorkflowIDReuseAllowFailed reuses an ID only after the previous run
+	// failed or was canceled.
+	WorkflowIDReuseAllowFailed WorkflowIDReusePolicy = "allow_failed"
+	// WorkflowIDReuseRejectRunning reuses an ID once the previous run has
+	// ended in any state.
+	WorkflowIDReuseRejectRunning WorkflowIDReusePolicy = "reject_running"
+)
+
+// Allows reports whether a new run may replace an existing workflow in state.
+func (p WorkflowIDReusePolicy) Allows(state WorkflowState) bool {
+	switch p {
+	case WorkflowIDReuseAllowFailed:
+		return state == WorkflowStateFailed || state == WorkflowStateCanceled
+	case WorkflowIDReuseRejectRunning:
+		return state != WorkflowStatePending && state != WorkflowStateRunning
+	default:
+		return false
+	}
+}
+
+// SubmitOptions customizes a workflow submission. With an empty WorkflowID a
+// fresh one is generated and IDReusePolicy is ignored.
+type SubmitOptions struct {
+	WorkflowID    string                `json:"workflow_id,omitempty"`
+	IDReusePolicy WorkflowIDReusePolicy `json:"id_reuse_policy,omitempty"`
+	// Priority above zero puts the workflow's tasks ahead of every task
+	// already waiting in the queue.
+	Priority int `json:"priority,omitempty"`
+	// Webhooks are notified of this run's events in addition to those of
+	// its definition.
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+}
+
 type Task struct {
 	ID          string                 `json:"id"`
 	WorkflowID  string                 `json:"workflow_id"`
 	Type        string                 `json:"type"`
+	Kind        StepKind               `json:"kind,omitempty"`
 	Input       map[string]interface{} `json:"input"`
 	Output      map[string]interface{} `json:"output,omitempty"`
 	State       TaskState              `json:"state"`
@@ -42,6 +169,36 @@ type Task struct {
 	StartedAt   *time.Time             `json:"started_at,omitempty"`
 	CompletedAt *time.Time             `json:"completed_at,omitempty"`
 	WorkerID    string                 `json:"worker_id,omitempty"`
+	WakeAt      *time.Time             `json:"wake_at,omitempty"`
+	Approval    *ApprovalDecision      `json:"approval,omitempty"`
+	Attempts    []TaskAttempt          `json:"attempts,omitempty"`
+	Priority    int                    `json:"priority,omitempty"`
+	Progress    *TaskProgress          `json:"progress,omitempty"`
+}
+
+// TaskProgress is the last progress a task's handler reported. It is kept
+// across retries, so a retried task shows how far its previous attempt got
+// until the new attempt reports. Percent is 0 to 100; Current and Total are
+// optional counts of work items.
+type TaskProgress struct {
+	Percent   float64   `json:"percent"`
+	Current   int64     `json:"current,omitempty"`
+	Total     int64     `json:"total,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Attempt   int       `json:"attempt"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TaskAttempt records one finished execution of a task, kept when a retry
+// overwrites the task's own worker, timing and error fields.
+type TaskAttempt struct {
+	Attempt   int                    `json:"attempt"`
+	WorkerID  string                 `json:"worker_id,omitempty"`
+	State     TaskState              `json:"state"`
+	StartedAt *time.Time             `json:"started_at,omitempty"`
+	EndedAt   *time.Time             `json:"ended_at,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Output    map[string]interface{} `json:"output,omitempty"`
 }
 
 type Workflow struct {
@@ -50,49 +207,443 @@ type Workflow struct {
 	Input     map[string]interface{} `json:"input"`
 	Output    map[string]interface{} `json:"output,omitempty"`
 	State     WorkflowState          `json:"state"`
+	Error     string                 `json:"error,omitempty"`
 	Tasks     []string               `json:"tasks"`
 	CreatedAt time.Time              `json:"created_at"`
 	StartedAt *time.Time             `json:"started_at,omitempty"`
 	EndedAt   *time.Time             `json:"ended_at,omitempty"`
+	// ConcurrencyKey is the evaluated concurrency key of a definition with a
+	// concurrency limit; WaitingReason explains why a pending workflow has
+	// not started yet.
+	ConcurrencyKey string    `json:"concurrency_key,omitempty"`
+	WaitingReason  string    `json:"waiting_reason,omitempty"`
+	Priority       int       `json:"priority,omitempty"`
+	Webhooks       []Webhook `json:"webhooks,omitempty"`
+}
+
+// EventType classifies an entry of a workflow's history.
+type EventType string
+
+const (
+	EventWorkflowSubmitted EventType = "workflow_submitted"
+	EventWorkflowStarted   EventType = "workflow_started"
+	EventWorkflowResumed   EventType = "workflow_resumed"
+	EventWorkflowCompleted EventType = "workflow_completed"
+	EventWorkflowFailed    EventType = "workflow_failed"
+	EventWorkflowCanceled  EventType = "workflow_canceled"
+	EventTaskScheduled     EventType = "task_scheduled"
+	EventTaskStarted       EventType = "task_started"
+	EventTaskCompleted     EventType = "task_completed"
+	EventAttemptFailed     EventType = "attempt_failed"
+	EventRetryScheduled    EventType = "retry_scheduled"
+	EventTaskFailed        EventType = "task_failed"
+	EventTimerFired        EventType = "timer_fired"
+	EventSignalReceived    EventType = "signal_received"
+	// EventTaskProgress is published to live subscribers when a handler
+	// reports progress. It is not kept in the history.
+	EventTaskProgress EventType = "task_progress"
+)
+
+// HistoryEvent is one entry of a workflow's append-only history.
+type HistoryEvent struct {
+	ID         int64                  `json:"id"`
+	WorkflowID string                 `json:"workflow_id"`
+	TaskID     string                 `json:"task_id,omitempty"`
+	Type       EventType              `json:"type"`
+	Level      string                 `json:"level"`
+	Message    string                 `json:"message"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// TaskLogEntry is a line logged by a task handler. Seq orders the lines of
+// a task and serves as the pagination cursor.
+type TaskLogEntry struct {
+	Seq        int64     `json:"seq"`
+	TaskID     string    `json:"task_id"`
+	WorkflowID string    `json:"workflow_id"`
+	Attempt    int       `json:"attempt"`
+	Level      string    `json:"level"`
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TaskLogger writes log lines tied to the task attempt a handler runs for.
+// Handlers get it with TaskLoggerFromContext.
+type TaskLogger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type taskLoggerKey struct{}
+
+// WithTaskLogger returns a context carrying logger for the handler it is
+// passed to.
+func WithTaskLogger(ctx context.Context, logger TaskLogger) context.Context {
+	return context.WithValue(ctx, taskLoggerKey{}, logger)
+}
+
+// TaskLoggerFromContext returns the task logger of a handler's context, or
+// a logger that discards everything outside a task.
+func TaskLoggerFromContext(ctx context.Context) TaskLogger {
+	if logger, ok := ctx.Value(taskLoggerKey{}).(TaskLogger); ok {
+		return logger
+	}
+	return nopTaskLogger{}
+}
+
+// TaskInfo describes the task attempt a handler runs for. Attempt counts
+// from 1 and MaxAttempts is the task's retries plus one. ScheduledAt is when
+// the task was created and StartedAt when this attempt was handed to the
+// worker. Deadline is when the attempt's context is canceled.
+type TaskInfo struct {
+	TaskID      string    `json:"task_id"`
+	WorkflowID  string    `json:"workflow_id"`
+	TaskType    string    `json:"task_type"`
+	Attempt     int       `json:"attempt"`
+	MaxAttempts int       `json:"max_attempts"`
+	WorkerID    string    `json:"worker_id"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at"`
+	Deadline    time.Time `json:"deadline"`
+}
+
+type taskInfoKey struct{}
+
+// WithTaskInfo returns a context carrying info for the handler it is passed
+// to.
+func WithTaskInfo(ctx context.Context, info TaskInfo) context.Context {
+	return context.WithValue(ctx, taskInfoKey{}, info)
+}
+
+// TaskInfoFromContext returns the task info of a handler's context. It
+// reports false outside a task.
+func TaskInfoFromContext(ctx context.Context) (TaskInfo, bool) {
+	info, ok := ctx.Value(taskInfoKey{}).(TaskInfo)
+	return info, ok
+}
+
+// ProgressFunc reports the progress of the task a handler runs for. Handlers
+// get it with ProgressFromContext.
+type ProgressFunc func(progress TaskProgress) error
+
+type progressKey struct{}
+
+// WithProgress returns a context carrying report for the handler it is
+// passed to.
+func WithProgress(ctx context.Context, report ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
 }
 
+// ProgressFromContext returns the progress reporter of a handler's context,
+// or one that discards progress outside a task.
+func ProgressFromContext(ctx context.Context) ProgressFunc {
+	if report, ok := ctx.Value(progressKey{}).(ProgressFunc); ok {
+		return report
+	}
+	return func(TaskProgress) error { return nil }
+}
+
+type nopTaskLogger struct{}
+
+func (nopTaskLogger) Debugf(string, ...interface{}) {}
+func (nopTaskLogger) Infof(string, ...interface{})  {}
+func (nopTaskLogger) Warnf(string, ...interface{})  {}
+func (nopTaskLogger) Errorf(string, ...interface{}) {}
+
+// Signal is an external event delivered to a running workflow. Signals sent
+// before the workflow reaches the matching step are buffered until consumed.
+type Signal struct {
+	ID         string                 `json:"id"`
+	WorkflowID string                 `json:"workflow_id"`
+	Name       string                 `json:"name"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops a tick while the previous run is still active.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapBuffer queues ticks and starts them one by one as runs finish.
+	OverlapBuffer OverlapPolicy = "buffer"
+	// OverlapAllow starts every tick regardless of active runs.
+	OverlapAllow OverlapPolicy = "allow"
+)
+
+// Schedule submits WorkflowName on a cron expression (evaluated in Timezone)
+// or a fixed Interval. String values in InputTemplate are rendered as Go
+// templates with .ScheduledTime, .ScheduleID and .WorkflowName; the logical
+// run time is also injected as "scheduled_time".
+type Schedule struct {
+	ID             string                 `json:"id"`
+	WorkflowName   string                 `json:"workflow_name"`
+	CronExpr       string                 `json:"cron_expr,omitempty"`
+	Interval       time.Duration          `json:"interval,omitempty"`
+	Timezone       string                 `json:"timezone,omitempty"`
+	InputTemplate  map[string]interface{} `json:"input_template,omitempty"`
+	OverlapPolicy  OverlapPolicy          `json:"overlap_policy"`
+	Jitter         time.Duration          `json:"jitter,omitempty"`
+	Paused         bool                   `json:"paused"`
+	NextRunAt      *time.Time             `json:"next_run_at,omitempty"`
+	LastRunAt      *time.Time             `json:"last_run_at,omitempty"`
+	LastWorkflowID string                 `json:"last_workflow_id,omitempty"`
+	BufferedRuns   []time.Time            `json:"buffered_runs,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+}
+
+// BackfillRequest replays the ticks of ScheduleID, or of an ad hoc
+// WorkflowName/CronExpr/Interval spec, in the range [Start, End). At most
+// MaxConcurrent backfilled workflows run at once; zero means no cap.
+type BackfillRequest struct {
+	ScheduleID    string                 `json:"schedule_id,omitempty"`
+	WorkflowName  string                 `json:"workflow_name,omitempty"`
+	CronExpr      string                 `json:"cron_expr,omitempty"`
+	Interval      time.Duration          `json:"interval,omitempty"`
+	Timezone      string                 `json:"timezone,omitempty"`
+	InputTemplate map[string]interface{} `json:"input_template,omitempty"`
+	Start         time.Time              `json:"start"`
+	End           time.Time              `json:"end"`
+	MaxConcurrent int                    `json:"max_concurrent,omitempty"`
+}
+
+type BackfillState string
+
+const (
+	BackfillStateRunning   BackfillState = "running"
+	BackfillStateCompleted BackfillState = "completed"
+	BackfillStateFailed    BackfillState = "failed"
+)
+
+// Backfill reports the progress of a backfill operation.
+type Backfill struct {
+	ID           string        `json:"id"`
+	ScheduleID   string        `json:"schedule_id,omitempty"`
+	WorkflowName string        `json:"workflow_name"`
+	Start        time.Time     `json:"start"`
+	End          time.Time     `json:"end"`
+	State        BackfillState `json:"state"`
+	TotalRuns    int           `json:"total_runs"`
+	WorkflowIDs  []string      `json:"workflow_ids"`
+	Error        string        `json:"error,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	EndedAt      *time.Time    `json:"ended_at,omitempty"`
+}
+
+// BackfillRetention is how long a backfill record is kept after its last
+// update. A backfill whose engine stopped mid-way stops being updated and is
+// dropped like a finished one.
+const BackfillRetention = 7 * 24 * time.Hour
+
 type TaskHandler func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error)
 
+// TaskInterceptor wraps the execution of a task's handler on a worker, in the
+// manner of a gRPC interceptor. It calls next with input to continue the
+// chain, and may act before and after it, replace the context or input passed
+// on, or change the returned output and error, for instance wrapping errors
+// with NonRetryable to classify them.
+type TaskInterceptor func(ctx context.Context, task *Task, input map[string]interface{}, next TaskHandler) (map[string]interface{}, error)
+
 type WorkflowDefinition struct {
 	Name  string
 	Tasks map[string]TaskDefinition
 	Flow  []WorkflowStep
+	// ConcurrencyKey derives a key from the workflow input; at most
+	// MaxConcurrency workflows with the same key run at once. A key with
+	// MaxConcurrency 0 means mutual exclusion, and MaxConcurrency without a
+	// key limits all workflows of the definition.
+	ConcurrencyKey    func(input map[string]interface{}) string
+	MaxConcurrency    int
+	ConcurrencyPolicy ConcurrencyPolicy
+	// Queries are named read-only views over a workflow's progress.
+	Queries map[string]QueryHandler
+	// ValidateInput, when set, rejects submissions whose input the workflow
+	// cannot run with.
+	ValidateInput func(input map[string]interface{}) error
+	// Webhooks are notified of the events of every workflow of the
+	// definition.
+	Webhooks []Webhook
+}
+
+// DefinitionInfo describes a registered workflow definition to API clients.
+type DefinitionInfo struct {
+	Name    string   `json:"name"`
+	Tasks   []string `json:"tasks"`
+	Queries []string `json:"queries,omitempty"`
 }
 
+// QueryState is what a query handler sees of a workflow: the live context
+// of a run in progress, or the context rebuilt from persisted tasks.
+// Handlers receive copies and must not modify nested values.
+type QueryState struct {
+	Workflow  *Workflow
+	Context   map[string]interface{}
+	Completed []string
+	Failed    []string
+	Tasks     []*Task
+}
+
+// QueryHandler answers a named query. args carries the caller's query
+// parameters.
+type QueryHandler func(state QueryState, args map[string]interface{}) (interface{}, error)
+
+// ConcurrencyPolicy decides what happens to a submission over its
+// definition's concurrency limit.
+type ConcurrencyPolicy string
+
+const (
+	// ConcurrencyQueue keeps the workflow pending until a slot frees up. It
+	// is the default.
+	ConcurrencyQueue ConcurrencyPolicy = "queue"
+	// ConcurrencyReject fails the submission with ErrConcurrencyLimit.
+	ConcurrencyReject ConcurrencyPolicy = "reject"
+)
+
 type TaskDefinition struct {
 	Type       string
 	Handler    TaskHandler
 	MaxRetries int
+	// RateLimit caps how fast tasks of this type are handed to workers
+	// across all workers sharing the queue.
+	RateLimit *RateLimit
 }
 
+// RateLimit is a token bucket refilled at Rate tokens per second holding at
+// most Burst tokens. A Burst of 0 allows one second's worth of tokens.
+type RateLimit struct {
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+type StepKind string
+
+const (
+	StepKindTask     StepKind = "task"
+	StepKindMap      StepKind = "map"
+	StepKindTimer    StepKind = "timer"
+	StepKindSignal   StepKind = "signal"
+	StepKindApproval StepKind = "approval"
+)
+
 type WorkflowStep struct {
-	TaskType     string
-	DependsOn    []string
-	Condition    func(map[string]interface{}) bool
-	OnError      string
+	TaskType  string
+	Kind      StepKind
+	DependsOn []string
+	Condition func(map[string]interface{}) bool
+	OnError   string
+	Map       *MapConfig
+	Timer     *TimerConfig
+	Signal    *SignalConfig
+	Approval  *ApprovalConfig
+}
+
+// TimerConfig delays a timer step either for a fixed Duration or until the
+// timestamp found under UntilKey in the workflow context (RFC 3339 string,
+// time.Time or Unix seconds).
+type TimerConfig struct {
+	Duration time.Duration
+	UntilKey string
+}
+
+// SignalConfig blocks a signal step until a signal called Name is delivered
+// to the workflow. The signal payload is merged into the workflow context.
+// A zero Timeout waits indefinitely; otherwise the step fails once it expires.
+type SignalConfig struct {
+	Name    string
+	Timeout time.Duration
+}
+
+// ApprovalConfig pauses the workflow until an operator approves or rejects
+// the step. Fields selects the context keys shown to the approver; an empty
+// list shows the whole context. Rejection or an expired Timeout fails the
+// step, which routes to its OnError step when one is set.
+type ApprovalConfig struct {
+	Fields  []string
+	Timeout time.Duration
+}
+
+const (
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// ApprovalDecision is the operator's verdict recorded on an approval task.
+type ApprovalDecision struct {
+	Decision  string    `json:"decision"`
+	Approver  string    `json:"approver"`
+	Comment   string    `json:"comment,omitempty"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// ApprovalSignalName is the signal an approval step named step listens to.
+// Its payload carries the "decision", "approver" and "comment" fields.
+func ApprovalSignalName(step string) string {
+	return "approval:" + step
+}
+
+type MapFailurePolicy string
+
+const (
+	// MapFailFast stops scheduling items and fails the step on the first item failure.
+	MapFailFast MapFailurePolicy = "fail_fast"
+	// MapCollectErrors runs every item and records failures next to the results.
+	MapCollectErrors MapFailurePolicy = "collect_errors"
+)
+
+// MapConfig spawns one task per element of the list stored under ItemsKey in
+// the workflow context. Each task receives the context plus "item" and
+// "item_index"; outputs are gathered in item order under ResultKey.
+type MapConfig struct {
+	ItemsKey      string
+	ResultKey     string
+	MaxParallel   int
+	FailurePolicy MapFailurePolicy
 }
 
 type Worker interface {
 	Start(ctx context.Context) error
 	Stop() error
 	RegisterTaskHandler(taskType string, handler TaskHandler)
+	// Use appends interceptors to the chain around every handler. The
+	// first interceptor added is the outermost.
+	Use(interceptors ...TaskInterceptor)
 	GetID() string
 }
 
 type WorkflowEngine interface {
+	Scheduler
 	RegisterWorkflow(definition WorkflowDefinition)
 	SubmitWorkflow(ctx context.Context, workflowName string, input map[string]interface{}) (string, error)
+	SubmitWorkflowWithOptions(ctx context.Context, workflowName string, input map[string]interface{}, options SubmitOptions) (string, error)
 	GetWorkflow(ctx context.Context, workflowID string) (*Workflow, error)
 	CancelWorkflow(ctx context.Context, workflowID string) error
+	SignalWorkflow(ctx context.Context, workflowID, signalName string, payload map[string]interface{}) error
+	DecideApproval(ctx context.Context, workflowID, step, decision, approver, comment string) error
+	QueryWorkflow(ctx context.Context, workflowID, queryName string, args map[string]interface{}) (interface{}, error)
+	ListDefinitions() []DefinitionInfo
+	SubmissionWebhooks(workflow *Workflow) []Webhook
 	Start(ctx context.Context) error
 	Stop() error
 }
 
+type Scheduler interface {
+	CreateSchedule(ctx context.Context, schedule *Schedule) (*Schedule, error)
+	UpdateSchedule(ctx context.Context, schedule *Schedule) (*Schedule, error)
+	GetSchedule(ctx context.Context, scheduleID string) (*Schedule, error)
+	ListSchedules(ctx context.Context) ([]*Schedule, error)
+	DeleteSchedule(ctx context.Context, scheduleID string) error
+	PauseSchedule(ctx context.Context, scheduleID string) error
+	ResumeSchedule(ctx context.Context, scheduleID string) error
+	TriggerSchedule(ctx context.Context, scheduleID string) (string, error)
+	Backfill(ctx context.Context, request BackfillRequest) (*Backfill, error)
+	GetBackfill(ctx context.Context, backfillID string) (*Backfill, error)
+}
+
 type TaskQueue interface {
 	Enqueue(ctx context.Context, task *Task) error
 	Dequeue(ctx context.Context, workerID string) (*Task, error)
@@ -108,6 +659,168 @@ type StateManager interface {
 	ListWorkflows(ctx context.Context, limit, offset int) ([]*Workflow, error)
 }
 
+// WorkflowCreator creates a workflow under a caller-supplied ID, checking the
+// existing workflow against policy and writing the new one atomically. It
+// returns an error wrapping ErrWorkflowExists when the policy forbids reuse.
+// A reused ID starts from a clean record: the previous run's tasks, history
+// and undelivered signals are dropped in the same atomic write.
+type WorkflowCreator interface {
+	CreateWorkflow(ctx context.Context, workflow *Workflow, policy WorkflowIDReusePolicy) error
+}
+
+// WorkflowUpdater changes a stored workflow atomically: update is applied to
+// the current workflow and the result is written only if no other write
+// landed in between. When update returns an error nothing is written and the
+// error is returned as is.
+type WorkflowUpdater interface {
+	UpdateWorkflow(ctx context.Context, workflowID string, update func(*Workflow) error) (*Workflow, error)
+}
+
+// UpdateWorkflow applies update to the stored workflow through
+// stateManager's WorkflowUpdater, or by reading and saving it when
+// stateManager is none.
+func UpdateWorkflow(ctx context.Context, stateManager StateManager, workflowID string, update func(*Workflow) error) (*Workflow, error) {
+	if updater, ok := stateManager.(WorkflowUpdater); ok {
+		return updater.UpdateWorkflow(ctx, workflowID, update)
+	}
+
+	workflow, err := stateManager.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(workflow); err != nil {
+		return nil, err
+	}
+	if err := stateManager.SaveWorkflow(ctx, workflow); err != nil {
+		return nil, err
+	}
+	return workflow, nil
+}
+
+// ConcurrencyStore tracks which workflows hold a slot under a concurrency
+// key. AcquireConcurrencySlot reports true only when it newly adds
+// workflowID while fewer than limit workflows hold the key, so exactly one
+// engine wins the right to start a queued workflow. Releasing a slot that is
+// not held is not an error.
+type ConcurrencyStore interface {
+	AcquireConcurrencySlot(ctx context.Context, key, workflowID string, limit int) (bool, error)
+	ReleaseConcurrencySlot(ctx context.Context, key, workflowID string) error
+}
+
+// RateLimiter is implemented by task queues that can hold back tasks of a
+// type beyond a dispatch rate instead of handing them to workers.
+type RateLimiter interface {
+	SetRateLimit(ctx context.Context, taskType string, limit RateLimit) error
+}
+
+// TaskLeaser is implemented by task queues that lease dequeued tasks to
+// remote workers. A lease must be renewed before it expires; once it has
+// expired, ReclaimExpiredLeases fails the attempt so the task is retried like
+// any other failed attempt. Renewing or releasing a lease the worker no
+// longer holds returns ErrLeaseLost.
+type TaskLeaser interface {
+	AcquireLease(ctx context.Context, taskID, workerID string, ttl time.Duration) (time.Time, error)
+	RenewLease(ctx context.Context, taskID, workerID string, ttl time.Duration) (time.Time, error)
+	ReleaseLease(ctx context.Context, taskID, workerID string) error
+	ReclaimExpiredLeases(ctx context.Context) (int, error)
+}
+
+// ProgressStore is implemented by task queues that persist the progress
+// handlers report on their tasks, and publish it to live subscribers.
+type ProgressStore interface {
+	SetTaskProgress(ctx context.Context, taskID string, progress TaskProgress) error
+}
+
+// TaskFailer is implemented by task queues that can fail a task's current
+// attempt without retrying it. FailTask with retryable true behaves like
+// UpdateTaskState with TaskStateFailed.
+type TaskFailer interface {
+	FailTask(ctx context.Context, taskID, errMsg string, retryable bool) error
+}
+
+// HistoryStore keeps the event history of workflows. Events are returned in
+// the order they were appended.
+type HistoryStore interface {
+	AppendHistoryEvent(ctx context.Context, event *HistoryEvent) error
+	GetWorkflowHistory(ctx context.Context, workflowID string) ([]*HistoryEvent, error)
+}
+
+// EventBus streams history events to live subscribers as they are recorded.
+// SubscribeEvents delivers the events of workflowID, or of every workflow
+// when workflowID is empty, until ctx is done.
+type EventBus interface {
+	PublishEvent(ctx context.Context, event *HistoryEvent) error
+	SubscribeEvents(ctx context.Context, workflowID string) (<-chan *HistoryEvent, error)
+}
+
+// RecordEvent appends an event to the workflow history when stateManager
+// keeps one, publishes it when stateManager is an EventBus and queues
+// deliveries to the workflow's webhooks when stateManager is a
+// WebhookStore. Level defaults to "info" and CreatedAt to now.
+func RecordEvent(ctx context.Context, stateManager StateManager, event *HistoryEvent) error {
+	return RecordWorkflowEvent(ctx, stateManager, nil, event)
+}
+
+// RecordWorkflowEvent is RecordEvent for callers that hold the current
+// state of the event's workflow. Its webhooks are read from workflow instead
+// of loading the workflow again; a nil workflow is loaded only when the state
+// manager is a WebhookStore.
+func RecordWorkflowEvent(ctx context.Context, stateManager StateManager, workflow *Workflow, event *HistoryEvent) error {
+	if event.Level == "" {
+		event.Level = "info"
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if store, ok := stateManager.(HistoryStore); ok {
+		if err := store.AppendHistoryEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+	if bus, ok := stateManager.(EventBus); ok {
+		if err := bus.PublishEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+	if store, ok := stateManager.(WebhookStore); ok {
+		return enqueueWebhookDeliveries(ctx, stateManager, store, workflow, event)
+	}
+	return nil
+}
+
+// TaskLogStore keeps the log lines of tasks. GetTaskLogs returns up to limit
+// lines with Seq greater than afterSeq, oldest first.
+type TaskLogStore interface {
+	AppendTaskLog(ctx context.Context, entry *TaskLogEntry) error
+	GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*TaskLogEntry, error)
+}
+
+// SignalStore buffers signals durably until a workflow step consumes them.
+// ConsumeSignal returns nil without error when no signal is pending.
+type SignalStore interface {
+	SaveSignal(ctx context.Context, signal *Signal) error
+	ConsumeSignal(ctx context.Context, workflowID, signalName string) (*Signal, error)
+}
+
+// ScheduleStore persists schedules. UpdateSchedule changes a stored schedule
+// like WorkflowUpdater changes a workflow, so concurrent writers each change
+// only the fields they own.
+type ScheduleStore interface {
+	SaveSchedule(ctx context.Context, schedule *Schedule) error
+	GetSchedule(ctx context.Context, scheduleID string) (*Schedule, error)
+	UpdateSchedule(ctx context.Context, scheduleID string, update func(*Schedule) error) (*Schedule, error)
+	ListSchedules(ctx context.Context) ([]*Schedule, error)
+	DeleteSchedule(ctx context.Context, scheduleID string) error
+}
+
+// BackfillStore persists backfill records, so their progress can be read
+// from any engine. Stores drop records not updated for BackfillRetention.
+type BackfillStore interface {
+	SaveBackfill(ctx context.Context, backfill *Backfill) error
+	GetBackfill(ctx context.Context, backfillID string) (*Backfill, error)
+}
+
 type CacheInvalidator interface {
 	InvalidateCache(ctx context.Context, workflowID string) error
 	InvalidateTaskCache(ctx context.Context, taskID string) error
@@ -117,6 +830,18 @@ func NewTaskID() string {
 	return uuid.New().String()
 }
 
+func NewSignalID() string {
+	return uuid.New().String()
+}
+
+func NewScheduleID() string {
+	return uuid.New().String()
+}
+
+func NewBackfillID() string {
+	return uuid.New().String()
+}
+
 func NewWorkflowID() string {
 	return uuid.New().String()
 }
\ No newline at end of file
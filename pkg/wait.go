@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// waitRecheckInterval is how often WaitForWorkflow reads the workflow even
+// without a notification, since pub/sub messages can be lost while a
+// subscriber reconnects. Without an EventBus it reads every waitPollInterval.
+const (
+	waitRecheckInterval = 10 * time.Second
+	waitPollInterval    = time.Second
+)
+
+// WaitForWorkflow blocks until the workflow reaches a terminal state and
+// returns it, or returns ctx's error once ctx is done. When stateManager is
+// an EventBus it wakes up on the workflow's end events instead of polling.
+func WaitForWorkflow(ctx context.Context, stateManager StateManager, workflowID string) (*Workflow, error) {
+	var events <-chan *HistoryEvent
+	interval := waitPollInterval
+
+	// Subscribe before the first read so an end event in between is not missed
+	if bus, ok := stateManager.(EventBus); ok {
+		subscribeCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		subscription, err := bus.SubscribeEvents(subscribeCtx, workflowID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch workflow: %w", err)
+		}
+		events = subscription
+		interval = waitRecheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		workflow, err := stateManager.GetWorkflow(ctx, workflowID)
+		if err != nil {
+			return nil, err
+		}
+		if workflow.State.Terminal() {
+			return workflow, nil
+		}
+
+		if err := waitForEnd(ctx, events, ticker.C); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForEnd returns once a workflow end event arrives or ticks fires.
+func waitForEnd(ctx context.Context, events <-chan *HistoryEvent, ticks <-chan time.Time) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticks:
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				// The subscription ended; fall back to the ticker alone
+				events = nil
+				continue
+			}
+			switch event.Type {
+			case EventWorkflowCompleted, EventWorkflowFailed, EventWorkflowCanceled:
+				return nil
+			}
+		}
+	}
+}
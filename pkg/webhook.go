@@ -0,0 +1,211 @@
+package pkg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook is a URL notified of a workflow's events. Without Events it
+// receives the terminal workflow events: workflow_completed, workflow_failed
+// and workflow_canceled. Task events such as task_completed can be listed
+// explicitly.
+type Webhook struct {
+	URL    string      `json:"url"`
+	Events []EventType `json:"events,omitempty"`
+}
+
+// Matches reports whether the webhook subscribes to events of type eventType.
+func (w Webhook) Matches(eventType EventType) bool {
+	if len(w.Events) == 0 {
+		return eventType == EventWorkflowCompleted || eventType == EventWorkflowFailed || eventType == EventWorkflowCanceled
+	}
+	for _, subscribed := range w.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate rejects webhooks whose URL is not an absolute http or https URL.
+func (w Webhook) Validate() error {
+	target, err := url.Parse(w.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("invalid webhook URL: %q", w.URL)
+	}
+	return nil
+}
+
+type WebhookDeliveryState string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryState = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryState = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryState = "failed"
+)
+
+// WebhookPayload is the JSON body posted to a webhook. Task is set for task
+// events.
+type WebhookPayload struct {
+	Event    *HistoryEvent `json:"event"`
+	Workflow *Workflow     `json:"workflow"`
+	Task     *Task         `json:"task,omitempty"`
+}
+
+// WebhookDelivery is one event sent to one webhook URL. Payload is fixed
+// when the event is recorded, so retries and redeliveries send the same body.
+// NextAttemptAt is nil once the delivery succeeded or ran out of attempts.
+type WebhookDelivery struct {
+	ID             string               `json:"id"`
+	WorkflowID     string               `json:"workflow_id"`
+	TaskID         string               `json:"task_id,omitempty"`
+	URL            string               `json:"url"`
+	Event          EventType            `json:"event"`
+	Payload        json.RawMessage      `json:"payload"`
+	State          WebhookDeliveryState `json:"state"`
+	Attempts       int                  `json:"attempts"`
+	ResponseStatus int                  `json:"response_status,omitempty"`
+	Error          string               `json:"error,omitempty"`
+	NextAttemptAt  *time.Time           `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time           `json:"delivered_at,omitempty"`
+	RedeliveryOf   string               `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+// WebhookStore persists webhook deliveries. ClaimWebhookDeliveries reserves
+// up to limit deliveries due at now by pushing their next attempt back by
+// lease, so one engine sends each attempt and a delivery whose sender died is
+// picked up again once the lease runs out. ListWebhookDeliveries returns a
+// workflow's deliveries oldest first.
+type WebhookStore interface {
+	SaveWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, deliveryID string) (*WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, workflowID string) ([]*WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error)
+}
+
+// enqueueWebhookDeliveries creates a pending delivery for every webhook of
+// the event's workflow subscribed to the event, loading the workflow when
+// the caller did not pass it.
+func enqueueWebhookDeliveries(ctx context.Context, stateManager StateManager, store WebhookStore, workflow *Workflow, event *HistoryEvent) error {
+	if workflow == nil {
+		var err error
+		if workflow, err = stateManager.GetWorkflow(ctx, event.WorkflowID); err != nil {
+			return fmt.Errorf("failed to get workflow for webhooks: %w", err)
+		}
+	}
+
+	var webhooks []Webhook
+	for _, webhook := range workflow.Webhooks {
+		if webhook.Matches(event.Type) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload := WebhookPayload{Event: event, Workflow: workflow}
+	if event.TaskID != "" {
+		if task, err := stateManager.GetTask(ctx, event.TaskID); err == nil {
+			payload.Task = task
+		}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		delivery := &WebhookDelivery{
+			ID:            NewWebhookDeliveryID(),
+			WorkflowID:    event.WorkflowID,
+			TaskID:        event.TaskID,
+			URL:           webhook.URL,
+			Event:         event.Type,
+			Payload:       data,
+			State:         WebhookDeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+		}
+		if err := store.SaveWebhookDelivery(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RedeliverWebhook queues a new delivery carrying the payload of original,
+// leaving the original delivery and its outcome in the log.
+func RedeliverWebhook(ctx context.Context, store WebhookStore, original *WebhookDelivery) (*WebhookDelivery, error) {
+	now := time.Now()
+	delivery := &WebhookDelivery{
+		ID:            NewWebhookDeliveryID(),
+		WorkflowID:    original.WorkflowID,
+		TaskID:        original.TaskID,
+		URL:           original.URL,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		State:         WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		RedeliveryOf:  original.ID,
+		CreatedAt:     now,
+	}
+	if err := store.SaveWebhookDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+// under secret, as sent in the X-Temjob-Signature header. Receivers verify
+// it against the X-Temjob-Timestamp header and the raw request body.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ErrInvalidWebhookSignature is returned by VerifyWebhookSignature for a
+// request that was not signed with the secret or is too old.
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// VerifyWebhookSignature checks a received webhook: timestamp and signature
+// are the X-Temjob-Timestamp and X-Temjob-Signature headers and body is the
+// raw request body. Requests signed more than tolerance ago are rejected so a
+// captured request cannot be replayed later.
+func VerifyWebhookSignature(secret, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrInvalidWebhookSignature)
+	}
+
+	age := time.Since(time.Unix(signedAt, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidWebhookSignature)
+	}
+
+	expected := "sha256=" + SignWebhookPayload(secret, signedAt, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+func NewWebhookDeliveryID() string {
+	return uuid.New().String()
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// progressInterval is the least time between two progress writes of a task.
+const progressInterval = time.Second
+
+// progressReporter writes the progress a handler reports for one task
+// attempt. Reports arriving within progressInterval of the last write are
+// held back and only the latest is written, when the interval has passed or
+// the handler returns, so a handler may report from a tight loop.
+type progressReporter struct {
+	taskID string
+	store  pkg.ProgressStore
+
+	mu       sync.Mutex
+	lastSent time.Time
+	pending  *pkg.TaskProgress
+	timer    *time.Timer
+
+	// sendMu serializes writes so that Close returns only once no write
+	// is in flight; a write landing after the attempt's outcome would
+	// overwrite it.
+	sendMu sync.Mutex
+	closed bool
+}
+
+func newProgressReporter(task *pkg.Task, taskQueue pkg.TaskQueue) *progressReporter {
+	store, _ := taskQueue.(pkg.ProgressStore)
+	return &progressReporter{taskID: task.ID, store: store}
+}
+
+// Report normalizes progress and writes it or holds it back. Percent is
+// derived from Current and Total when only they are set.
+func (r *progressReporter) Report(progress pkg.TaskProgress) error {
+	if r.store == nil {
+		return nil
+	}
+
+	if progress.Percent == 0 && progress.Total > 0 {
+		progress.Percent = float64(progress.Current) / float64(progress.Total) * 100
+	}
+	progress.Percent = min(max(progress.Percent, 0), 100)
+	progress.UpdatedAt = time.Now()
+
+	r.mu.Lock()
+	wait := progressInterval - time.Since(r.lastSent)
+	if wait > 0 {
+		r.pending = &progress
+		if r.timer == nil {
+			r.timer = time.AfterFunc(wait, r.flushPending)
+		}
+		r.mu.Unlock()
+		return nil
+	}
+	r.lastSent = progress.UpdatedAt
+	r.mu.Unlock()
+
+	return r.send(progress)
+}
+
+func (r *progressReporter) flushPending() {
+	r.mu.Lock()
+	progress := r.pending
+	r.pending = nil
+	r.timer = nil
+	r.lastSent = time.Now()
+	r.mu.Unlock()
+
+	if progress != nil {
+		r.send(*progress)
+	}
+}
+
+func (r *progressReporter) send(progress pkg.TaskProgress) error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	if r.closed {
+		return nil
+	}
+	return r.store.SetTaskProgress(context.Background(), r.taskID, progress)
+}
+
+// Close writes any held-back progress and drops later reports.
+func (r *progressReporter) Close() {
+	if r.store == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	progress := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	if progress != nil {
+		r.send(*progress)
+	}
+
+	r.sendMu.Lock()
+	r.closed = true
+	r.sendMu.Unlock()
+}
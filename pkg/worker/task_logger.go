@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// taskLogger stores handler log lines for one task attempt and mirrors them
+// to the worker's logger. Lines are written with a detached context so they
+// survive a handler whose context was canceled.
+type taskLogger struct {
+	task   *pkg.Task
+	store  pkg.TaskLogStore
+	logger *zap.Logger
+}
+
+func newTaskLogger(task *pkg.Task, store pkg.TaskLogStore, logger *zap.Logger) *taskLogger {
+	return &taskLogger{
+		task:   task,
+		store:  store,
+		logger: logger.With(zap.String("task_id", task.ID), zap.String("workflow_id", task.WorkflowID)),
+	}
+}
+
+func (l *taskLogger) Debugf(format string, args ...interface{}) {
+	l.log("debug", fmt.Sprintf(format, args...))
+}
+
+func (l *taskLogger) Infof(format string, args ...interface{}) {
+	l.log("info", fmt.Sprintf(format, args...))
+}
+
+func (l *taskLogger) Warnf(format string, args ...interface{}) {
+	l.log("warn", fmt.Sprintf(format, args...))
+}
+
+func (l *taskLogger) Errorf(format string, args ...interface{}) {
+	l.log("error", fmt.Sprintf(format, args...))
+}
+
+func (l *taskLogger) log(level, message string) {
+	switch level {
+	case "debug":
+		l.logger.Debug(message)
+	case "warn":
+		l.logger.Warn(message)
+	case "error":
+		l.logger.Error(message)
+	default:
+		l.logger.Info(message)
+	}
+
+	if l.store == nil {
+		return
+	}
+
+	entry := &pkg.TaskLogEntry{
+		TaskID:     l.task.ID,
+		WorkflowID: l.task.WorkflowID,
+		Attempt:    l.task.RetryCount + 1,
+		Level:      level,
+		Message:    message,
+		CreatedAt:  time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.store.AppendTaskLog(ctx, entry); err != nil {
+		l.logger.Warn("Failed to store task log", zap.Error(err))
+	}
+}
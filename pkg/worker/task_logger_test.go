@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/state"
+)
+
+func TestTaskLoggerStoresLines(t *testing.T) {
+	logger := zap.NewNop()
+	stateManager := state.NewMemoryStateManager()
+	task := &pkg.Task{ID: "task", WorkflowID: "wf", RetryCount: 1}
+
+	taskLogger := newTaskLogger(task, stateManager, logger)
+	taskLogger.Infof("processed %d rows", 3)
+	taskLogger.Errorf("failed")
+
+	logs, err := stateManager.GetTaskLogs(context.Background(), "task", 0, 10)
+	if err != nil {
+		t.Fatalf("failed to get task logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d log lines, want 2", len(logs))
+	}
+	if logs[0].Message != "processed 3 rows" || logs[0].Level != "info" || logs[0].Attempt != 2 {
+		t.Errorf("first line = %+v", logs[0])
+	}
+	if logs[1].Level != "error" || logs[1].Seq != 2 {
+		t.Errorf("second line = %+v", logs[1])
+	}
+}
+
+// queueWithLogs is a task queue that keeps task logs itself, as the remote
+// worker's queue does.
+type queueWithLogs struct {
+	pkg.TaskQueue
+	entries []*pkg.TaskLogEntry
+}
+
+func (q *queueWithLogs) AppendTaskLog(ctx context.Context, entry *pkg.TaskLogEntry) error {
+	q.entries = append(q.entries, entry)
+	return nil
+}
+
+func (q *queueWithLogs) GetTaskLogs(ctx context.Context, taskID string, afterSeq int64, limit int) ([]*pkg.TaskLogEntry, error) {
+	return q.entries, nil
+}
+
+func TestTaskLogStoreFallsBackToQueue(t *testing.T) {
+	taskQueue := &queueWithLogs{}
+	w := NewWorker(taskQueue, nil, zap.NewNop())
+	if w.taskLogStore() != taskQueue {
+		t.Error("worker without a state manager does not log to its queue")
+	}
+
+	stateManager := state.NewMemoryStateManager()
+	w = NewWorker(taskQueue, stateManager, zap.NewNop())
+	if w.taskLogStore() != stateManager {
+		t.Error("worker with a state manager does not log to it")
+	}
+}
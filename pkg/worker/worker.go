@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 
@@ -18,6 +19,7 @@ type Worker struct {
 	stateManager pkg.StateManager
 	logger       *zap.Logger
 	handlers     map[string]pkg.TaskHandler
+	interceptors []pkg.TaskInterceptor
 	mu           sync.RWMutex
 	running      bool
 	stopCh       chan struct{}
@@ -45,6 +47,15 @@ func (w *Worker) RegisterTaskHandler(taskType string, handler pkg.TaskHandler) {
 	w.logger.Info("Task handler registered", zap.String("task_type", taskType), zap.String("worker_id", w.id))
 }
 
+// Use appends interceptors to the chain around every handler. The first
+// interceptor added is the outermost, so it sees the task first and the
+// outcome last.
+func (w *Worker) Use(interceptors ...pkg.TaskInterceptor) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.interceptors = append(w.interceptors, interceptors...)
+}
+
 func (w *Worker) Start(ctx context.Context) error {
 	w.running = true
 	w.logger.Info("Worker started", zap.String("worker_id", w.id))
@@ -87,6 +98,7 @@ func (w *Worker) processNextTask(ctx context.Context) error {
 
 	w.mu.RLock()
 	handler, exists := w.handlers[task.Type]
+	interceptors := w.interceptors
 	w.mu.RUnlock()
 
 	if !exists {
@@ -95,19 +107,103 @@ func (w *Worker) processNextTask(ctx context.Context) error {
 		return w.taskQueue.UpdateTaskState(ctx, task.ID, pkg.TaskStateFailed, nil, errMsg)
 	}
 
+	err = pkg.RecordEvent(ctx, w.stateManager, &pkg.HistoryEvent{
+		WorkflowID: task.WorkflowID,
+		TaskID:     task.ID,
+		Type:       pkg.EventTaskStarted,
+		Message:    "Task started: " + task.Type,
+		Metadata: map[string]interface{}{
+			"worker_id": w.id,
+			"attempt":   task.RetryCount + 1,
+		},
+	})
+	if err != nil {
+		w.logger.Warn("Failed to record history event", zap.String("task_id", task.ID), zap.Error(err))
+	}
+
+	taskLogger := newTaskLogger(task, w.taskLogStore(), w.logger)
+
 	taskCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
 	defer cancel()
+	taskCtx = pkg.WithTaskLogger(taskCtx, taskLogger)
+	taskCtx = pkg.WithTaskInfo(taskCtx, w.taskInfo(taskCtx, task))
+	progress := newProgressReporter(task, w.taskQueue)
+	taskCtx = pkg.WithProgress(taskCtx, progress.Report)
 
-	output, err := handler(taskCtx, task.Input)
+	output, err := recoverPanic(chainInterceptors(task, recoverPanic(handler), interceptors))(taskCtx, task.Input)
+	progress.Close()
 	if err != nil {
-		w.logger.Error("Task execution failed", zap.String("task_id", task.ID), zap.Error(err))
-		return w.taskQueue.UpdateTaskState(ctx, task.ID, pkg.TaskStateFailed, nil, err.Error())
+		taskLogger.Errorf("Task execution failed: %v", err)
+		return w.failTask(ctx, task, err)
 	}
 
 	w.logger.Info("Task completed successfully", zap.String("task_id", task.ID))
 	return w.taskQueue.UpdateTaskState(ctx, task.ID, pkg.TaskStateCompleted, output, "")
 }
 
+// taskLogStore returns where handler log lines are kept: the state manager,
+// or for a worker without one, such as a remote worker, a task queue that
+// carries them to the server itself.
+func (w *Worker) taskLogStore() pkg.TaskLogStore {
+	if store, ok := w.stateManager.(pkg.TaskLogStore); ok {
+		return store
+	}
+	store, _ := w.taskQueue.(pkg.TaskLogStore)
+	return store
+}
+
+func (w *Worker) taskInfo(ctx context.Context, task *pkg.Task) pkg.TaskInfo {
+	info := pkg.TaskInfo{
+		TaskID:      task.ID,
+		WorkflowID:  task.WorkflowID,
+		TaskType:    task.Type,
+		Attempt:     task.RetryCount + 1,
+		MaxAttempts: task.MaxRetries + 1,
+		WorkerID:    w.id,
+		ScheduledAt: task.CreatedAt,
+		StartedAt:   time.Now(),
+	}
+	if task.StartedAt != nil {
+		info.StartedAt = *task.StartedAt
+	}
+	info.Deadline, _ = ctx.Deadline()
+	return info
+}
+
+// chainInterceptors wraps handler in interceptors, the first outermost.
+func chainInterceptors(task *pkg.Task, handler pkg.TaskHandler, interceptors []pkg.TaskInterceptor) pkg.TaskHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+			return interceptor(ctx, task, input, next)
+		}
+	}
+	return handler
+}
+
+// recoverPanic turns a panic in handler into a *pkg.PanicError. The handler
+// is wrapped before the interceptors see it, so they observe its panics as
+// errors, and the chain is wrapped again to survive interceptor panics.
+func recoverPanic(handler pkg.TaskHandler) pkg.TaskHandler {
+	return func(ctx context.Context, input map[string]interface{}) (output map[string]interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				output, err = nil, &pkg.PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return handler(ctx, input)
+	}
+}
+
+// failTask fails the task's attempt with err, skipping its retries when err
+// is non-retryable and the queue supports failing without retry.
+func (w *Worker) failTask(ctx context.Context, task *pkg.Task, err error) error {
+	if failer, ok := w.taskQueue.(pkg.TaskFailer); ok && pkg.IsNonRetryable(err) {
+		return failer.FailTask(ctx, task.ID, err.Error(), false)
+	}
+	return w.taskQueue.UpdateTaskState(ctx, task.ID, pkg.TaskStateFailed, nil, err.Error())
+}
+
 func (w *Worker) GetStats(ctx context.Context) (*WorkerStats, error) {
 	w.mu.RLock()
 	handlerCount := len(w.handlers)
@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+	"github.com/XXueTu/temjob/pkg/state"
+)
+
+// runTask enqueues one task of taskType, lets a worker with handler process
+// it and returns the task once its attempt is recorded.
+func runTask(t *testing.T, handler pkg.TaskHandler, interceptors ...pkg.TaskInterceptor) *pkg.Task {
+	t.Helper()
+
+	logger := zap.NewNop()
+	stateManager := state.NewMemoryStateManager()
+	taskQueue := queue.NewMemoryTaskQueue(logger, stateManager)
+	w := NewWorker(taskQueue, stateManager, logger)
+	w.RegisterTaskHandler("t", handler)
+	w.Use(interceptors...)
+
+	ctx := context.Background()
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: "wf",
+		Type:       "t",
+		Input:      map[string]interface{}{"n": 1},
+		State:      pkg.TaskStatePending,
+		CreatedAt:  time.Now(),
+	}
+	if err := stateManager.SaveTask(ctx, task); err != nil {
+		t.Fatalf("failed to save task: %v", err)
+	}
+	if err := taskQueue.Enqueue(ctx, task); err != nil {
+		t.Fatalf("failed to enqueue task: %v", err)
+	}
+
+	if err := w.processNextTask(ctx); err != nil {
+		t.Fatalf("failed to process task: %v", err)
+	}
+
+	stored, err := stateManager.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	return stored
+}
+
+func TestWorkerRecoversHandlerPanic(t *testing.T) {
+	task := runTask(t, func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		panic("kaboom")
+	})
+
+	if task.State != pkg.TaskStateFailed {
+		t.Fatalf("task state = %s, want failed", task.State)
+	}
+	if !strings.HasPrefix(task.Error, "task handler panicked: kaboom") {
+		t.Errorf("task error = %q, want the panic value", task.Error)
+	}
+	if !strings.Contains(task.Error, "goroutine") {
+		t.Errorf("task error = %q, want the stack trace", task.Error)
+	}
+}
+
+func TestInterceptorSeesPanicAsError(t *testing.T) {
+	var seen error
+	observe := func(ctx context.Context, task *pkg.Task, input map[string]interface{}, next pkg.TaskHandler) (map[string]interface{}, error) {
+		output, err := next(ctx, input)
+		seen = err
+		return output, err
+	}
+
+	runTask(t, func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		panic("kaboom")
+	}, observe)
+
+	var panicErr *pkg.PanicError
+	if !errors.As(seen, &panicErr) || panicErr.Value != "kaboom" {
+		t.Errorf("interceptor saw %v, want a *pkg.PanicError", seen)
+	}
+}
+
+func TestWorkerRecoversInterceptorPanic(t *testing.T) {
+	explode := func(ctx context.Context, task *pkg.Task, input map[string]interface{}, next pkg.TaskHandler) (map[string]interface{}, error) {
+		panic("interceptor")
+	}
+
+	task := runTask(t, func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{}, nil
+	}, explode)
+
+	if task.State != pkg.TaskStateFailed || !strings.Contains(task.Error, "interceptor") {
+		t.Errorf("task state = %s (%q), want failed by the interceptor panic", task.State, task.Error)
+	}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) pkg.TaskInterceptor {
+		return func(ctx context.Context, task *pkg.Task, input map[string]interface{}, next pkg.TaskHandler) (map[string]interface{}, error) {
+			calls = append(calls, name+" before")
+			output, err := next(ctx, input)
+			calls = append(calls, name+" after")
+			return output, err
+		}
+	}
+
+	runTask(t, func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		calls = append(calls, "handler")
+		return map[string]interface{}{}, nil
+	}, trace("outer"), trace("inner"))
+
+	want := "outer before,inner before,handler,inner after,outer after"
+	if got := strings.Join(calls, ","); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
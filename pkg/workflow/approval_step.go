@@ -0,0 +1,109 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// startApproval records an approval step as a waiting task whose input holds
+// only the context fields the approver needs to see.
+func (e *Engine) startApproval(ctx context.Context, run *workflowRun, step pkg.WorkflowStep) (*pkg.Task, error) {
+	if task := run.adopt(step.TaskType, nil); task != nil {
+		return task, nil
+	}
+
+	input := copyContext(run.context)
+	if step.Approval != nil && len(step.Approval.Fields) > 0 {
+		input = make(map[string]interface{}, len(step.Approval.Fields))
+		for _, field := range step.Approval.Fields {
+			if v, ok := run.context[field]; ok {
+				input[field] = v
+			}
+		}
+	}
+
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: run.workflow.ID,
+		Type:       step.TaskType,
+		Kind:       pkg.StepKindApproval,
+		Input:      input,
+		State:      pkg.TaskStateWaiting,
+		CreatedAt:  time.Now(),
+	}
+	if step.Approval != nil && step.Approval.Timeout > 0 {
+		deadline := task.CreatedAt.Add(step.Approval.Timeout)
+		task.WakeAt = &deadline
+	}
+
+	if err := e.saveNewTask(ctx, run.workflow, task); err != nil {
+		return nil, err
+	}
+
+	e.logger.Info("Waiting for approval", zap.String("task_id", task.ID), zap.String("step", step.TaskType))
+	return task, nil
+}
+
+// DecideApproval records an operator's decision on the workflow's pending
+// approval step. It returns an error matching pkg.ErrNoPendingApproval when
+// the step is not waiting for a decision, so a stray decision is never left
+// behind for a later run of the step.
+func (e *Engine) DecideApproval(ctx context.Context, workflowID, step, decision, approver, comment string) error {
+	tasks, err := e.stateManager.GetWorkflowTasks(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+
+	pending := false
+	for _, task := range tasks {
+		if task.Type == step && task.Kind == pkg.StepKindApproval && task.State == pkg.TaskStateWaiting {
+			pending = true
+			break
+		}
+	}
+	if !pending {
+		return fmt.Errorf("%w for step: %s", pkg.ErrNoPendingApproval, step)
+	}
+
+	return e.SignalWorkflow(ctx, workflowID, pkg.ApprovalSignalName(step), map[string]interface{}{
+		"decision": decision,
+		"approver": approver,
+		"comment":  comment,
+	})
+}
+
+// waitForApproval waits for the step's approval signal and records the
+// decision on the task. Approval completes the task with the decision under
+// "<step>_approval" in its output; rejection fails it.
+func (e *Engine) waitForApproval(ctx context.Context, step pkg.WorkflowStep, task *pkg.Task) (*pkg.Task, error) {
+	return e.awaitSignal(ctx, task, pkg.ApprovalSignalName(step.TaskType), func(task *pkg.Task, signal *pkg.Signal) {
+		decision := &pkg.ApprovalDecision{DecidedAt: signal.CreatedAt}
+		decision.Decision, _ = signal.Payload["decision"].(string)
+		decision.Approver, _ = signal.Payload["approver"].(string)
+		decision.Comment, _ = signal.Payload["comment"].(string)
+		task.Approval = decision
+
+		if decision.Decision != pkg.ApprovalApproved {
+			task.State = pkg.TaskStateFailed
+			task.Error = fmt.Sprintf("rejected by %s", decision.Approver)
+			if decision.Comment != "" {
+				task.Error += ": " + decision.Comment
+			}
+			return
+		}
+
+		task.State = pkg.TaskStateCompleted
+		task.Output = map[string]interface{}{
+			step.TaskType + "_approval": map[string]interface{}{
+				"decision": decision.Decision,
+				"approver": decision.Approver,
+				"comment":  decision.Comment,
+			},
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+func approvalDefinition(name string) pkg.WorkflowDefinition {
+	return sdk.NewWorkflowBuilder(name).
+		AddTask("ship", echoHandler, 0).
+		AddApprovalStep("review", 0, "amount").Then().
+		AddStep("ship").DependsOn("review").Then().
+		Build()
+}
+
+func TestApprovalApproved(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, approvalDefinition("approval"))
+	ctx := context.Background()
+
+	workflowID := env.submit(t, "approval", map[string]interface{}{"amount": 100, "secret": "x"})
+	task := env.waitForTask(t, workflowID, "review", pkg.TaskStateWaiting)
+	if _, ok := task.Input["secret"]; ok || task.Input["amount"] == nil {
+		t.Errorf("approval input = %v, want only the listed fields", task.Input)
+	}
+
+	if err := env.engine.DecideApproval(ctx, workflowID, "review", pkg.ApprovalApproved, "bob", "fine"); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+
+	wf := env.wait(t, workflowID)
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+	decision, _ := wf.Output["review_approval"].(map[string]interface{})
+	if decision["approver"] != "bob" || decision["decision"] != pkg.ApprovalApproved {
+		t.Errorf("review_approval = %v, want bob's approval", wf.Output["review_approval"])
+	}
+}
+
+func TestApprovalRejected(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, approvalDefinition("rejection"))
+	ctx := context.Background()
+
+	workflowID := env.submit(t, "rejection", map[string]interface{}{"amount": 100})
+	env.waitForTask(t, workflowID, "review", pkg.TaskStateWaiting)
+	if err := env.engine.DecideApproval(ctx, workflowID, "review", pkg.ApprovalRejected, "bob", "too much"); err != nil {
+		t.Fatalf("failed to reject: %v", err)
+	}
+
+	wf := env.wait(t, workflowID)
+	assertState(t, wf, pkg.WorkflowStateFailed)
+	if !strings.Contains(wf.Error, "rejected by bob: too much") {
+		t.Errorf("error = %q, want the rejection", wf.Error)
+	}
+}
+
+func TestApprovalWithoutPendingStep(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, approvalDefinition("no_pending"))
+	ctx := context.Background()
+
+	workflowID := env.submit(t, "no_pending", nil)
+	env.waitForTask(t, workflowID, "review", pkg.TaskStateWaiting)
+
+	err := env.engine.DecideApproval(ctx, workflowID, "other", pkg.ApprovalApproved, "bob", "")
+	if !errors.Is(err, pkg.ErrNoPendingApproval) {
+		t.Errorf("decision on another step: err = %v, want ErrNoPendingApproval", err)
+	}
+
+	if err := env.engine.DecideApproval(ctx, workflowID, "review", pkg.ApprovalApproved, "bob", ""); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	env.wait(t, workflowID)
+
+	err = env.engine.DecideApproval(ctx, workflowID, "review", pkg.ApprovalApproved, "bob", "")
+	if !errors.Is(err, pkg.ErrNoPendingApproval) {
+		t.Errorf("decision after the step: err = %v, want ErrNoPendingApproval", err)
+	}
+}
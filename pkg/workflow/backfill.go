@@ -0,0 +1,202 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// maxBackfillRuns guards against ranges that would submit an unbounded
+// number of workflows, e.g. a per-minute cron over several years.
+const maxBackfillRuns = 10000
+
+func (e *Engine) backfillStore() (pkg.BackfillStore, error) {
+	store, ok := e.stateManager.(pkg.BackfillStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not support backfills")
+	}
+	return store, nil
+}
+
+// Backfill submits one workflow per tick of the requested schedule in
+// [Start, End), injecting each tick as the run's logical time. It returns
+// once the ticks are computed; submission continues in the background and
+// can be followed with GetBackfill from any engine.
+func (e *Engine) Backfill(ctx context.Context, request pkg.BackfillRequest) (*pkg.Backfill, error) {
+	store, err := e.backfillStore()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &pkg.Schedule{
+		WorkflowName:  request.WorkflowName,
+		CronExpr:      request.CronExpr,
+		Interval:      request.Interval,
+		Timezone:      request.Timezone,
+		InputTemplate: request.InputTemplate,
+	}
+
+	if request.ScheduleID != "" {
+		schedule, err := e.GetSchedule(ctx, request.ScheduleID)
+		if err != nil {
+			return nil, err
+		}
+		spec = schedule
+	}
+
+	if err := e.validateSchedule(spec); err != nil {
+		return nil, err
+	}
+	if !request.Start.Before(request.End) {
+		return nil, fmt.Errorf("backfill start must be before end")
+	}
+
+	ticks, err := backfillTicks(spec, request.Start, request.End)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	backfill := &pkg.Backfill{
+		ID:           pkg.NewBackfillID(),
+		ScheduleID:   request.ScheduleID,
+		WorkflowName: spec.WorkflowName,
+		Start:        request.Start,
+		End:          request.End,
+		State:        pkg.BackfillStateRunning,
+		TotalRuns:    len(ticks),
+		WorkflowIDs:  []string{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := store.SaveBackfill(ctx, backfill); err != nil {
+		return nil, err
+	}
+	snapshot := *backfill
+	snapshot.WorkflowIDs = []string{}
+
+	go e.runBackfill(context.Background(), store, backfill, spec, ticks, request.MaxConcurrent)
+
+	e.logger.Info("Backfill started",
+		zap.String("backfill_id", backfill.ID),
+		zap.String("workflow", spec.WorkflowName),
+		zap.Int("runs", len(ticks)))
+	return &snapshot, nil
+}
+
+// GetBackfill returns the stored progress of a backfill. Records are kept
+// for pkg.BackfillRetention after their last update.
+func (e *Engine) GetBackfill(ctx context.Context, backfillID string) (*pkg.Backfill, error) {
+	store, err := e.backfillStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetBackfill(ctx, backfillID)
+}
+
+// runBackfill owns backfill while it submits the ticks, saving its progress
+// after every submission.
+func (e *Engine) runBackfill(ctx context.Context, store pkg.BackfillStore, backfill *pkg.Backfill, spec *pkg.Schedule, ticks []time.Time, maxConcurrent int) {
+	var active []string
+
+	for _, runAt := range ticks {
+		for maxConcurrent > 0 && len(active) >= maxConcurrent {
+			select {
+			case <-ctx.Done():
+				e.finishBackfill(ctx, store, backfill, errRunInterrupted)
+				return
+			case <-e.stopCh:
+				e.finishBackfill(ctx, store, backfill, errRunInterrupted)
+				return
+			case <-time.After(1 * time.Second):
+			}
+			active = e.activeWorkflows(ctx, active)
+		}
+
+		workflowID, err := e.submitScheduledWorkflow(ctx, backfill.ScheduleID, spec.WorkflowName, spec.InputTemplate, runAt, "", map[string]interface{}{
+			"backfill_id": backfill.ID,
+		})
+		if err != nil {
+			e.finishBackfill(ctx, store, backfill, fmt.Errorf("run at %s: %w", runAt.Format(time.RFC3339), err))
+			return
+		}
+
+		backfill.WorkflowIDs = append(backfill.WorkflowIDs, workflowID)
+		backfill.UpdatedAt = time.Now()
+		if err := store.SaveBackfill(ctx, backfill); err != nil {
+			e.logger.Warn("Failed to save backfill progress", zap.String("backfill_id", backfill.ID), zap.Error(err))
+		}
+		active = append(active, workflowID)
+	}
+
+	e.finishBackfill(ctx, store, backfill, nil)
+}
+
+func (e *Engine) finishBackfill(ctx context.Context, store pkg.BackfillStore, backfill *pkg.Backfill, err error) {
+	now := time.Now()
+	backfill.EndedAt = &now
+	backfill.UpdatedAt = now
+	backfill.State = pkg.BackfillStateCompleted
+	if err != nil {
+		backfill.State = pkg.BackfillStateFailed
+		backfill.Error = err.Error()
+	}
+
+	if err := store.SaveBackfill(ctx, backfill); err != nil {
+		e.logger.Error("Failed to save finished backfill", zap.String("backfill_id", backfill.ID), zap.Error(err))
+	}
+
+	e.logger.Info("Backfill finished",
+		zap.String("backfill_id", backfill.ID),
+		zap.String("state", string(backfill.State)),
+		zap.Int("submitted", len(backfill.WorkflowIDs)))
+}
+
+// activeWorkflows filters workflowIDs down to those still pending or running.
+func (e *Engine) activeWorkflows(ctx context.Context, workflowIDs []string) []string {
+	active := workflowIDs[:0]
+	for _, workflowID := range workflowIDs {
+		workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
+		if err != nil {
+			continue
+		}
+		if workflow.State == pkg.WorkflowStatePending || workflow.State == pkg.WorkflowStateRunning {
+			active = append(active, workflowID)
+		}
+	}
+	return active
+}
+
+// backfillTicks lists the ticks of spec in [start, end). Interval ticks are
+// anchored at start.
+func backfillTicks(spec *pkg.Schedule, start, end time.Time) ([]time.Time, error) {
+	var ticks []time.Time
+
+	if spec.CronExpr == "" {
+		for t := start; t.Before(end); t = t.Add(spec.Interval) {
+			ticks = append(ticks, t)
+			if len(ticks) > maxBackfillRuns {
+				return nil, fmt.Errorf("backfill exceeds %d runs", maxBackfillRuns)
+			}
+		}
+		return ticks, nil
+	}
+
+	cronSpec, loc, err := parseCronSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for t := cronSpec.Next(start.Add(-time.Nanosecond).In(loc)); t.Before(end); t = cronSpec.Next(t) {
+		ticks = append(ticks, t)
+		if len(ticks) > maxBackfillRuns {
+			return nil, fmt.Errorf("backfill exceeds %d runs", maxBackfillRuns)
+		}
+	}
+	return ticks, nil
+}
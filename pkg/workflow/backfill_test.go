@@ -0,0 +1,155 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+)
+
+// waitForBackfill polls the backfill until check accepts it.
+func waitForBackfill(t *testing.T, engine *Engine, backfillID string, check func(*pkg.Backfill) bool) *pkg.Backfill {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		backfill, err := engine.GetBackfill(context.Background(), backfillID)
+		if err != nil {
+			t.Fatalf("failed to get backfill: %v", err)
+		}
+		if check(backfill) {
+			return backfill
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("backfill %s did not reach the expected progress", backfillID)
+	return nil
+}
+
+func TestBackfillTicks(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	ticks, err := backfillTicks(&pkg.Schedule{Interval: 20 * time.Minute}, start, end)
+	if err != nil {
+		t.Fatalf("failed to list interval ticks: %v", err)
+	}
+	if len(ticks) != 3 || !ticks[0].Equal(start) || !ticks[2].Equal(start.Add(40*time.Minute)) {
+		t.Errorf("interval ticks = %v, want 3 from start with end excluded", ticks)
+	}
+
+	ticks, err = backfillTicks(&pkg.Schedule{CronExpr: "*/15 * * * *", Timezone: "UTC"}, start, end)
+	if err != nil {
+		t.Fatalf("failed to list cron ticks: %v", err)
+	}
+	if len(ticks) != 4 || !ticks[0].Equal(start) {
+		t.Errorf("cron ticks = %v, want 4 starting at the inclusive start", ticks)
+	}
+
+	if _, err := backfillTicks(&pkg.Schedule{Interval: time.Second}, start, start.Add(24*time.Hour)); err == nil {
+		t.Error("backfill over the run cap was accepted")
+	}
+}
+
+func TestBackfillRejectsEmptyRange(t *testing.T) {
+	t.Parallel()
+
+	engine, _ := newScheduleTestEngine(t)
+	start := time.Now()
+	_, err := engine.Backfill(context.Background(), pkg.BackfillRequest{
+		WorkflowName: "wait",
+		Interval:     time.Minute,
+		Start:        start,
+		End:          start,
+	})
+	if err == nil {
+		t.Error("backfill with an empty range was accepted")
+	}
+}
+
+func TestBackfillSubmitsEveryTick(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	backfill, err := engine.Backfill(ctx, pkg.BackfillRequest{
+		WorkflowName: "wait",
+		Interval:     time.Hour,
+		Start:        start,
+		End:          start.Add(3 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("failed to start backfill: %v", err)
+	}
+	if backfill.TotalRuns != 3 || backfill.State != pkg.BackfillStateRunning {
+		t.Fatalf("backfill = %+v, want 3 runs in progress", backfill)
+	}
+
+	backfill = waitForBackfill(t, engine, backfill.ID, func(b *pkg.Backfill) bool {
+		return b.State != pkg.BackfillStateRunning
+	})
+	if backfill.State != pkg.BackfillStateCompleted || len(backfill.WorkflowIDs) != 3 {
+		t.Fatalf("backfill = %+v, want 3 submitted runs", backfill)
+	}
+
+	for i, workflowID := range backfill.WorkflowIDs {
+		workflow, err := stateManager.GetWorkflow(ctx, workflowID)
+		if err != nil {
+			t.Fatalf("failed to get workflow: %v", err)
+		}
+		want := start.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+		if workflow.Input["scheduled_time"] != want || workflow.Input["backfill_id"] != backfill.ID {
+			t.Errorf("run %d input = %v, want scheduled_time %s and the backfill ID", i, workflow.Input, want)
+		}
+	}
+
+	// Progress lives in the state store, so another engine sees it
+	logger := zap.NewNop()
+	other := NewEngine(stateManager, queue.NewMemoryTaskQueue(logger, stateManager), logger)
+	seen, err := other.GetBackfill(ctx, backfill.ID)
+	if err != nil || seen.State != pkg.BackfillStateCompleted {
+		t.Errorf("backfill from another engine = %+v, %v", seen, err)
+	}
+}
+
+func TestBackfillMaxConcurrent(t *testing.T) {
+	t.Parallel()
+
+	engine, _ := newScheduleTestEngine(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	backfill, err := engine.Backfill(context.Background(), pkg.BackfillRequest{
+		WorkflowName:  "wait",
+		Interval:      time.Hour,
+		Start:         start,
+		End:           start.Add(2 * time.Hour),
+		MaxConcurrent: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to start backfill: %v", err)
+	}
+
+	backfill = waitForBackfill(t, engine, backfill.ID, func(b *pkg.Backfill) bool {
+		return len(b.WorkflowIDs) == 1
+	})
+	time.Sleep(1500 * time.Millisecond)
+	if current, _ := engine.GetBackfill(context.Background(), backfill.ID); len(current.WorkflowIDs) != 1 {
+		t.Fatalf("submitted %d runs while the first was active, want 1", len(current.WorkflowIDs))
+	}
+
+	finishRun(t, engine, backfill.WorkflowIDs[0])
+	backfill = waitForBackfill(t, engine, backfill.ID, func(b *pkg.Backfill) bool {
+		return b.State != pkg.BackfillStateRunning
+	})
+	if backfill.State != pkg.BackfillStateCompleted || len(backfill.WorkflowIDs) != 2 {
+		t.Errorf("backfill = %+v, want both runs once the first finished", backfill)
+	}
+}
@@ -0,0 +1,175 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// concurrencyLimit reports the per-key limit of a definition and whether it
+// has one at all.
+func concurrencyLimit(definition pkg.WorkflowDefinition) (int, bool) {
+	if definition.MaxConcurrency > 0 {
+		return definition.MaxConcurrency, true
+	}
+	if definition.ConcurrencyKey != nil {
+		return 1, true
+	}
+	return 0, false
+}
+
+// concurrencyKey evaluates the definition's key expression against input.
+func concurrencyKey(definition pkg.WorkflowDefinition, input map[string]interface{}) string {
+	if definition.ConcurrencyKey == nil {
+		return ""
+	}
+	return definition.ConcurrencyKey(input)
+}
+
+// concurrencySlotKey scopes a concurrency key to its workflow definition so
+// different workflows can use the same keys independently.
+func concurrencySlotKey(workflow *pkg.Workflow) string {
+	return workflow.Name + ":" + workflow.ConcurrencyKey
+}
+
+func (e *Engine) concurrencyStore() (pkg.ConcurrencyStore, error) {
+	store, ok := e.stateManager.(pkg.ConcurrencyStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not support concurrency limits")
+	}
+	return store, nil
+}
+
+// admitWorkflow takes a concurrency slot for a new workflow of a limited
+// definition. When none is free the workflow is queued with a waiting reason,
+// or rejected under pkg.ConcurrencyReject. It reports whether the workflow
+// may start right away.
+func (e *Engine) admitWorkflow(ctx context.Context, workflow *pkg.Workflow, definition pkg.WorkflowDefinition) (bool, error) {
+	limit, limited := concurrencyLimit(definition)
+	if !limited {
+		return true, nil
+	}
+
+	store, err := e.concurrencyStore()
+	if err != nil {
+		return false, err
+	}
+
+	workflow.ConcurrencyKey = concurrencyKey(definition, workflow.Input)
+	acquired, err := store.AcquireConcurrencySlot(ctx, concurrencySlotKey(workflow), workflow.ID, limit)
+	if err != nil {
+		return false, err
+	}
+	if acquired {
+		return true, nil
+	}
+
+	if definition.ConcurrencyPolicy == pkg.ConcurrencyReject {
+		return false, fmt.Errorf("%w: %d running for key %q", pkg.ErrConcurrencyLimit, limit, workflow.ConcurrencyKey)
+	}
+
+	workflow.WaitingReason = fmt.Sprintf("waiting for concurrency slot: %d running for key %q", limit, workflow.ConcurrencyKey)
+	return false, nil
+}
+
+// releaseConcurrencySlot frees the slot of a workflow whose run returned and
+// lets queued workflows take it. A workflow left running, by an engine
+// shutdown, keeps its slot for the run resumed on the next Start, and one
+// resubmitted under the same ID leaves the slot to the new run; any other
+// workflow, including one that could not be loaded or started, gives it up.
+func (e *Engine) releaseConcurrencySlot(ctx context.Context, workflow *pkg.Workflow, definition pkg.WorkflowDefinition) {
+	if _, limited := concurrencyLimit(definition); !limited {
+		return
+	}
+
+	current, err := e.stateManager.GetWorkflow(ctx, workflow.ID)
+	if err != nil {
+		e.logger.Warn("Failed to get workflow for concurrency release, releasing its slot", zap.String("workflow_id", workflow.ID), zap.Error(err))
+	} else if current.State == pkg.WorkflowStateRunning || !current.CreatedAt.Equal(workflow.CreatedAt) {
+		return
+	}
+
+	if e.freeConcurrencySlot(ctx, workflow) {
+		go e.dispatchQueuedWorkflows(context.Background())
+	}
+}
+
+func (e *Engine) freeConcurrencySlot(ctx context.Context, workflow *pkg.Workflow) bool {
+	store, err := e.concurrencyStore()
+	if err != nil {
+		return false
+	}
+	if err := store.ReleaseConcurrencySlot(ctx, concurrencySlotKey(workflow), workflow.ID); err != nil {
+		e.logger.Error("Failed to release concurrency slot", zap.String("workflow_id", workflow.ID), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// dispatchQueuedWorkflows starts queued workflows whose concurrency key has a
+// free slot, oldest first. Once a key is full, younger workflows queued
+// behind it keep waiting so each key is served in submission order.
+func (e *Engine) dispatchQueuedWorkflows(ctx context.Context) {
+	const pageSize = 100
+
+	e.dispatchMu.Lock()
+	defer e.dispatchMu.Unlock()
+
+	store, ok := e.stateManager.(pkg.ConcurrencyStore)
+	if !ok {
+		return
+	}
+
+	var queued []*pkg.Workflow
+	for offset := 0; ; offset += pageSize {
+		workflows, err := e.stateManager.ListWorkflows(ctx, pageSize, offset)
+		if err != nil {
+			e.logger.Error("Failed to list workflows for dispatch", zap.Error(err))
+			return
+		}
+
+		for _, workflow := range workflows {
+			if workflow.State == pkg.WorkflowStatePending && workflow.WaitingReason != "" {
+				queued = append(queued, workflow)
+			}
+		}
+
+		if len(workflows) < pageSize {
+			break
+		}
+	}
+
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].CreatedAt.Before(queued[j].CreatedAt)
+	})
+
+	full := make(map[string]bool)
+	for _, workflow := range queued {
+		e.mu.RLock()
+		definition, exists := e.definitions[workflow.Name]
+		e.mu.RUnlock()
+
+		limit, limited := concurrencyLimit(definition)
+		slotKey := concurrencySlotKey(workflow)
+		if !exists || !limited || full[slotKey] {
+			continue
+		}
+
+		acquired, err := store.AcquireConcurrencySlot(ctx, slotKey, workflow.ID, limit)
+		if err != nil {
+			e.logger.Error("Failed to acquire concurrency slot", zap.String("workflow_id", workflow.ID), zap.Error(err))
+			continue
+		}
+		if !acquired {
+			full[slotKey] = true
+			continue
+		}
+
+		e.logger.Info("Starting queued workflow", zap.String("workflow_id", workflow.ID), zap.String("concurrency_key", workflow.ConcurrencyKey))
+		go e.executeWorkflow(context.Background(), workflow, definition)
+	}
+}
@@ -2,7 +2,11 @@ package workflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,14 +15,27 @@ import (
 	"github.com/XXueTu/temjob/pkg"
 )
 
+// errRunInterrupted stops a workflow run without changing its persisted state,
+// e.g. when the engine shuts down; the run is resumed on the next Start.
+var errRunInterrupted = errors.New("workflow run interrupted")
+
+// errWorkflowEnded stops a run whose workflow was canceled, or otherwise
+// ended, outside of the run.
+var errWorkflowEnded = errors.New("workflow already ended")
+
 type Engine struct {
 	stateManager pkg.StateManager
 	taskQueue    pkg.TaskQueue
 	logger       *zap.Logger
 	definitions  map[string]pkg.WorkflowDefinition
+	runs         map[string]*workflowRun
 	mu           sync.RWMutex
+	dispatchMu   sync.Mutex
 	running      bool
 	stopCh       chan struct{}
+
+	webhookClient *http.Client
+	webhookSecret string
 }
 
 func NewEngine(stateManager pkg.StateManager, taskQueue pkg.TaskQueue, logger *zap.Logger) *Engine {
@@ -27,7 +44,10 @@ func NewEngine(stateManager pkg.StateManager, taskQueue pkg.TaskQueue, logger *z
 		taskQueue:    taskQueue,
 		logger:       logger,
 		definitions:  make(map[string]pkg.WorkflowDefinition),
+		runs:         make(map[string]*workflowRun),
 		stopCh:       make(chan struct{}),
+
+		webhookClient: &http.Client{Timeout: webhookTimeout},
 	}
 }
 
@@ -36,18 +56,90 @@ func (e *Engine) RegisterWorkflow(definition pkg.WorkflowDefinition) {
 	defer e.mu.Unlock()
 	e.definitions[definition.Name] = definition
 	e.logger.Info("Workflow registered", zap.String("name", definition.Name))
+
+	if limiter, ok := e.taskQueue.(pkg.RateLimiter); ok {
+		for taskType, taskDef := range definition.Tasks {
+			if taskDef.RateLimit == nil {
+				continue
+			}
+			if err := limiter.SetRateLimit(context.Background(), taskType, *taskDef.RateLimit); err != nil {
+				e.logger.Error("Failed to set rate limit", zap.String("task_type", taskType), zap.Error(err))
+			}
+		}
+	}
+}
+
+// ListDefinitions describes the registered workflow definitions, sorted by
+// name.
+func (e *Engine) ListDefinitions() []pkg.DefinitionInfo {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	definitions := make([]pkg.DefinitionInfo, 0, len(e.definitions))
+	for name, definition := range e.definitions {
+		info := pkg.DefinitionInfo{Name: name, Tasks: make([]string, 0, len(definition.Tasks))}
+		for taskType := range definition.Tasks {
+			info.Tasks = append(info.Tasks, taskType)
+		}
+		for queryName := range definition.Queries {
+			info.Queries = append(info.Queries, queryName)
+		}
+		sort.Strings(info.Tasks)
+		sort.Strings(info.Queries)
+		definitions = append(definitions, info)
+	}
+
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+	return definitions
 }
 
 func (e *Engine) SubmitWorkflow(ctx context.Context, workflowName string, input map[string]interface{}) (string, error) {
+	return e.SubmitWorkflowWithOptions(ctx, workflowName, input, pkg.SubmitOptions{})
+}
+
+// SubmitWorkflowWithOptions submits a workflow, optionally under a
+// caller-supplied ID. When the ID is taken and options.IDReusePolicy forbids
+// reuse, it returns that ID with an error wrapping pkg.ErrWorkflowExists so
+// retried submissions can pick up the original run.
+func (e *Engine) SubmitWorkflowWithOptions(ctx context.Context, workflowName string, input map[string]interface{}, options pkg.SubmitOptions) (string, error) {
 	e.mu.RLock()
 	definition, exists := e.definitions[workflowName]
 	e.mu.RUnlock()
 
 	if !exists {
-		return "", fmt.Errorf("workflow definition not found: %s", workflowName)
+		return "", fmt.Errorf("%w: %s", pkg.ErrDefinitionNotFound, workflowName)
+	}
+
+	if definition.ValidateInput != nil {
+		if err := definition.ValidateInput(input); err != nil {
+			return "", fmt.Errorf("%w: %v", pkg.ErrInvalidInput, err)
+		}
+	}
+
+	for _, webhook := range options.Webhooks {
+		if err := webhook.Validate(); err != nil {
+			return "", fmt.Errorf("%w: %v", pkg.ErrInvalidInput, err)
+		}
+	}
+	if (len(definition.Webhooks) > 0 || len(options.Webhooks) > 0) && e.signingSecret() == "" {
+		return "", fmt.Errorf("%w: webhooks require a signing secret", pkg.ErrInvalidInput)
+	}
+
+	workflowID := options.WorkflowID
+	if workflowID == "" {
+		workflowID = pkg.NewWorkflowID()
+	} else if len(workflowID) > pkg.MaxWorkflowIDLength {
+		return "", fmt.Errorf("workflow ID exceeds %d characters", pkg.MaxWorkflowIDLength)
+	}
+
+	switch options.IDReusePolicy {
+	case "", pkg.WorkflowIDReuseRejectDuplicate, pkg.WorkflowIDReuseAllowFailed, pkg.WorkflowIDReuseRejectRunning:
+	default:
+		return "", fmt.Errorf("unknown workflow ID reuse policy: %s", options.IDReusePolicy)
 	}
 
-	workflowID := pkg.NewWorkflowID()
 	workflow := &pkg.Workflow{
 		ID:        workflowID,
 		Name:      workflowName,
@@ -55,42 +147,132 @@ func (e *Engine) SubmitWorkflow(ctx context.Context, workflowName string, input
 		State:     pkg.WorkflowStatePending,
 		Tasks:     []string{},
 		CreatedAt: time.Now(),
+		Priority:  options.Priority,
+		Webhooks:  append(append([]pkg.Webhook(nil), definition.Webhooks...), options.Webhooks...),
 	}
 
-	if err := e.stateManager.SaveWorkflow(ctx, workflow); err != nil {
-		return "", fmt.Errorf("failed to save workflow: %w", err)
+	if options.WorkflowID != "" {
+		if err := e.awaitEndedRun(ctx, workflowID); err != nil {
+			return "", err
+		}
 	}
 
-	go e.executeWorkflow(context.Background(), workflowID, definition)
+	start, err := e.admitWorkflow(ctx, workflow, definition)
+	if err != nil {
+		return "", err
+	}
+
+	if err := e.createWorkflow(ctx, workflow, options); err != nil {
+		if start {
+			e.freeConcurrencySlot(ctx, workflow)
+		}
+		if errors.Is(err, pkg.ErrWorkflowExists) {
+			return workflowID, err
+		}
+		return "", err
+	}
+
+	e.recordWorkflowEvent(ctx, workflowID, workflow, "", pkg.EventWorkflowSubmitted, "Workflow submitted", map[string]interface{}{
+		"name":           workflowName,
+		"waiting_reason": workflow.WaitingReason,
+	})
+
+	if !start {
+		e.logger.Info("Workflow queued", zap.String("workflow_id", workflowID), zap.String("reason", workflow.WaitingReason))
+		return workflowID, nil
+	}
+
+	go e.executeWorkflow(context.Background(), workflow, definition)
 
 	e.logger.Info("Workflow submitted", zap.String("workflow_id", workflowID), zap.String("name", workflowName))
 	return workflowID, nil
 }
 
+// awaitEndedRun interrupts this engine's run of a workflow that already
+// ended but has not noticed yet, and waits for it to return. A submission
+// reusing the ID then starts its own run, and the stale one can no longer
+// release the new run's concurrency slot.
+func (e *Engine) awaitEndedRun(ctx context.Context, workflowID string) error {
+	e.mu.RLock()
+	run, active := e.runs[workflowID]
+	e.mu.RUnlock()
+	if !active {
+		return nil
+	}
+
+	// CreateWorkflow rejects the ID while the workflow is still active
+	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
+	if err != nil || !workflow.State.Terminal() {
+		return nil
+	}
+
+	run.cancel()
+	select {
+	case <-run.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// createWorkflow persists a new workflow, going through pkg.WorkflowCreator
+// when the caller supplied its ID.
+func (e *Engine) createWorkflow(ctx context.Context, workflow *pkg.Workflow, options pkg.SubmitOptions) error {
+	if options.WorkflowID == "" {
+		if err := e.stateManager.SaveWorkflow(ctx, workflow); err != nil {
+			return fmt.Errorf("failed to save workflow: %w", err)
+		}
+		return nil
+	}
+
+	creator, ok := e.stateManager.(pkg.WorkflowCreator)
+	if !ok {
+		return fmt.Errorf("state manager does not support caller-supplied workflow IDs")
+	}
+
+	policy := options.IDReusePolicy
+	if policy == "" {
+		policy = pkg.WorkflowIDReuseRejectDuplicate
+	}
+
+	if err := creator.CreateWorkflow(ctx, workflow, policy); err != nil {
+		if errors.Is(err, pkg.ErrWorkflowExists) {
+			return err
+		}
+		return fmt.Errorf("failed to save workflow: %w", err)
+	}
+	return nil
+}
+
 func (e *Engine) GetWorkflow(ctx context.Context, workflowID string) (*pkg.Workflow, error) {
 	return e.stateManager.GetWorkflow(ctx, workflowID)
 }
 
 func (e *Engine) CancelWorkflow(ctx context.Context, workflowID string) error {
-	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
+	canceled, err := pkg.UpdateWorkflow(ctx, e.stateManager, workflowID, func(workflow *pkg.Workflow) error {
+		if workflow.State == pkg.WorkflowStateCompleted || workflow.State == pkg.WorkflowStateFailed {
+			return fmt.Errorf("cannot cancel workflow in state: %s", workflow.State)
+		}
+
+		workflow.State = pkg.WorkflowStateCanceled
+		now := time.Now()
+		workflow.EndedAt = &now
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	if workflow.State == pkg.WorkflowStateCompleted || workflow.State == pkg.WorkflowStateFailed {
-		return fmt.Errorf("cannot cancel workflow in state: %s", workflow.State)
-	}
-
-	workflow.State = pkg.WorkflowStateCanceled
-	now := time.Now()
-	workflow.EndedAt = &now
-
-	return e.stateManager.SaveWorkflow(ctx, workflow)
+	e.recordWorkflowEvent(ctx, workflowID, canceled, "", pkg.EventWorkflowCanceled, "Workflow canceled", nil)
+	return nil
 }
 
 func (e *Engine) Start(ctx context.Context) error {
 	e.running = true
 	go e.monitorWorkflows(ctx)
+	go e.resumeWorkflows(ctx)
+	go e.runScheduler(ctx)
+	go e.runWebhookDispatcher(ctx)
 	e.logger.Info("Workflow engine started")
 	return nil
 }
@@ -102,178 +284,500 @@ func (e *Engine) Stop() error {
 	return nil
 }
 
-func (e *Engine) executeWorkflow(ctx context.Context, workflowID string, definition pkg.WorkflowDefinition) {
-	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
+// resumeWorkflows restarts runs for workflows left in the running state by a
+// previous engine process, so pending timers and in-flight tasks still
+// complete after a restart.
+func (e *Engine) resumeWorkflows(ctx context.Context) {
+	const pageSize = 100
+
+	for offset := 0; ; offset += pageSize {
+		workflows, err := e.stateManager.ListWorkflows(ctx, pageSize, offset)
+		if err != nil {
+			e.logger.Error("Failed to list workflows for resume", zap.Error(err))
+			return
+		}
+
+		for _, workflow := range workflows {
+			if workflow.State != pkg.WorkflowStateRunning {
+				continue
+			}
+
+			e.mu.RLock()
+			definition, exists := e.definitions[workflow.Name]
+			_, active := e.runs[workflow.ID]
+			e.mu.RUnlock()
+
+			if !exists || active {
+				continue
+			}
+
+			e.logger.Info("Resuming workflow", zap.String("workflow_id", workflow.ID), zap.String("name", workflow.Name))
+			go e.executeWorkflow(context.Background(), workflow, definition)
+		}
+
+		if len(workflows) < pageSize {
+			return
+		}
+	}
+}
+
+// workflowRun holds the in-memory state of one workflow execution.
+type workflowRun struct {
+	// mu lets queries read context, completed and failed while the run,
+	// their only writer, updates them.
+	mu         sync.RWMutex
+	workflow   *pkg.Workflow
+	definition pkg.WorkflowDefinition
+	context    map[string]interface{}
+	completed  map[string]bool
+	// failed holds steps whose failure was routed to their OnError step;
+	// triggered holds the OnError steps that were activated that way.
+	failed    map[string]bool
+	triggered map[string]bool
+	// existing holds tasks persisted by an earlier execution of the same
+	// workflow, keyed by type, so a resumed run adopts them instead of
+	// submitting duplicates.
+	existing map[string][]*pkg.Task
+	// cancel interrupts the run and done is closed once it returned, so a
+	// submission reusing the workflow ID can wait for it.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// adopt removes and returns the first previously persisted task of taskType
+// accepted by match, or nil when the step has not been submitted before.
+func (r *workflowRun) adopt(taskType string, match func(*pkg.Task) bool) *pkg.Task {
+	tasks := r.existing[taskType]
+	for i, task := range tasks {
+		if match == nil || match(task) {
+			r.existing[taskType] = append(tasks[:i:i], tasks[i+1:]...)
+			return task
+		}
+	}
+	return nil
+}
+
+// executeWorkflow runs a workflow that holds its concurrency slot, if its
+// definition is limited. submitted is the workflow as it was admitted; the
+// run reloads it and releases the slot however it ends.
+func (e *Engine) executeWorkflow(ctx context.Context, submitted *pkg.Workflow, definition pkg.WorkflowDefinition) {
+	workflowID := submitted.ID
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	run := &workflowRun{
+		workflow:   submitted,
+		definition: definition,
+		context:    make(map[string]interface{}),
+		completed:  make(map[string]bool),
+		failed:     make(map[string]bool),
+		triggered:  make(map[string]bool),
+		existing:   make(map[string][]*pkg.Task),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+
+	e.mu.Lock()
+	if _, active := e.runs[workflowID]; active {
+		e.mu.Unlock()
+		return
+	}
+	e.runs[workflowID] = run
+	e.mu.Unlock()
+
+	defer close(run.done)
+	defer func() {
+		e.mu.Lock()
+		delete(e.runs, workflowID)
+		e.mu.Unlock()
+	}()
+	defer func() {
+		e.releaseConcurrencySlot(ctx, run.workflow, definition)
+	}()
+
+	workflow, err := e.stateManager.GetWorkflow(runCtx, workflowID)
 	if err != nil {
 		e.logger.Error("Failed to get workflow", zap.Error(err))
 		return
 	}
+	run.workflow = workflow
+	runCtx = withRunGeneration(runCtx, workflow)
 
-	workflow.State = pkg.WorkflowStateRunning
-	now := time.Now()
-	workflow.StartedAt = &now
-
-	if err := e.stateManager.SaveWorkflow(ctx, workflow); err != nil {
-		e.logger.Error("Failed to update workflow state", zap.Error(err))
+	if workflow.State == pkg.WorkflowStateRunning {
+		tasks, err := e.stateManager.GetWorkflowTasks(runCtx, workflowID)
+		if err != nil {
+			e.logger.Error("Failed to load tasks for resumed workflow", zap.String("workflow_id", workflowID), zap.Error(err))
+			return
+		}
+		for _, task := range tasks {
+			run.existing[task.Type] = append(run.existing[task.Type], task)
+		}
+		e.recordEvent(runCtx, workflowID, "", pkg.EventWorkflowResumed, "Workflow resumed", nil)
+	} else if workflow.State != pkg.WorkflowStatePending {
+		// Canceled while queued for a concurrency slot
 		return
+	} else {
+		started, err := e.updateActiveWorkflow(runCtx, workflowID, func(workflow *pkg.Workflow) {
+			workflow.State = pkg.WorkflowStateRunning
+			workflow.WaitingReason = ""
+			now := time.Now()
+			workflow.StartedAt = &now
+		})
+		if errors.Is(err, errWorkflowEnded) {
+			return
+		}
+		if err != nil {
+			e.logger.Error("Failed to update workflow state", zap.Error(err))
+			return
+		}
+		run.workflow = started
+		e.recordWorkflowEvent(runCtx, workflowID, started, "", pkg.EventWorkflowStarted, "Workflow started", nil)
 	}
 
 	// Execute tasks sequentially according to dependencies
-	e.executeWorkflowTasks(ctx, workflowID, definition)
+	e.executeWorkflowTasks(runCtx, run)
 }
 
-func (e *Engine) executeWorkflowTasks(ctx context.Context, workflowID string, definition pkg.WorkflowDefinition) {
-	completedTasks := make(map[string]*pkg.Task)
-	workflowContext := make(map[string]interface{})
-
-	// Get initial workflow input
-	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
-	if err != nil {
-		e.failWorkflow(ctx, workflowID, fmt.Sprintf("failed to get workflow: %v", err))
-		return
-	}
+func (e *Engine) executeWorkflowTasks(ctx context.Context, run *workflowRun) {
+	workflowID := run.workflow.ID
+	definition := run.definition
 
 	// Copy initial input to context
-	for k, v := range workflow.Input {
-		workflowContext[k] = v
+	run.mu.Lock()
+	for k, v := range run.workflow.Input {
+		run.context[k] = v
 	}
+	run.mu.Unlock()
 
 	for {
-		readyTasks := e.getReadyTasks(definition.Flow, completedTasks, workflowContext)
-		if len(readyTasks) == 0 {
+		if err := e.checkEnded(ctx, workflowID); err != nil {
+			e.stopRun(workflowID, err)
+			return
+		}
+
+		readySteps := e.getReadySteps(run)
+		if len(readySteps) == 0 {
 			break
 		}
 
-		// Submit ready tasks
-		for _, step := range readyTasks {
-			taskDef, exists := definition.Tasks[step.TaskType]
-			if !exists {
-				e.failWorkflow(ctx, workflowID, fmt.Sprintf("task definition not found: %s", step.TaskType))
-				return
+		// Submit ready tasks; map steps submit their items while they run
+		submitted := make(map[string]*pkg.Task)
+		for _, step := range readySteps {
+			var (
+				task *pkg.Task
+				err  error
+			)
+
+			switch step.Kind {
+			case pkg.StepKindMap:
+				if _, exists := definition.Tasks[step.TaskType]; !exists {
+					e.failWorkflow(ctx, workflowID, fmt.Sprintf("task definition not found: %s", step.TaskType))
+					return
+				}
+				continue
+			case pkg.StepKindTimer:
+				task, err = e.startTimer(ctx, run, step)
+			case pkg.StepKindSignal:
+				task, err = e.startSignalWait(ctx, run, step)
+			case pkg.StepKindApproval:
+				task, err = e.startApproval(ctx, run, step)
+			default:
+				taskDef, exists := definition.Tasks[step.TaskType]
+				if !exists {
+					e.failWorkflow(ctx, workflowID, fmt.Sprintf("task definition not found: %s", step.TaskType))
+					return
+				}
+				if task = run.adopt(step.TaskType, nil); task == nil {
+					task, err = e.submitTask(ctx, run.workflow, taskDef, run.context)
+				}
 			}
 
-			taskID := pkg.NewTaskID()
-			task := &pkg.Task{
-				ID:         taskID,
-				WorkflowID: workflowID,
-				Type:       step.TaskType,
-				Input:      workflowContext,
-				State:      pkg.TaskStatePending,
-				MaxRetries: taskDef.MaxRetries,
-				CreatedAt:  time.Now(),
+			if runStopped(err) {
+				e.stopRun(workflowID, err)
+				return
 			}
-
-			if err := e.stateManager.SaveTask(ctx, task); err != nil {
-				e.failWorkflow(ctx, workflowID, fmt.Sprintf("failed to save task: %v", err))
+			if err != nil {
+				e.failWorkflow(ctx, workflowID, err.Error())
 				return
 			}
+			submitted[step.TaskType] = task
+		}
 
-			workflow.Tasks = append(workflow.Tasks, taskID)
-			if err := e.stateManager.SaveWorkflow(ctx, workflow); err != nil {
-				e.failWorkflow(ctx, workflowID, fmt.Sprintf("failed to update workflow: %v", err))
-				return
+		// Wait for submitted tasks to complete
+		for _, step := range readySteps {
+			var (
+				task *pkg.Task
+				err  error
+			)
+
+			switch step.Kind {
+			case pkg.StepKindMap:
+				err = e.executeMapStep(ctx, run, step)
+			case pkg.StepKindTimer:
+				task, err = e.waitForTimer(ctx, submitted[step.TaskType])
+			case pkg.StepKindSignal:
+				task, err = e.waitForSignal(ctx, step, submitted[step.TaskType])
+			case pkg.StepKindApproval:
+				task, err = e.waitForApproval(ctx, step, submitted[step.TaskType])
+			default:
+				task, err = e.waitForTaskCompletion(ctx, submitted[step.TaskType].ID)
 			}
 
-			if err := e.taskQueue.Enqueue(ctx, task); err != nil {
-				e.failWorkflow(ctx, workflowID, fmt.Sprintf("failed to enqueue task: %v", err))
+			if runStopped(err) {
+				e.stopRun(workflowID, err)
 				return
 			}
-
-			e.logger.Info("Task submitted", zap.String("task_id", taskID), zap.String("type", step.TaskType))
-		}
-
-		// Wait for submitted tasks to complete
-		for _, step := range readyTasks {
-			if err := e.waitForTaskCompletion(ctx, workflowID, step.TaskType, completedTasks, workflowContext); err != nil {
-				e.failWorkflow(ctx, workflowID, fmt.Sprintf("task %s failed: %v", step.TaskType, err))
+			if err != nil && step.OnError != "" {
+				e.routeToErrorPath(run, step, err)
+				continue
+			}
+			if err != nil {
+				e.failWorkflow(ctx, workflowID, fmt.Sprintf("%s step %s failed: %v", stepKind(step), step.TaskType, err))
 				return
 			}
+
+			run.mu.Lock()
+			run.completed[step.TaskType] = true
+			// Merge task output into workflow context
+			if task != nil {
+				for k, v := range task.Output {
+					run.context[k] = v
+				}
+			}
+			run.mu.Unlock()
 		}
 
-		if len(completedTasks) == len(definition.Flow) {
+		if len(run.completed)+len(run.failed) == len(definition.Flow) {
 			break
 		}
 	}
 
 	// Complete workflow
-	workflow.State = pkg.WorkflowStateCompleted
-	now := time.Now()
-	workflow.EndedAt = &now
-	workflow.Output = workflowContext
-
-	if err := e.stateManager.SaveWorkflow(ctx, workflow); err != nil {
+	completed, err := e.updateActiveWorkflow(ctx, workflowID, func(workflow *pkg.Workflow) {
+		workflow.State = pkg.WorkflowStateCompleted
+		now := time.Now()
+		workflow.EndedAt = &now
+		workflow.Output = run.context
+	})
+	if errors.Is(err, errWorkflowEnded) {
+		e.stopRun(workflowID, err)
+		return
+	}
+	if err != nil {
 		e.logger.Error("Failed to complete workflow", zap.Error(err))
 		return
 	}
 
+	e.recordWorkflowEvent(ctx, workflowID, completed, "", pkg.EventWorkflowCompleted, "Workflow completed", nil)
+
 	e.logger.Info("Workflow completed", zap.String("workflow_id", workflowID))
 }
 
-func (e *Engine) waitForTaskCompletion(ctx context.Context, workflowID, taskType string, completedTasks map[string]*pkg.Task, workflowContext map[string]interface{}) error {
-	// Find the task by type in the workflow
+func stepKind(step pkg.WorkflowStep) pkg.StepKind {
+	if step.Kind == "" {
+		return pkg.StepKindTask
+	}
+	return step.Kind
+}
+
+// checkEnded reports errWorkflowEnded once the persisted workflow has been
+// canceled or otherwise ended, so long-running steps stop scheduling further
+// work.
+func (e *Engine) checkEnded(ctx context.Context, workflowID string) error {
 	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
 	if err != nil {
-		return err
+		return nil
+	}
+	if workflow.State.Terminal() || replaced(ctx, workflow) {
+		return errWorkflowEnded
 	}
+	return nil
+}
 
-	var targetTask *pkg.Task
-	for _, taskID := range workflow.Tasks {
-		task, err := e.stateManager.GetTask(ctx, taskID)
-		if err != nil {
-			continue
+// runStopped reports whether err ends the run without settling the
+// workflow, because the engine is stopping or the workflow already ended.
+func runStopped(err error) bool {
+	return errors.Is(err, errRunInterrupted) || errors.Is(err, errWorkflowEnded)
+}
+
+// runGenerationKey carries the CreatedAt of the workflow a run executes.
+// A submission reusing the workflow ID stores a new CreatedAt, so a run of
+// the previous workflow, on any engine, treats the new one as ended.
+type runGenerationKey struct{}
+
+func withRunGeneration(ctx context.Context, workflow *pkg.Workflow) context.Context {
+	return context.WithValue(ctx, runGenerationKey{}, workflow.CreatedAt)
+}
+
+// replaced reports whether workflow was resubmitted under its ID after the
+// run of ctx started.
+func replaced(ctx context.Context, workflow *pkg.Workflow) bool {
+	createdAt, ok := ctx.Value(runGenerationKey{}).(time.Time)
+	return ok && !createdAt.Equal(workflow.CreatedAt)
+}
+
+// updateActiveWorkflow applies update to the stored workflow unless it has
+// already ended, or was replaced by a later submission, in which case
+// nothing is written and errWorkflowEnded is returned. Runs write through it
+// so they never overwrite a concurrent cancellation with their own stale
+// copy.
+func (e *Engine) updateActiveWorkflow(ctx context.Context, workflowID string, update func(*pkg.Workflow)) (*pkg.Workflow, error) {
+	return pkg.UpdateWorkflow(ctx, e.stateManager, workflowID, func(workflow *pkg.Workflow) error {
+		if workflow.State.Terminal() || replaced(ctx, workflow) {
+			return errWorkflowEnded
 		}
-		if task.Type == taskType && task.State != pkg.TaskStateCompleted && task.State != pkg.TaskStateFailed {
-			targetTask = task
-			break
+		update(workflow)
+		return nil
+	})
+}
+
+func (e *Engine) stopRun(workflowID string, reason error) {
+	e.logger.Info("Workflow run stopped", zap.String("workflow_id", workflowID), zap.String("reason", reason.Error()))
+}
+
+// submitTask persists a new task for taskDef, records it on the workflow and
+// enqueues it. The input map is snapshotted so later context changes do not
+// leak into the task.
+func (e *Engine) submitTask(ctx context.Context, workflow *pkg.Workflow, taskDef pkg.TaskDefinition, input map[string]interface{}) (*pkg.Task, error) {
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: workflow.ID,
+		Type:       taskDef.Type,
+		Kind:       pkg.StepKindTask,
+		Input:      copyContext(input),
+		State:      pkg.TaskStatePending,
+		MaxRetries: taskDef.MaxRetries,
+		CreatedAt:  time.Now(),
+		Priority:   workflow.Priority,
+	}
+
+	if err := e.saveNewTask(ctx, workflow, task); err != nil {
+		return nil, err
+	}
+
+	if err := e.taskQueue.Enqueue(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to enqueue task: %w", err)
+	}
+
+	e.logger.Info("Task submitted", zap.String("task_id", task.ID), zap.String("type", task.Type))
+	return task, nil
+}
+
+// saveNewTask persists task and appends it to the workflow's task list,
+// refreshing workflow from the store. It returns errWorkflowEnded when the
+// workflow ended in the meantime.
+func (e *Engine) saveNewTask(ctx context.Context, workflow *pkg.Workflow, task *pkg.Task) error {
+	if err := e.stateManager.SaveTask(ctx, task); err != nil {
+		return fmt.Errorf("failed to save task: %w", err)
+	}
+
+	updated, err := e.updateActiveWorkflow(ctx, workflow.ID, func(current *pkg.Workflow) {
+		// MySQL lists the workflow's tasks from the task table, which
+		// already holds the task saved above
+		if !slices.Contains(current.Tasks, task.ID) {
+			current.Tasks = append(current.Tasks, task.ID)
 		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update workflow: %w", err)
+	}
+	*workflow = *updated
+
+	metadata := map[string]interface{}{"type": task.Type, "kind": task.Kind}
+	if task.WakeAt != nil {
+		metadata["wake_at"] = task.WakeAt
 	}
+	e.recordWorkflowEvent(ctx, workflow.ID, updated, task.ID, pkg.EventTaskScheduled, "Task scheduled: "+task.Type, metadata)
+	return nil
+}
 
-	if targetTask == nil {
-		return fmt.Errorf("task %s not found", taskType)
+func copyContext(input map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(input))
+	for k, v := range input {
+		copied[k] = v
 	}
+	return copied
+}
+
+func (e *Engine) waitForTaskCompletion(ctx context.Context, taskID string) (*pkg.Task, error) {
+	lastEndCheck := time.Now()
 
 	// Poll for task completion
 	for {
-		task, err := e.stateManager.GetTask(ctx, targetTask.ID)
+		task, err := e.stateManager.GetTask(ctx, taskID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		if task.State == pkg.TaskStateCompleted {
-			completedTasks[taskType] = task
-			// Merge task output into workflow context
-			if task.Output != nil {
-				for k, v := range task.Output {
-					workflowContext[k] = v
-				}
-			}
-			e.logger.Info("Task completed", zap.String("task_id", task.ID), zap.String("type", taskType))
-			return nil
+			e.logger.Info("Task completed", zap.String("task_id", task.ID), zap.String("type", task.Type))
+			return task, nil
 		} else if task.State == pkg.TaskStateFailed {
-			return fmt.Errorf("task failed: %s", task.Error)
+			return nil, fmt.Errorf("task failed: %s", task.Error)
+		}
+
+		if now := time.Now(); now.Sub(lastEndCheck) >= endCheckInterval {
+			if err := e.checkEnded(ctx, task.WorkflowID); err != nil {
+				return nil, err
+			}
+			lastEndCheck = now
 		}
 
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return nil, errRunInterrupted
+		case <-e.stopCh:
+			return nil, errRunInterrupted
+		case <-time.After(1 * time.Second):
+		}
 	}
 }
 
-func (e *Engine) getReadyTasks(flow []pkg.WorkflowStep, completed map[string]*pkg.Task, context map[string]interface{}) []pkg.WorkflowStep {
+// routeToErrorPath records a failed step as handled and activates its
+// OnError step. The error is exposed to the handler as "<step>_error";
+// steps depending on the failed step never become ready.
+func (e *Engine) routeToErrorPath(run *workflowRun, step pkg.WorkflowStep, err error) {
+	run.mu.Lock()
+	run.failed[step.TaskType] = true
+	run.triggered[step.OnError] = true
+	run.context[step.TaskType+"_error"] = err.Error()
+	run.mu.Unlock()
+
+	e.logger.Warn("Step failed, routing to error path",
+		zap.String("workflow_id", run.workflow.ID),
+		zap.String("step", step.TaskType),
+		zap.String("on_error", step.OnError),
+		zap.Error(err))
+}
+
+func (e *Engine) getReadySteps(run *workflowRun) []pkg.WorkflowStep {
 	var ready []pkg.WorkflowStep
 
-	for _, step := range flow {
-		if completed[step.TaskType] != nil {
+	// Steps named as another step's OnError only run once triggered
+	errorHandlers := make(map[string]bool)
+	for _, step := range run.definition.Flow {
+		if step.OnError != "" {
+			errorHandlers[step.OnError] = true
+		}
+	}
+
+	for _, step := range run.definition.Flow {
+		if run.completed[step.TaskType] || run.failed[step.TaskType] {
+			continue
+		}
+		if errorHandlers[step.TaskType] && !run.triggered[step.TaskType] {
 			continue
 		}
 
 		allDepsCompleted := true
 		for _, dep := range step.DependsOn {
-			if completed[dep] == nil {
+			if !run.completed[dep] {
 				allDepsCompleted = false
 				break
 			}
 		}
 
-		if allDepsCompleted && (step.Condition == nil || step.Condition(context)) {
+		if allDepsCompleted && (step.Condition == nil || step.Condition(run.context)) {
 			ready = append(ready, step)
 		}
 	}
@@ -281,31 +785,25 @@ func (e *Engine) getReadyTasks(flow []pkg.WorkflowStep, completed map[string]*pk
 	return ready
 }
 
-func (e *Engine) allTasksCompleted(flow []pkg.WorkflowStep, completed map[string]*pkg.Task) bool {
-	for _, step := range flow {
-		if completed[step.TaskType] == nil {
-			return false
-		}
-	}
-	return true
-}
-
+// failWorkflow marks the workflow failed unless it already ended.
 func (e *Engine) failWorkflow(ctx context.Context, workflowID string, reason string) {
-	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
-	if err != nil {
-		e.logger.Error("Failed to get workflow for failure", zap.Error(err))
+	failed, err := e.updateActiveWorkflow(ctx, workflowID, func(workflow *pkg.Workflow) {
+		workflow.State = pkg.WorkflowStateFailed
+		workflow.Error = reason
+		now := time.Now()
+		workflow.EndedAt = &now
+	})
+	if errors.Is(err, errWorkflowEnded) {
+		e.logger.Info("Workflow already ended, not failing it", zap.String("workflow_id", workflowID), zap.String("reason", reason))
 		return
 	}
-
-	workflow.State = pkg.WorkflowStateFailed
-	now := time.Now()
-	workflow.EndedAt = &now
-
-	if err := e.stateManager.SaveWorkflow(ctx, workflow); err != nil {
+	if err != nil {
 		e.logger.Error("Failed to save failed workflow", zap.Error(err))
 		return
 	}
 
+	e.recordWorkflowEvent(ctx, workflowID, failed, "", pkg.EventWorkflowFailed, reason, nil)
+
 	e.logger.Error("Workflow failed", zap.String("workflow_id", workflowID), zap.String("reason", reason))
 }
 
@@ -321,10 +819,25 @@ func (e *Engine) monitorWorkflows(ctx context.Context) {
 			return
 		case <-ticker.C:
 			e.checkWorkflowProgress(ctx)
+			e.dispatchQueuedWorkflows(ctx)
+			e.reclaimExpiredLeases(ctx)
 		}
 	}
 }
 
+// reclaimExpiredLeases retries tasks whose remote worker stopped renewing
+// its lease.
+func (e *Engine) reclaimExpiredLeases(ctx context.Context) {
+	leaser, ok := e.taskQueue.(pkg.TaskLeaser)
+	if !ok {
+		return
+	}
+
+	if _, err := leaser.ReclaimExpiredLeases(ctx); err != nil {
+		e.logger.Error("Failed to reclaim expired task leases", zap.Error(err))
+	}
+}
+
 func (e *Engine) checkWorkflowProgress(ctx context.Context) {
 	workflows, err := e.stateManager.ListWorkflows(ctx, 100, 0)
 	if err != nil {
@@ -340,6 +853,17 @@ func (e *Engine) checkWorkflowProgress(ctx context.Context) {
 }
 
 func (e *Engine) checkWorkflowTasks(ctx context.Context, workflow *pkg.Workflow) {
+	e.mu.RLock()
+	definition := e.definitions[workflow.Name]
+	_, active := e.runs[workflow.ID]
+	e.mu.RUnlock()
+
+	// A run on this engine settles its workflow itself and may still be
+	// handling failed tasks
+	if active {
+		return
+	}
+
 	tasks, err := e.stateManager.GetWorkflowTasks(ctx, workflow.ID)
 	if err != nil {
 		e.logger.Error("Failed to get workflow tasks", zap.Error(err))
@@ -350,10 +874,12 @@ func (e *Engine) checkWorkflowTasks(ctx context.Context, workflow *pkg.Workflow)
 	hasFailures := false
 
 	for _, task := range tasks {
-		if task.State == pkg.TaskStateRunning || task.State == pkg.TaskStatePending || task.State == pkg.TaskStateRetrying {
+		if task.State == pkg.TaskStateRunning || task.State == pkg.TaskStatePending || task.State == pkg.TaskStateRetrying || task.State == pkg.TaskStateWaiting {
 			allCompleted = false
 		}
-		if task.State == pkg.TaskStateFailed && task.RetryCount >= task.MaxRetries {
+		// Failed tasks with retries left are retrying, so a failed task
+		// is final whether it ran out of retries or was non-retryable
+		if task.State == pkg.TaskStateFailed && !failureHandled(definition, task) {
 			hasFailures = true
 		}
 	}
@@ -361,9 +887,33 @@ func (e *Engine) checkWorkflowTasks(ctx context.Context, workflow *pkg.Workflow)
 	if hasFailures {
 		e.failWorkflow(ctx, workflow.ID, "workflow has failed tasks")
 	} else if allCompleted {
-		workflow.State = pkg.WorkflowStateCompleted
-		now := time.Now()
-		workflow.EndedAt = &now
-		e.stateManager.SaveWorkflow(ctx, workflow)
+		completed, err := e.updateActiveWorkflow(ctx, workflow.ID, func(workflow *pkg.Workflow) {
+			workflow.State = pkg.WorkflowStateCompleted
+			now := time.Now()
+			workflow.EndedAt = &now
+		})
+		if err != nil {
+			if !errors.Is(err, errWorkflowEnded) {
+				e.logger.Error("Failed to complete workflow", zap.String("workflow_id", workflow.ID), zap.Error(err))
+			}
+			return
+		}
+		e.recordWorkflowEvent(ctx, workflow.ID, completed, "", pkg.EventWorkflowCompleted, "Workflow completed", nil)
+	}
+}
+
+// failureHandled reports whether the definition absorbs a failure of the
+// task's step, by routing it to an OnError step or collecting it as a map
+// item error, instead of failing the workflow.
+func failureHandled(definition pkg.WorkflowDefinition, task *pkg.Task) bool {
+	for _, step := range definition.Flow {
+		if step.TaskType != task.Type {
+			continue
+		}
+		if step.Kind == pkg.StepKindMap && step.Map != nil && step.Map.FailurePolicy == pkg.MapCollectErrors {
+			return true
+		}
+		return step.OnError != ""
 	}
+	return false
 }
@@ -0,0 +1,51 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+func TestMonitorFailsWorkflowWithNonRetryableTask(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	ctx := context.Background()
+
+	// A task failed as non-retryable keeps its unused retries
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: "orphaned",
+		Type:       "charge",
+		State:      pkg.TaskStateFailed,
+		Error:      "card declined",
+		MaxRetries: 3,
+		CreatedAt:  time.Now(),
+	}
+	workflow := &pkg.Workflow{
+		ID:        "orphaned",
+		Name:      "wait",
+		State:     pkg.WorkflowStateRunning,
+		Tasks:     []string{task.ID},
+		CreatedAt: time.Now(),
+	}
+	if err := stateManager.SaveWorkflow(ctx, workflow); err != nil {
+		t.Fatalf("failed to save workflow: %v", err)
+	}
+	if err := stateManager.SaveTask(ctx, task); err != nil {
+		t.Fatalf("failed to save task: %v", err)
+	}
+
+	// No run on this engine settles the workflow, so the monitor does
+	engine.checkWorkflowTasks(ctx, workflow)
+
+	checked, err := stateManager.GetWorkflow(ctx, workflow.ID)
+	if err != nil {
+		t.Fatalf("failed to get workflow: %v", err)
+	}
+	if checked.State != pkg.WorkflowStateFailed {
+		t.Errorf("workflow state = %s, want failed", checked.State)
+	}
+}
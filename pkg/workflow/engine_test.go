@@ -0,0 +1,111 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+	"github.com/XXueTu/temjob/pkg/state"
+	"github.com/XXueTu/temjob/pkg/worker"
+	"github.com/XXueTu/temjob/pkg/workflow"
+)
+
+// testEnv runs an engine and one worker on the in-memory state manager and
+// task queue.
+type testEnv struct {
+	engine       *workflow.Engine
+	stateManager *state.MemoryStateManager
+}
+
+func newTestEnv(t *testing.T, definitions ...pkg.WorkflowDefinition) *testEnv {
+	t.Helper()
+
+	logger := zap.NewNop()
+	stateManager := state.NewMemoryStateManager()
+	taskQueue := queue.NewMemoryTaskQueue(logger, stateManager)
+	engine := workflow.NewEngine(stateManager, taskQueue, logger)
+	w := worker.NewWorker(taskQueue, stateManager, logger)
+
+	for _, definition := range definitions {
+		engine.RegisterWorkflow(definition)
+		for taskType, taskDef := range definition.Tasks {
+			if taskDef.Handler != nil {
+				w.RegisterTaskHandler(taskType, taskDef.Handler)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := engine.Start(ctx); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+	go w.Start(ctx)
+
+	return &testEnv{engine: engine, stateManager: stateManager}
+}
+
+// wait blocks until the workflow ends and returns it.
+func (env *testEnv) wait(t *testing.T, workflowID string) *pkg.Workflow {
+	t.Helper()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		wf, err := env.engine.GetWorkflow(context.Background(), workflowID)
+		if err != nil {
+			t.Fatalf("failed to get workflow: %v", err)
+		}
+		if wf.State.Terminal() {
+			return wf
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("workflow %s did not end in time", workflowID)
+	return nil
+}
+
+// waitForTask blocks until the workflow has a task of taskType in state.
+func (env *testEnv) waitForTask(t *testing.T, workflowID, taskType string, state pkg.TaskState) *pkg.Task {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		tasks, err := env.stateManager.GetWorkflowTasks(context.Background(), workflowID)
+		if err != nil {
+			t.Fatalf("failed to get tasks: %v", err)
+		}
+		for _, task := range tasks {
+			if task.Type == taskType && task.State == state {
+				return task
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("workflow %s has no %s task in state %s", workflowID, taskType, state)
+	return nil
+}
+
+func (env *testEnv) submit(t *testing.T, name string, input map[string]interface{}) string {
+	t.Helper()
+
+	workflowID, err := env.engine.SubmitWorkflow(context.Background(), name, input)
+	if err != nil {
+		t.Fatalf("failed to submit workflow: %v", err)
+	}
+	return workflowID
+}
+
+func assertState(t *testing.T, wf *pkg.Workflow, state pkg.WorkflowState) {
+	t.Helper()
+	if wf.State != state {
+		t.Fatalf("workflow state = %s (error %q), want %s", wf.State, wf.Error, state)
+	}
+}
+
+func echoHandler(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{"done": true}, nil
+}
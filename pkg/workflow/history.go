@@ -0,0 +1,35 @@
+package workflow
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// recordEvent appends to the workflow history and publishes the event to
+// live subscribers. History is best effort: a failed write is logged and
+// never fails the workflow.
+func (e *Engine) recordEvent(ctx context.Context, workflowID, taskID string, eventType pkg.EventType, message string, metadata map[string]interface{}) {
+	e.recordWorkflowEvent(ctx, workflowID, nil, taskID, eventType, message, metadata)
+}
+
+// recordWorkflowEvent is recordEvent for callers that just wrote workflow,
+// which spares loading it again for its webhooks. workflow may be nil.
+func (e *Engine) recordWorkflowEvent(ctx context.Context, workflowID string, workflow *pkg.Workflow, taskID string, eventType pkg.EventType, message string, metadata map[string]interface{}) {
+	event := &pkg.HistoryEvent{
+		WorkflowID: workflowID,
+		TaskID:     taskID,
+		Type:       eventType,
+		Message:    message,
+		Metadata:   metadata,
+	}
+	if eventType == pkg.EventWorkflowFailed {
+		event.Level = "error"
+	}
+
+	if err := pkg.RecordWorkflowEvent(ctx, e.stateManager, workflow, event); err != nil {
+		e.logger.Warn("Failed to record history event", zap.String("workflow_id", workflowID), zap.String("event", string(eventType)), zap.Error(err))
+	}
+}
@@ -0,0 +1,149 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+type mapItemResult struct {
+	index int
+	task  *pkg.Task
+	err   error
+}
+
+// executeMapStep fans a step out over the list found in the workflow context,
+// keeping at most MaxParallel item tasks in flight, and stores the ordered
+// outputs under the configured result key.
+func (e *Engine) executeMapStep(ctx context.Context, run *workflowRun, step pkg.WorkflowStep) error {
+	workflow := run.workflow
+	workflowContext := run.context
+	taskDef := run.definition.Tasks[step.TaskType]
+
+	if step.Map == nil {
+		return fmt.Errorf("map step %s has no map configuration", step.TaskType)
+	}
+
+	items, err := mapItems(workflowContext[step.Map.ItemsKey])
+	if err != nil {
+		return fmt.Errorf("invalid items under %q: %w", step.Map.ItemsKey, err)
+	}
+
+	parallel := step.Map.MaxParallel
+	if parallel <= 0 || parallel > len(items) {
+		parallel = len(items)
+	}
+
+	results := make([]interface{}, len(items))
+	var itemErrors []interface{}
+
+	// Buffered so abandoned waiters can finish after a fail-fast return
+	resultCh := make(chan mapItemResult, len(items))
+	next, inFlight := 0, 0
+
+	for next < len(items) || inFlight > 0 {
+		for inFlight < parallel && next < len(items) {
+			task := run.adopt(step.TaskType, matchItemIndex(next))
+			if task == nil {
+				input := copyContext(workflowContext)
+				input["item"] = items[next]
+				input["item_index"] = next
+
+				var err error
+				if task, err = e.submitTask(ctx, workflow, taskDef, input); err != nil {
+					return err
+				}
+			}
+
+			go func(index int, taskID string) {
+				task, err := e.waitForTaskCompletion(ctx, taskID)
+				resultCh <- mapItemResult{index: index, task: task, err: err}
+			}(next, task.ID)
+
+			next++
+			inFlight++
+		}
+
+		result := <-resultCh
+		inFlight--
+
+		if runStopped(result.err) {
+			return result.err
+		}
+		if result.err != nil {
+			if step.Map.FailurePolicy != pkg.MapCollectErrors {
+				return fmt.Errorf("item %d: %w", result.index, result.err)
+			}
+			itemErrors = append(itemErrors, map[string]interface{}{
+				"index": result.index,
+				"error": result.err.Error(),
+			})
+			continue
+		}
+
+		results[result.index] = result.task.Output
+	}
+
+	resultKey := mapResultKey(step)
+	run.mu.Lock()
+	workflowContext[resultKey] = results
+	if step.Map.FailurePolicy == pkg.MapCollectErrors {
+		workflowContext[resultKey+"_errors"] = itemErrors
+	}
+	run.mu.Unlock()
+
+	e.logger.Info("Map step completed",
+		zap.String("workflow_id", workflow.ID),
+		zap.String("type", step.TaskType),
+		zap.Int("items", len(items)),
+		zap.Int("failed", len(itemErrors)))
+	return nil
+}
+
+// matchItemIndex selects the persisted task created for item index when a
+// resumed run re-enters a map step. JSON round trips turn the index into a
+// float64, hence the numeric conversion.
+func matchItemIndex(index int) func(*pkg.Task) bool {
+	return func(task *pkg.Task) bool {
+		switch v := task.Input["item_index"].(type) {
+		case int:
+			return v == index
+		case float64:
+			return int(v) == index
+		}
+		return false
+	}
+}
+
+func mapResultKey(step pkg.WorkflowStep) string {
+	if step.Map.ResultKey != "" {
+		return step.Map.ResultKey
+	}
+	return step.TaskType + "_results"
+}
+
+// mapItems accepts any slice or array, which covers both JSON-decoded
+// contexts ([]interface{}) and inputs built directly in Go.
+func mapItems(value interface{}) ([]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if items, ok := value.([]interface{}); ok {
+		return items, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list, got %T", value)
+	}
+
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, nil
+}
@@ -0,0 +1,89 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+func TestMapStepKeepsItemOrder(t *testing.T) {
+	t.Parallel()
+
+	double := func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		item := input["item"].(float64)
+		// Later items finish first so results arrive out of order
+		time.Sleep(time.Duration(4-item) * 20 * time.Millisecond)
+		return map[string]interface{}{"value": item * 2}, nil
+	}
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("map").
+		AddTask("double", double, 0).
+		AddMapStep("double", "items").MaxParallel(2).ResultKey("doubled").Then().
+		Build())
+
+	wf := env.wait(t, env.submit(t, "map", map[string]interface{}{"items": []interface{}{1, 2, 3}}))
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+
+	results, ok := wf.Output["doubled"].([]interface{})
+	if !ok || len(results) != 3 {
+		t.Fatalf("doubled = %#v, want 3 results", wf.Output["doubled"])
+	}
+	for i, result := range results {
+		value := result.(map[string]interface{})["value"].(float64)
+		if want := float64(i+1) * 2; value != want {
+			t.Errorf("result %d = %v, want %v", i, value, want)
+		}
+	}
+}
+
+func TestMapStepFailFast(t *testing.T) {
+	t.Parallel()
+
+	failOdd := func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		if int(input["item"].(float64))%2 == 1 {
+			return nil, pkg.NonRetryable(errors.New("odd item"))
+		}
+		return map[string]interface{}{}, nil
+	}
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("map_fail").
+		AddTask("check", failOdd, 0).
+		AddMapStep("check", "items").Then().
+		Build())
+
+	wf := env.wait(t, env.submit(t, "map_fail", map[string]interface{}{"items": []interface{}{2, 3}}))
+	assertState(t, wf, pkg.WorkflowStateFailed)
+	if !strings.Contains(wf.Error, "odd item") {
+		t.Errorf("error = %q, want the item's error", wf.Error)
+	}
+}
+
+func TestMapStepCollectErrors(t *testing.T) {
+	t.Parallel()
+
+	failOdd := func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		if int(input["item"].(float64))%2 == 1 {
+			return nil, pkg.NonRetryable(errors.New("odd item"))
+		}
+		return map[string]interface{}{"ok": true}, nil
+	}
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("map_collect").
+		AddTask("check", failOdd, 0).
+		AddMapStep("check", "items").CollectErrors().Then().
+		Build())
+
+	wf := env.wait(t, env.submit(t, "map_collect", map[string]interface{}{"items": []interface{}{1, 2, 3}}))
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+
+	itemErrors, _ := wf.Output["check_results_errors"].([]interface{})
+	if len(itemErrors) != 2 {
+		t.Fatalf("check_results_errors = %#v, want 2 errors", wf.Output["check_results_errors"])
+	}
+	results := wf.Output["check_results"].([]interface{})
+	if results[0] != nil || results[1] == nil || results[2] != nil {
+		t.Errorf("check_results = %#v, want only item 1 set", results)
+	}
+}
@@ -0,0 +1,53 @@
+package workflow_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+func TestPanicFailsTask(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("panic").
+		AddTask("boom", func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+			panic("kaboom")
+		}, 0).
+		AddStep("boom").Then().
+		Build())
+
+	workflowID := env.submit(t, "panic", nil)
+	assertState(t, env.wait(t, workflowID), pkg.WorkflowStateFailed)
+
+	task := env.waitForTask(t, workflowID, "boom", pkg.TaskStateFailed)
+	if !strings.Contains(task.Error, "task handler panicked: kaboom") {
+		t.Errorf("task error = %q, want the panic", task.Error)
+	}
+
+	// The worker survived the panic and keeps processing tasks
+	assertState(t, env.wait(t, env.submit(t, "panic", nil)), pkg.WorkflowStateFailed)
+}
+
+func TestPanicIsRetried(t *testing.T) {
+	t.Parallel()
+
+	attempts := make(chan struct{}, 3)
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("panic_retry").
+		AddTask("flaky", func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+			attempts <- struct{}{}
+			if len(attempts) < 2 {
+				panic("first attempt")
+			}
+			return map[string]interface{}{}, nil
+		}, 2).
+		AddStep("flaky").Then().
+		Build())
+
+	assertState(t, env.wait(t, env.submit(t, "panic_retry", nil)), pkg.WorkflowStateCompleted)
+	if len(attempts) != 2 {
+		t.Errorf("attempts = %d, want a retry after the panic", len(attempts))
+	}
+}
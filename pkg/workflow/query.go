@@ -0,0 +1,112 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// QueryWorkflow runs a query registered on the workflow's definition. A run
+// in progress on this engine is queried live; otherwise the state is rebuilt
+// from the persisted workflow and its tasks. Queries never modify state.
+func (e *Engine) QueryWorkflow(ctx context.Context, workflowID, queryName string, args map[string]interface{}) (result interface{}, err error) {
+	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	definition, exists := e.definitions[workflow.Name]
+	run := e.runs[workflowID]
+	e.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", pkg.ErrDefinitionNotFound, workflow.Name)
+	}
+
+	handler, exists := definition.Queries[queryName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", pkg.ErrQueryNotFound, queryName)
+	}
+
+	tasks, err := e.stateManager.GetWorkflowTasks(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	state := pkg.QueryState{Workflow: workflow, Tasks: tasks}
+	if run != nil {
+		run.mu.RLock()
+		state.Context = copyContext(run.context)
+		state.Completed = stepNames(run.completed)
+		state.Failed = stepNames(run.failed)
+		run.mu.RUnlock()
+	} else {
+		rebuildQueryState(&state, definition)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("query %s panicked: %v", queryName, r)
+		}
+	}()
+
+	return handler(state, args)
+}
+
+// rebuildQueryState derives the context and step progress of a workflow that
+// is not running on this engine. Finished workflows use their output;
+// otherwise completed task outputs are merged over the input in creation
+// order, as the run would have done. Map items are not merged since their
+// results only reach the context when the whole map step finishes.
+func rebuildQueryState(state *pkg.QueryState, definition pkg.WorkflowDefinition) {
+	mapSteps := make(map[string]bool)
+	for _, step := range definition.Flow {
+		if step.Kind == pkg.StepKindMap {
+			mapSteps[step.TaskType] = true
+		}
+	}
+
+	tasks := append([]*pkg.Task(nil), state.Tasks...)
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+	})
+
+	completed := make(map[string]bool)
+	failed := make(map[string]bool)
+	workflowContext := copyContext(state.Workflow.Input)
+
+	for _, task := range tasks {
+		if mapSteps[task.Type] {
+			continue
+		}
+		switch task.State {
+		case pkg.TaskStateCompleted:
+			completed[task.Type] = true
+			for k, v := range task.Output {
+				workflowContext[k] = v
+			}
+		case pkg.TaskStateFailed:
+			failed[task.Type] = true
+		}
+	}
+
+	if state.Workflow.Output != nil {
+		workflowContext = copyContext(state.Workflow.Output)
+	}
+
+	state.Context = workflowContext
+	state.Completed = stepNames(completed)
+	state.Failed = stepNames(failed)
+}
+
+func stepNames(steps map[string]bool) []string {
+	names := make([]string, 0, len(steps))
+	for name := range steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
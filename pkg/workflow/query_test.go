@@ -0,0 +1,45 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+	"github.com/XXueTu/temjob/pkg/sdk"
+	"github.com/XXueTu/temjob/pkg/workflow"
+)
+
+func TestQueryWorkflow(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("queried").
+		AddSignalStep("wait", "go", 0).Then().
+		Query("customer", func(state pkg.QueryState, args map[string]interface{}) (interface{}, error) {
+			return state.Context["customer"], nil
+		}).
+		Build())
+	ctx := context.Background()
+
+	workflowID := env.submit(t, "queried", map[string]interface{}{"customer": "alice"})
+	env.waitForTask(t, workflowID, "wait", pkg.TaskStateWaiting)
+
+	result, err := env.engine.QueryWorkflow(ctx, workflowID, "customer", nil)
+	if err != nil || result != "alice" {
+		t.Errorf("query = %v, %v; want alice", result, err)
+	}
+
+	if _, err := env.engine.QueryWorkflow(ctx, workflowID, "missing", nil); !errors.Is(err, pkg.ErrQueryNotFound) {
+		t.Errorf("unknown query: err = %v, want ErrQueryNotFound", err)
+	}
+
+	// An engine that never registered the definition cannot run its queries
+	logger := zap.NewNop()
+	other := workflow.NewEngine(env.stateManager, queue.NewMemoryTaskQueue(logger, env.stateManager), logger)
+	if _, err := other.QueryWorkflow(ctx, workflowID, "customer", nil); !errors.Is(err, pkg.ErrDefinitionNotFound) {
+		t.Errorf("query without the definition: err = %v, want ErrDefinitionNotFound", err)
+	}
+}
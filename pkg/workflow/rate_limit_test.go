@@ -0,0 +1,42 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+func TestRateLimitSpacesTasks(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("limited").
+		AddTask("call", echoHandler, 0).
+		RateLimit("call", 4, 1).
+		AddMapStep("call", "items").Then().
+		Build())
+	ctx := context.Background()
+
+	workflowID := env.submit(t, "limited", map[string]interface{}{"items": []interface{}{1, 2, 3, 4, 5}})
+	assertState(t, env.wait(t, workflowID), pkg.WorkflowStateCompleted)
+
+	tasks, err := env.stateManager.GetWorkflowTasks(ctx, workflowID)
+	if err != nil {
+		t.Fatalf("failed to get tasks: %v", err)
+	}
+	first, last := *tasks[0].StartedAt, *tasks[0].StartedAt
+	for _, task := range tasks[1:] {
+		if task.StartedAt.Before(first) {
+			first = *task.StartedAt
+		}
+		if task.StartedAt.After(last) {
+			last = *task.StartedAt
+		}
+	}
+	// Four tokens at four per second after the first
+	if spread := last.Sub(first); spread < 900*time.Millisecond {
+		t.Errorf("5 tasks started within %v, want them spread over at least 1s", spread)
+	}
+}
@@ -0,0 +1,566 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// scheduleTickInterval is how often the engine looks for due schedules.
+const scheduleTickInterval = time.Second
+
+// maxScheduleIDLength leaves room in a scheduled run's workflow ID, which
+// appends the tick time to the schedule ID, under pkg.MaxWorkflowIDLength.
+const maxScheduleIDLength = 64
+
+// errScheduleChanged aborts a schedule update whose tick another engine or
+// an API call has already moved past.
+var errScheduleChanged = errors.New("schedule changed")
+
+func (e *Engine) scheduleStore() (pkg.ScheduleStore, error) {
+	store, ok := e.stateManager.(pkg.ScheduleStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not support schedules")
+	}
+	return store, nil
+}
+
+func (e *Engine) CreateSchedule(ctx context.Context, schedule *pkg.Schedule) (*pkg.Schedule, error) {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if schedule.ID == "" {
+		schedule.ID = pkg.NewScheduleID()
+	} else if len(schedule.ID) > maxScheduleIDLength {
+		return nil, fmt.Errorf("schedule ID exceeds %d characters", maxScheduleIDLength)
+	} else if _, err := store.GetSchedule(ctx, schedule.ID); err == nil {
+		return nil, fmt.Errorf("schedule already exists: %s", schedule.ID)
+	}
+
+	if err := e.validateSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next, err := nextScheduleTime(schedule, now)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.NextRunAt = &next
+	schedule.LastRunAt = nil
+	schedule.LastWorkflowID = ""
+	schedule.BufferedRuns = nil
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+
+	if err := store.SaveSchedule(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	e.logger.Info("Schedule created", zap.String("schedule_id", schedule.ID), zap.String("workflow", schedule.WorkflowName), zap.Time("next_run_at", next))
+	return schedule, nil
+}
+
+// UpdateSchedule replaces the definition of an existing schedule while
+// keeping its run history. The next run is recomputed from now.
+func (e *Engine) UpdateSchedule(ctx context.Context, schedule *pkg.Schedule) (*pkg.Schedule, error) {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.validateSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next, err := nextScheduleTime(schedule, now)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := store.UpdateSchedule(ctx, schedule.ID, func(existing *pkg.Schedule) error {
+		schedule.NextRunAt = &next
+		schedule.LastRunAt = existing.LastRunAt
+		schedule.LastWorkflowID = existing.LastWorkflowID
+		schedule.BufferedRuns = existing.BufferedRuns
+		schedule.CreatedAt = existing.CreatedAt
+		schedule.UpdatedAt = now
+		*existing = *schedule
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.logger.Info("Schedule updated", zap.String("schedule_id", schedule.ID))
+	return updated, nil
+}
+
+func (e *Engine) GetSchedule(ctx context.Context, scheduleID string) (*pkg.Schedule, error) {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetSchedule(ctx, scheduleID)
+}
+
+func (e *Engine) ListSchedules(ctx context.Context) ([]*pkg.Schedule, error) {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.ListSchedules(ctx)
+}
+
+func (e *Engine) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return err
+	}
+
+	if err := store.DeleteSchedule(ctx, scheduleID); err != nil {
+		return err
+	}
+
+	e.logger.Info("Schedule deleted", zap.String("schedule_id", scheduleID))
+	return nil
+}
+
+func (e *Engine) PauseSchedule(ctx context.Context, scheduleID string) error {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return err
+	}
+
+	_, err = store.UpdateSchedule(ctx, scheduleID, func(schedule *pkg.Schedule) error {
+		schedule.Paused = true
+		schedule.UpdatedAt = time.Now()
+		return nil
+	})
+	return err
+}
+
+// ResumeSchedule unpauses a schedule. Ticks missed while paused are not
+// replayed; the next run is computed from now.
+func (e *Engine) ResumeSchedule(ctx context.Context, scheduleID string) error {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return err
+	}
+
+	_, err = store.UpdateSchedule(ctx, scheduleID, func(schedule *pkg.Schedule) error {
+		now := time.Now()
+		next, err := nextScheduleTime(schedule, now)
+		if err != nil {
+			return err
+		}
+
+		schedule.Paused = false
+		schedule.NextRunAt = &next
+		schedule.UpdatedAt = now
+		return nil
+	})
+	return err
+}
+
+// TriggerSchedule starts a run of the schedule immediately, regardless of
+// its pause state and overlap policy, and returns the workflow ID.
+func (e *Engine) TriggerSchedule(ctx context.Context, scheduleID string) (string, error) {
+	store, err := e.scheduleStore()
+	if err != nil {
+		return "", err
+	}
+
+	schedule, err := store.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return "", err
+	}
+
+	runAt := time.Now()
+	workflowID, err := e.startScheduledRun(ctx, schedule, runAt)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = store.UpdateSchedule(ctx, scheduleID, func(current *pkg.Schedule) error {
+		recordScheduledRun(current, runAt, workflowID)
+		current.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		e.logger.Warn("Failed to record triggered schedule run", zap.String("schedule_id", scheduleID), zap.Error(err))
+	}
+	return workflowID, nil
+}
+
+func (e *Engine) validateSchedule(schedule *pkg.Schedule) error {
+	if schedule.WorkflowName == "" {
+		return fmt.Errorf("schedule workflow name is required")
+	}
+
+	e.mu.RLock()
+	_, exists := e.definitions[schedule.WorkflowName]
+	e.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("workflow definition not found: %s", schedule.WorkflowName)
+	}
+
+	if (schedule.CronExpr == "") == (schedule.Interval <= 0) {
+		return fmt.Errorf("schedule needs exactly one of cron expression or interval")
+	}
+
+	switch schedule.OverlapPolicy {
+	case "":
+		schedule.OverlapPolicy = pkg.OverlapSkip
+	case pkg.OverlapSkip, pkg.OverlapBuffer, pkg.OverlapAllow:
+	default:
+		return fmt.Errorf("invalid overlap policy: %s", schedule.OverlapPolicy)
+	}
+
+	if schedule.Jitter < 0 {
+		return fmt.Errorf("schedule jitter must not be negative")
+	}
+
+	_, err := nextScheduleTime(schedule, time.Now())
+	return err
+}
+
+func (e *Engine) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(scheduleTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.stopCh:
+			return
+		case <-ticker.C:
+			e.checkSchedules(ctx)
+		}
+	}
+}
+
+// checkSchedules fires due schedules. Every engine runs this loop; the
+// workflow ID derived from each tick makes sure only one run starts.
+func (e *Engine) checkSchedules(ctx context.Context) {
+	store, ok := e.stateManager.(pkg.ScheduleStore)
+	if !ok {
+		return
+	}
+
+	schedules, err := store.ListSchedules(ctx)
+	if err != nil {
+		e.logger.Error("Failed to list schedules", zap.Error(err))
+		return
+	}
+
+	now := time.Now()
+	for _, schedule := range schedules {
+		if schedule.Paused || schedule.NextRunAt == nil {
+			continue
+		}
+
+		// Only engines that know the workflow may fire it
+		e.mu.RLock()
+		_, exists := e.definitions[schedule.WorkflowName]
+		e.mu.RUnlock()
+		if !exists {
+			continue
+		}
+
+		if err := e.checkSchedule(ctx, store, schedule, now); err != nil {
+			e.logger.Error("Failed to process schedule", zap.String("schedule_id", schedule.ID), zap.Error(err))
+		}
+	}
+}
+
+func (e *Engine) checkSchedule(ctx context.Context, store pkg.ScheduleStore, schedule *pkg.Schedule, now time.Time) error {
+	if len(schedule.BufferedRuns) > 0 && !e.scheduleRunActive(ctx, schedule) {
+		return e.releaseBufferedRun(ctx, store, schedule)
+	}
+
+	runAt := *schedule.NextRunAt
+	if now.Before(runAt.Add(scheduleJitter(schedule, runAt))) {
+		return nil
+	}
+
+	if schedule.OverlapPolicy != pkg.OverlapAllow && e.scheduleRunActive(ctx, schedule) {
+		buffer := schedule.OverlapPolicy == pkg.OverlapBuffer
+		_, err := store.UpdateSchedule(ctx, schedule.ID, func(current *pkg.Schedule) error {
+			if current.Paused || current.NextRunAt == nil || !current.NextRunAt.Equal(runAt) {
+				return errScheduleChanged
+			}
+			next, err := nextScheduleTime(current, now)
+			if err != nil {
+				return err
+			}
+
+			if buffer {
+				current.BufferedRuns = append(current.BufferedRuns, runAt)
+			}
+			current.NextRunAt = &next
+			current.UpdatedAt = now
+			return nil
+		})
+		if errors.Is(err, errScheduleChanged) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if buffer {
+			e.logger.Info("Schedule run buffered", zap.String("schedule_id", schedule.ID), zap.Time("run_at", runAt))
+		} else {
+			e.logger.Info("Schedule run skipped, previous run still active", zap.String("schedule_id", schedule.ID), zap.Time("run_at", runAt))
+		}
+		return nil
+	}
+
+	// Every engine may submit the tick; its workflow ID lets only one run
+	// start, and a failed submission is retried on the next check
+	workflowID, err := e.startScheduledRun(ctx, schedule, runAt)
+	if err != nil {
+		if !permanentSubmitError(err) {
+			return fmt.Errorf("failed to start scheduled run: %w", err)
+		}
+		e.logger.Error("Failed to start scheduled run", zap.String("schedule_id", schedule.ID), zap.Error(err))
+	}
+
+	// Only the run bookkeeping is written, so a pause or update that landed
+	// since the schedule was listed survives
+	_, err = store.UpdateSchedule(ctx, schedule.ID, func(current *pkg.Schedule) error {
+		if current.NextRunAt != nil && current.NextRunAt.Equal(runAt) {
+			next, err := nextScheduleTime(current, now)
+			if err != nil {
+				return err
+			}
+			current.NextRunAt = &next
+		}
+		recordScheduledRun(current, runAt, workflowID)
+		current.UpdatedAt = now
+		return nil
+	})
+	return err
+}
+
+// releaseBufferedRun starts the oldest buffered tick once the previous run
+// of the schedule has finished.
+func (e *Engine) releaseBufferedRun(ctx context.Context, store pkg.ScheduleStore, schedule *pkg.Schedule) error {
+	runAt := schedule.BufferedRuns[0]
+
+	workflowID, err := e.startScheduledRun(ctx, schedule, runAt)
+	if err != nil {
+		if !permanentSubmitError(err) {
+			return fmt.Errorf("failed to start buffered run: %w", err)
+		}
+		e.logger.Error("Failed to start buffered run", zap.String("schedule_id", schedule.ID), zap.Error(err))
+	}
+
+	_, err = store.UpdateSchedule(ctx, schedule.ID, func(current *pkg.Schedule) error {
+		if len(current.BufferedRuns) > 0 && current.BufferedRuns[0].Equal(runAt) {
+			current.BufferedRuns = current.BufferedRuns[1:]
+		}
+		recordScheduledRun(current, runAt, workflowID)
+		current.UpdatedAt = time.Now()
+		return nil
+	})
+	return err
+}
+
+// startScheduledRun submits the schedule's workflow for the logical time
+// runAt under the workflow ID scheduledWorkflowID derives from both, so a
+// tick already submitted by another engine or an earlier attempt is not
+// started twice. Callers record the run with recordScheduledRun.
+func (e *Engine) startScheduledRun(ctx context.Context, schedule *pkg.Schedule, runAt time.Time) (string, error) {
+	workflowID, err := e.submitScheduledWorkflow(ctx, schedule.ID, schedule.WorkflowName, schedule.InputTemplate, runAt, scheduledWorkflowID(schedule.ID, runAt), nil)
+	if errors.Is(err, pkg.ErrWorkflowExists) {
+		return workflowID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	e.logger.Info("Scheduled workflow started", zap.String("schedule_id", schedule.ID), zap.String("workflow_id", workflowID), zap.Time("run_at", runAt))
+	return workflowID, nil
+}
+
+// scheduledWorkflowID is the workflow ID of the schedule's run at runAt.
+func scheduledWorkflowID(scheduleID string, runAt time.Time) string {
+	return scheduleID + "-" + runAt.UTC().Format(time.RFC3339Nano)
+}
+
+// permanentSubmitError reports whether submitting a scheduled run failed
+// for a reason retrying cannot fix, in which case the tick is given up.
+func permanentSubmitError(err error) bool {
+	return errors.Is(err, pkg.ErrInvalidInput) || errors.Is(err, pkg.ErrDefinitionNotFound) || errors.Is(err, pkg.ErrConcurrencyLimit)
+}
+
+// recordScheduledRun marks workflowID, started for runAt, as the schedule's
+// last run. A run that failed to start, or one older than the recorded run,
+// leaves the recorded run in place.
+func recordScheduledRun(schedule *pkg.Schedule, runAt time.Time, workflowID string) {
+	if workflowID == "" || (schedule.LastRunAt != nil && runAt.Before(*schedule.LastRunAt)) {
+		return
+	}
+	schedule.LastRunAt = &runAt
+	schedule.LastWorkflowID = workflowID
+}
+
+// submitScheduledWorkflow renders the input template for the logical time
+// runAt, injects it as "scheduled_time" along with extra, and submits under
+// workflowID, or a generated ID when it is empty.
+func (e *Engine) submitScheduledWorkflow(ctx context.Context, scheduleID, workflowName string, inputTemplate map[string]interface{}, runAt time.Time, workflowID string, extra map[string]interface{}) (string, error) {
+	input, err := renderScheduleInput(inputTemplate, scheduleTemplateData{
+		ScheduledTime: runAt.Format(time.RFC3339),
+		ScheduleID:    scheduleID,
+		WorkflowName:  workflowName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", pkg.ErrInvalidInput, err)
+	}
+	input["scheduled_time"] = runAt.Format(time.RFC3339)
+	if scheduleID != "" {
+		input["schedule_id"] = scheduleID
+	}
+	for k, v := range extra {
+		input[k] = v
+	}
+
+	return e.SubmitWorkflowWithOptions(ctx, workflowName, input, pkg.SubmitOptions{WorkflowID: workflowID})
+}
+
+func (e *Engine) scheduleRunActive(ctx context.Context, schedule *pkg.Schedule) bool {
+	if schedule.LastWorkflowID == "" {
+		return false
+	}
+
+	workflow, err := e.stateManager.GetWorkflow(ctx, schedule.LastWorkflowID)
+	if err != nil {
+		return false
+	}
+
+	return workflow.State == pkg.WorkflowStatePending || workflow.State == pkg.WorkflowStateRunning
+}
+
+// nextScheduleTime returns the first tick of the schedule strictly after
+// after. Interval schedules stay anchored to their previous tick.
+func nextScheduleTime(schedule *pkg.Schedule, after time.Time) (time.Time, error) {
+	if schedule.CronExpr != "" {
+		spec, loc, err := parseCronSpec(schedule)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return spec.Next(after.In(loc)), nil
+	}
+
+	if schedule.Interval <= 0 {
+		return time.Time{}, fmt.Errorf("schedule interval must be positive")
+	}
+
+	if schedule.NextRunAt == nil || schedule.NextRunAt.After(after) {
+		return after.Add(schedule.Interval), nil
+	}
+
+	next := *schedule.NextRunAt
+	for !next.After(after) {
+		next = next.Add(schedule.Interval)
+	}
+	return next, nil
+}
+
+func parseCronSpec(schedule *pkg.Schedule) (cron.Schedule, *time.Location, error) {
+	loc := time.Local
+	if schedule.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return nil, nil, fmt.Errorf("invalid timezone %q: %w", schedule.Timezone, err)
+		}
+	}
+
+	spec, err := cron.ParseStandard(schedule.CronExpr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression %q: %w", schedule.CronExpr, err)
+	}
+
+	return spec, loc, nil
+}
+
+// scheduleJitter derives a stable delay in [0, Jitter) from the schedule and
+// tick, so every engine agrees on when a jittered tick is due.
+func scheduleJitter(schedule *pkg.Schedule, runAt time.Time) time.Duration {
+	if schedule.Jitter <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%d", schedule.ID, runAt.UnixNano())
+	return time.Duration(h.Sum64() % uint64(schedule.Jitter))
+}
+
+type scheduleTemplateData struct {
+	ScheduledTime string
+	ScheduleID    string
+	WorkflowName  string
+}
+
+// renderScheduleInput copies the input template, rendering every string
+// value that contains template actions.
+func renderScheduleInput(inputTemplate map[string]interface{}, data scheduleTemplateData) (map[string]interface{}, error) {
+	input := make(map[string]interface{}, len(inputTemplate)+2)
+	for k, v := range inputTemplate {
+		rendered, err := renderTemplateValue(v, data)
+		if err != nil {
+			return nil, fmt.Errorf("input template %q: %w", k, err)
+		}
+		input[k] = rendered
+	}
+	return input, nil
+}
+
+func renderTemplateValue(value interface{}, data scheduleTemplateData) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New("input").Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	case map[string]interface{}:
+		return renderScheduleInput(v, data)
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := renderTemplateValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,310 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+	"github.com/XXueTu/temjob/pkg/state"
+)
+
+// newScheduleTestEngine returns an unstarted engine on the in-memory
+// backends knowing a workflow that waits for the "go" signal, so its runs
+// stay active until signaled. The tests drive checkSchedule themselves.
+func newScheduleTestEngine(t *testing.T) (*Engine, *state.MemoryStateManager) {
+	t.Helper()
+
+	logger := zap.NewNop()
+	stateManager := state.NewMemoryStateManager()
+	engine := NewEngine(stateManager, queue.NewMemoryTaskQueue(logger, stateManager), logger)
+	engine.RegisterWorkflow(pkg.WorkflowDefinition{
+		Name:  "wait",
+		Tasks: map[string]pkg.TaskDefinition{},
+		Flow: []pkg.WorkflowStep{{
+			TaskType: "wait",
+			Kind:     pkg.StepKindSignal,
+			Signal:   &pkg.SignalConfig{Name: "go"},
+		}},
+	})
+	t.Cleanup(func() { engine.Stop() })
+	return engine, stateManager
+}
+
+func createTestSchedule(t *testing.T, engine *Engine, policy pkg.OverlapPolicy) *pkg.Schedule {
+	t.Helper()
+
+	schedule, err := engine.CreateSchedule(context.Background(), &pkg.Schedule{
+		ID:            "every-minute",
+		WorkflowName:  "wait",
+		Interval:      time.Minute,
+		OverlapPolicy: policy,
+	})
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	return schedule
+}
+
+// tick runs one scheduler check of the stored schedule at its next run time
+// and returns the schedule as stored afterwards.
+func tick(t *testing.T, engine *Engine, stateManager *state.MemoryStateManager, scheduleID string) *pkg.Schedule {
+	t.Helper()
+
+	ctx := context.Background()
+	schedule, err := stateManager.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	if err := engine.checkSchedule(ctx, stateManager, schedule, *schedule.NextRunAt); err != nil {
+		t.Fatalf("failed to check schedule: %v", err)
+	}
+	if schedule, err = stateManager.GetSchedule(ctx, scheduleID); err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	return schedule
+}
+
+func countWorkflows(t *testing.T, stateManager *state.MemoryStateManager) int {
+	t.Helper()
+
+	workflows, err := stateManager.ListWorkflows(context.Background(), 100, 0)
+	if err != nil {
+		t.Fatalf("failed to list workflows: %v", err)
+	}
+	return len(workflows)
+}
+
+// finishRun signals the schedule's last run and waits for it to complete.
+func finishRun(t *testing.T, engine *Engine, workflowID string) {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := engine.SignalWorkflow(ctx, workflowID, "go", nil); err != nil {
+		t.Fatalf("failed to signal: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		workflow, err := engine.GetWorkflow(ctx, workflowID)
+		if err != nil {
+			t.Fatalf("failed to get workflow: %v", err)
+		}
+		if workflow.State.Terminal() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("workflow %s did not finish", workflowID)
+}
+
+func TestScheduleOverlapSkip(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	created := createTestSchedule(t, engine, pkg.OverlapSkip)
+	firstRunAt := *created.NextRunAt
+
+	schedule := tick(t, engine, stateManager, created.ID)
+	if want := scheduledWorkflowID(created.ID, firstRunAt); schedule.LastWorkflowID != want {
+		t.Fatalf("last workflow = %q, want %q", schedule.LastWorkflowID, want)
+	}
+
+	skippedRunAt := *schedule.NextRunAt
+	schedule = tick(t, engine, stateManager, created.ID)
+	if countWorkflows(t, stateManager) != 1 {
+		t.Errorf("a tick started while the previous run was active")
+	}
+	if !schedule.NextRunAt.After(skippedRunAt) || len(schedule.BufferedRuns) != 0 {
+		t.Errorf("skipped tick: next run %v, buffered %v; want the tick dropped", schedule.NextRunAt, schedule.BufferedRuns)
+	}
+
+	finishRun(t, engine, schedule.LastWorkflowID)
+	tick(t, engine, stateManager, created.ID)
+	if countWorkflows(t, stateManager) != 2 {
+		t.Errorf("no run started once the previous run finished")
+	}
+}
+
+func TestScheduleOverlapBuffer(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	created := createTestSchedule(t, engine, pkg.OverlapBuffer)
+
+	schedule := tick(t, engine, stateManager, created.ID)
+	firstWorkflowID := schedule.LastWorkflowID
+
+	bufferedRunAt := *schedule.NextRunAt
+	schedule = tick(t, engine, stateManager, created.ID)
+	if len(schedule.BufferedRuns) != 1 || !schedule.BufferedRuns[0].Equal(bufferedRunAt) {
+		t.Fatalf("buffered runs = %v, want the tick at %v", schedule.BufferedRuns, bufferedRunAt)
+	}
+	if countWorkflows(t, stateManager) != 1 {
+		t.Errorf("a buffered tick started while the previous run was active")
+	}
+
+	finishRun(t, engine, firstWorkflowID)
+	schedule = tick(t, engine, stateManager, created.ID)
+	if len(schedule.BufferedRuns) != 0 {
+		t.Errorf("buffered runs = %v, want the tick released", schedule.BufferedRuns)
+	}
+	if want := scheduledWorkflowID(created.ID, bufferedRunAt); schedule.LastWorkflowID != want {
+		t.Errorf("last workflow = %q, want the buffered tick's run %q", schedule.LastWorkflowID, want)
+	}
+}
+
+func TestScheduleOverlapAllow(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	created := createTestSchedule(t, engine, pkg.OverlapAllow)
+
+	tick(t, engine, stateManager, created.ID)
+	tick(t, engine, stateManager, created.ID)
+	if n := countWorkflows(t, stateManager); n != 2 {
+		t.Errorf("started %d runs, want both ticks to run", n)
+	}
+}
+
+func TestScheduleTickStartsOnce(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	created := createTestSchedule(t, engine, pkg.OverlapAllow)
+	ctx := context.Background()
+
+	// Two engines that listed the schedule before either fired the tick
+	stale, err := stateManager.GetSchedule(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	runAt := *stale.NextRunAt
+	for i := 0; i < 2; i++ {
+		copied := *stale
+		if err := engine.checkSchedule(ctx, stateManager, &copied, runAt); err != nil {
+			t.Fatalf("check %d failed: %v", i, err)
+		}
+	}
+
+	if n := countWorkflows(t, stateManager); n != 1 {
+		t.Errorf("started %d runs for one tick, want 1", n)
+	}
+	schedule, err := stateManager.GetSchedule(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	if want := runAt.Add(time.Minute); !schedule.NextRunAt.Equal(want) {
+		t.Errorf("next run = %v, want %v", schedule.NextRunAt, want)
+	}
+}
+
+func TestSchedulePauseSurvivesSkippedTick(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	created := createTestSchedule(t, engine, pkg.OverlapSkip)
+	ctx := context.Background()
+
+	tick(t, engine, stateManager, created.ID)
+	stale, err := stateManager.GetSchedule(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	if err := engine.PauseSchedule(ctx, created.ID); err != nil {
+		t.Fatalf("failed to pause: %v", err)
+	}
+
+	if err := engine.checkSchedule(ctx, stateManager, stale, *stale.NextRunAt); err != nil {
+		t.Fatalf("failed to check schedule: %v", err)
+	}
+	schedule, err := stateManager.GetSchedule(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("failed to get schedule: %v", err)
+	}
+	if !schedule.Paused {
+		t.Error("a tick checked from a stale copy unpaused the schedule")
+	}
+}
+
+func TestScheduleJitter(t *testing.T) {
+	t.Parallel()
+
+	schedule := &pkg.Schedule{ID: "jittered", Jitter: 30 * time.Second}
+	runAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	jitter := scheduleJitter(schedule, runAt)
+	if jitter < 0 || jitter >= schedule.Jitter {
+		t.Errorf("jitter = %v, want it within [0, %v)", jitter, schedule.Jitter)
+	}
+	if again := scheduleJitter(schedule, runAt); again != jitter {
+		t.Errorf("jitter = %v then %v, want every engine to agree", jitter, again)
+	}
+
+	varied := false
+	for i := 1; i <= 10; i++ {
+		if scheduleJitter(schedule, runAt.Add(time.Duration(i)*time.Minute)) != jitter {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Error("jitter is the same for every tick")
+	}
+
+	if scheduleJitter(&pkg.Schedule{ID: "plain"}, runAt) != 0 {
+		t.Error("schedule without jitter got a delay")
+	}
+}
+
+func TestJitteredTickWaits(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	created, err := engine.CreateSchedule(context.Background(), &pkg.Schedule{
+		ID:           "jittered",
+		WorkflowName: "wait",
+		Interval:     time.Minute,
+		Jitter:       time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+
+	runAt := *created.NextRunAt
+	jitter := scheduleJitter(created, runAt)
+	ctx := context.Background()
+
+	if jitter > 0 {
+		if err := engine.checkSchedule(ctx, stateManager, created, runAt.Add(jitter-time.Nanosecond)); err != nil {
+			t.Fatalf("failed to check schedule: %v", err)
+		}
+		if countWorkflows(t, stateManager) != 0 {
+			t.Fatal("tick started before its jitter elapsed")
+		}
+	}
+
+	if err := engine.checkSchedule(ctx, stateManager, created, runAt.Add(jitter)); err != nil {
+		t.Fatalf("failed to check schedule: %v", err)
+	}
+	if countWorkflows(t, stateManager) != 1 {
+		t.Error("tick did not start once its jitter elapsed")
+	}
+}
+
+func TestNextScheduleTimeKeepsIntervalAnchor(t *testing.T) {
+	t.Parallel()
+
+	anchor := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := &pkg.Schedule{Interval: 10 * time.Minute, NextRunAt: &anchor}
+
+	// Checked late, the next tick stays on the 10 minute grid
+	next, err := nextScheduleTime(schedule, anchor.Add(25*time.Minute))
+	if err != nil {
+		t.Fatalf("failed to compute next run: %v", err)
+	}
+	if want := anchor.Add(30 * time.Minute); !next.Equal(want) {
+		t.Errorf("next run = %v, want %v", next, want)
+	}
+}
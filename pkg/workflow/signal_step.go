@@ -0,0 +1,159 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// SignalWorkflow delivers a named signal to a workflow. The signal is stored
+// durably and consumed by the first signal step waiting for that name, even
+// if the workflow only reaches that step later.
+func (e *Engine) SignalWorkflow(ctx context.Context, workflowID, signalName string, payload map[string]interface{}) error {
+	store, ok := e.stateManager.(pkg.SignalStore)
+	if !ok {
+		return fmt.Errorf("state manager does not support signals")
+	}
+
+	workflow, err := e.stateManager.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+
+	if workflow.State == pkg.WorkflowStateCompleted || workflow.State == pkg.WorkflowStateFailed || workflow.State == pkg.WorkflowStateCanceled {
+		return fmt.Errorf("%w: cannot signal workflow in state: %s", pkg.ErrWorkflowEnded, workflow.State)
+	}
+
+	signal := &pkg.Signal{
+		ID:         pkg.NewSignalID(),
+		WorkflowID: workflowID,
+		Name:       signalName,
+		Payload:    payload,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := store.SaveSignal(ctx, signal); err != nil {
+		return fmt.Errorf("failed to save signal: %w", err)
+	}
+
+	e.recordEvent(ctx, workflowID, "", pkg.EventSignalReceived, "Signal received: "+signalName, map[string]interface{}{
+		"signal":  signalName,
+		"payload": payload,
+	})
+	e.logger.Info("Signal received", zap.String("workflow_id", workflowID), zap.String("signal", signalName))
+	return nil
+}
+
+// startSignalWait records a signal step as a waiting task. With a timeout,
+// WakeAt holds the deadline so it survives engine restarts.
+func (e *Engine) startSignalWait(ctx context.Context, run *workflowRun, step pkg.WorkflowStep) (*pkg.Task, error) {
+	if task := run.adopt(step.TaskType, nil); task != nil {
+		return task, nil
+	}
+
+	if step.Signal == nil || step.Signal.Name == "" {
+		return nil, fmt.Errorf("signal step %s has no signal name", step.TaskType)
+	}
+
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: run.workflow.ID,
+		Type:       step.TaskType,
+		Kind:       pkg.StepKindSignal,
+		Input:      copyContext(run.context),
+		State:      pkg.TaskStateWaiting,
+		CreatedAt:  time.Now(),
+	}
+	if step.Signal.Timeout > 0 {
+		deadline := task.CreatedAt.Add(step.Signal.Timeout)
+		task.WakeAt = &deadline
+	}
+
+	if err := e.saveNewTask(ctx, run.workflow, task); err != nil {
+		return nil, err
+	}
+
+	e.logger.Info("Waiting for signal", zap.String("task_id", task.ID), zap.String("signal", step.Signal.Name))
+	return task, nil
+}
+
+// waitForSignal waits for the signal step's signal and completes the task
+// with the signal payload as its output.
+func (e *Engine) waitForSignal(ctx context.Context, step pkg.WorkflowStep, task *pkg.Task) (*pkg.Task, error) {
+	return e.awaitSignal(ctx, task, step.Signal.Name, func(task *pkg.Task, signal *pkg.Signal) {
+		task.State = pkg.TaskStateCompleted
+		task.Output = signal.Payload
+	})
+}
+
+// awaitSignal polls the signal store until signalName arrives for the task's
+// workflow, lets deliver settle the task, and persists it. A task left failed
+// by deliver, or one whose WakeAt deadline passes, is reported as an error.
+func (e *Engine) awaitSignal(ctx context.Context, task *pkg.Task, signalName string, deliver func(*pkg.Task, *pkg.Signal)) (*pkg.Task, error) {
+	if task.State == pkg.TaskStateCompleted {
+		return task, nil
+	}
+	if task.State == pkg.TaskStateFailed {
+		return nil, fmt.Errorf("task failed: %s", task.Error)
+	}
+
+	store, ok := e.stateManager.(pkg.SignalStore)
+	if !ok {
+		return nil, fmt.Errorf("state manager does not support signals")
+	}
+
+	lastEndCheck := time.Now()
+	for {
+		signal, err := store.ConsumeSignal(ctx, task.WorkflowID, signalName)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		if signal != nil {
+			deliver(task, signal)
+			task.StartedAt = &signal.CreatedAt
+			task.CompletedAt = &now
+
+			if err := e.stateManager.SaveTask(ctx, task); err != nil {
+				return nil, fmt.Errorf("failed to save signaled task: %w", err)
+			}
+
+			e.logger.Info("Signal consumed", zap.String("task_id", task.ID), zap.String("signal", signal.Name))
+			if task.State == pkg.TaskStateFailed {
+				return nil, fmt.Errorf("task failed: %s", task.Error)
+			}
+			return task, nil
+		}
+
+		if task.WakeAt != nil && now.After(*task.WakeAt) {
+			task.State = pkg.TaskStateFailed
+			task.Error = fmt.Sprintf("timed out waiting for signal %s", signalName)
+			task.CompletedAt = &now
+
+			if err := e.stateManager.SaveTask(ctx, task); err != nil {
+				return nil, fmt.Errorf("failed to save timed out task: %w", err)
+			}
+			return nil, fmt.Errorf("task failed: %s", task.Error)
+		}
+
+		if now.Sub(lastEndCheck) >= endCheckInterval {
+			if err := e.checkEnded(ctx, task.WorkflowID); err != nil {
+				return nil, err
+			}
+			lastEndCheck = now
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errRunInterrupted
+		case <-e.stopCh:
+			return nil, errRunInterrupted
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
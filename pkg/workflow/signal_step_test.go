@@ -0,0 +1,65 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+func TestSignalDeliveredBeforeStepIsKept(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("signal").
+		AddTask("use", echoHandler, 0).
+		AddTimerStep("pause", time.Second).Then().
+		AddSignalStep("approve", "go", 0).DependsOn("pause").Then().
+		AddStep("use").DependsOn("approve").Then().
+		Build())
+
+	ctx := context.Background()
+	workflowID := env.submit(t, "signal", nil)
+	if err := env.engine.SignalWorkflow(ctx, workflowID, "go", map[string]interface{}{"who": "alice"}); err != nil {
+		t.Fatalf("failed to signal: %v", err)
+	}
+
+	wf := env.wait(t, workflowID)
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+	if wf.Output["who"] != "alice" {
+		t.Errorf("output who = %v, want the signal payload merged", wf.Output["who"])
+	}
+}
+
+func TestSignalStepTimesOut(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("signal_timeout").
+		AddSignalStep("wait", "never", time.Second).Then().
+		Build())
+
+	wf := env.wait(t, env.submit(t, "signal_timeout", nil))
+	assertState(t, wf, pkg.WorkflowStateFailed)
+	if !strings.Contains(wf.Error, "timed out waiting for signal never") {
+		t.Errorf("error = %q, want a signal timeout", wf.Error)
+	}
+}
+
+func TestSignalToEndedWorkflowIsRejected(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("done").
+		AddTask("t", echoHandler, 0).
+		AddStep("t").Then().
+		Build())
+
+	workflowID := env.submit(t, "done", nil)
+	env.wait(t, workflowID)
+	err := env.engine.SignalWorkflow(context.Background(), workflowID, "late", nil)
+	if !errors.Is(err, pkg.ErrWorkflowEnded) {
+		t.Errorf("signal to a completed workflow: err = %v, want ErrWorkflowEnded", err)
+	}
+}
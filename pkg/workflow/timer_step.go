@@ -0,0 +1,119 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// endCheckInterval bounds how long a canceled workflow keeps waiting on a
+// timer, signal or task before its run notices the cancellation.
+const endCheckInterval = 5 * time.Second
+
+// startTimer records a timer step as a waiting task whose WakeAt is the
+// durable fire time. A resumed run adopts the existing task so the original
+// deadline is kept across engine restarts.
+func (e *Engine) startTimer(ctx context.Context, run *workflowRun, step pkg.WorkflowStep) (*pkg.Task, error) {
+	if task := run.adopt(step.TaskType, nil); task != nil {
+		return task, nil
+	}
+
+	if step.Timer == nil {
+		return nil, fmt.Errorf("timer step %s has no timer configuration", step.TaskType)
+	}
+
+	wakeAt, err := timerWakeAt(step.Timer, run.context)
+	if err != nil {
+		return nil, fmt.Errorf("timer step %s: %w", step.TaskType, err)
+	}
+
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: run.workflow.ID,
+		Type:       step.TaskType,
+		Kind:       pkg.StepKindTimer,
+		Input:      copyContext(run.context),
+		State:      pkg.TaskStateWaiting,
+		CreatedAt:  time.Now(),
+		WakeAt:     &wakeAt,
+	}
+
+	if err := e.saveNewTask(ctx, run.workflow, task); err != nil {
+		return nil, err
+	}
+
+	e.logger.Info("Timer started", zap.String("task_id", task.ID), zap.String("type", task.Type), zap.Time("wake_at", wakeAt))
+	return task, nil
+}
+
+// waitForTimer blocks until the timer task's WakeAt and then marks it
+// completed. Engine shutdown interrupts the wait without touching the task.
+func (e *Engine) waitForTimer(ctx context.Context, task *pkg.Task) (*pkg.Task, error) {
+	if task.State == pkg.TaskStateCompleted {
+		return task, nil
+	}
+
+	for {
+		remaining := time.Until(*task.WakeAt)
+		if remaining <= 0 {
+			break
+		}
+		if remaining > endCheckInterval {
+			remaining = endCheckInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errRunInterrupted
+		case <-e.stopCh:
+			return nil, errRunInterrupted
+		case <-time.After(remaining):
+		}
+
+		if err := e.checkEnded(ctx, task.WorkflowID); err != nil {
+			return nil, err
+		}
+	}
+
+	task.State = pkg.TaskStateCompleted
+	now := time.Now()
+	task.StartedAt = task.WakeAt
+	task.CompletedAt = &now
+
+	if err := e.stateManager.SaveTask(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to save fired timer: %w", err)
+	}
+
+	e.recordEvent(ctx, task.WorkflowID, task.ID, pkg.EventTimerFired, "Timer fired: "+task.Type, nil)
+	e.logger.Info("Timer fired", zap.String("task_id", task.ID), zap.String("type", task.Type))
+	return task, nil
+}
+
+func timerWakeAt(config *pkg.TimerConfig, workflowContext map[string]interface{}) (time.Time, error) {
+	if config.UntilKey == "" {
+		return time.Now().Add(config.Duration), nil
+	}
+
+	switch v := workflowContext[config.UntilKey].(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		wakeAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp under %q: %w", config.UntilKey, err)
+		}
+		return wakeAt, nil
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case int:
+		return time.Unix(int64(v), 0), nil
+	default:
+		return time.Time{}, fmt.Errorf("no timestamp under %q", config.UntilKey)
+	}
+}
@@ -0,0 +1,87 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+	"github.com/XXueTu/temjob/pkg/sdk"
+	"github.com/XXueTu/temjob/pkg/state"
+	"github.com/XXueTu/temjob/pkg/workflow"
+)
+
+func TestTimerStepDelaysNextStep(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("timer").
+		AddTask("after", echoHandler, 0).
+		AddTimerStep("pause", 1500*time.Millisecond).Then().
+		AddStep("after").DependsOn("pause").Then().
+		Build())
+
+	workflowID := env.submit(t, "timer", nil)
+	wf := env.wait(t, workflowID)
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+
+	timer := env.waitForTask(t, workflowID, "pause", pkg.TaskStateCompleted)
+	after := env.waitForTask(t, workflowID, "after", pkg.TaskStateCompleted)
+	if timer.WakeAt == nil || after.CreatedAt.Before(*timer.WakeAt) {
+		t.Errorf("after step created at %v, before the timer fired at %v", after.CreatedAt, timer.WakeAt)
+	}
+}
+
+func TestTimerUntilStepInThePast(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("timer_until").
+		AddTimerUntilStep("until", "fire_at").Then().
+		Build())
+
+	input := map[string]interface{}{"fire_at": time.Now().Add(-time.Minute).Format(time.RFC3339)}
+	wf := env.wait(t, env.submit(t, "timer_until", input))
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+}
+
+func TestTimerSurvivesEngineRestart(t *testing.T) {
+	t.Parallel()
+
+	logger := zap.NewNop()
+	stateManager := state.NewMemoryStateManager()
+	taskQueue := queue.NewMemoryTaskQueue(logger, stateManager)
+	definition := sdk.NewWorkflowBuilder("restart").
+		AddTimerStep("pause", 2*time.Second).Then().
+		Build()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	first := workflow.NewEngine(stateManager, taskQueue, logger)
+	first.RegisterWorkflow(definition)
+	workflowID, err := first.SubmitWorkflow(ctx, "restart", nil)
+	if err != nil {
+		t.Fatalf("failed to submit workflow: %v", err)
+	}
+
+	env := &testEnv{engine: first, stateManager: stateManager}
+	timer := env.waitForTask(t, workflowID, "pause", pkg.TaskStateWaiting)
+	if err := first.Stop(); err != nil {
+		t.Fatalf("failed to stop engine: %v", err)
+	}
+
+	second := workflow.NewEngine(stateManager, taskQueue, logger)
+	second.RegisterWorkflow(definition)
+	if err := second.Start(ctx); err != nil {
+		t.Fatalf("failed to start engine: %v", err)
+	}
+
+	env.engine = second
+	wf := env.wait(t, workflowID)
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+	if wf.EndedAt.Before(*timer.WakeAt) {
+		t.Errorf("workflow ended at %v, before the original timer deadline %v", wf.EndedAt, timer.WakeAt)
+	}
+}
@@ -0,0 +1,42 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+func TestTypedHandler(t *testing.T) {
+	t.Parallel()
+
+	type order struct {
+		ID    string  `json:"id"`
+		Price float64 `json:"price"`
+	}
+	type total struct {
+		Total float64 `json:"total"`
+	}
+	handler := sdk.TypedHandler(func(ctx context.Context, in order) (total, error) {
+		return total{Total: in.Price * 2}, nil
+	})
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("typed").
+		AddTask("price", handler, 3).
+		AddStep("price").Then().
+		Build())
+
+	wf := env.wait(t, env.submit(t, "typed", map[string]interface{}{"id": "a", "price": 21}))
+	assertState(t, wf, pkg.WorkflowStateCompleted)
+	if wf.Output["total"] != float64(42) {
+		t.Errorf("total = %v, want 42", wf.Output["total"])
+	}
+
+	// Input that does not decode fails without using the retries
+	workflowID := env.submit(t, "typed", map[string]interface{}{"price": "free"})
+	assertState(t, env.wait(t, workflowID), pkg.WorkflowStateFailed)
+	task := env.waitForTask(t, workflowID, "price", pkg.TaskStateFailed)
+	if task.RetryCount != 0 {
+		t.Errorf("retry count = %d, want no retries for undecodable input", task.RetryCount)
+	}
+}
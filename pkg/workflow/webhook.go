@@ -0,0 +1,185 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+const (
+	webhookTickInterval = time.Second
+	webhookBatchSize    = 20
+	// webhookClaimLease outlasts webhookTimeout so a claimed delivery is
+	// not claimed again while it is being sent.
+	webhookClaimLease = time.Minute
+	webhookTimeout    = 10 * time.Second
+	// A delivery is attempted webhookMaxAttempts times, waiting
+	// webhookRetryBackoff after the first failure and doubling up to
+	// webhookMaxBackoff.
+	webhookMaxAttempts  = 8
+	webhookRetryBackoff = 10 * time.Second
+	webhookMaxBackoff   = time.Hour
+)
+
+// SetWebhookSecret makes the engine sign webhook deliveries with secret.
+// Without a secret the engine rejects submissions with webhooks and leaves
+// pending deliveries to engines that have one, so nothing is sent unsigned.
+func (e *Engine) SetWebhookSecret(secret string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.webhookSecret = secret
+}
+
+func (e *Engine) signingSecret() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.webhookSecret
+}
+
+// SubmissionWebhooks returns the webhooks the workflow's submission added to
+// those of its definition, so a resubmission can carry them over without
+// duplicating the definition's own.
+func (e *Engine) SubmissionWebhooks(workflow *pkg.Workflow) []pkg.Webhook {
+	e.mu.RLock()
+	definition := e.definitions[workflow.Name]
+	e.mu.RUnlock()
+
+	remaining := slices.Clone(definition.Webhooks)
+	var webhooks []pkg.Webhook
+	for _, webhook := range workflow.Webhooks {
+		i := slices.IndexFunc(remaining, func(other pkg.Webhook) bool {
+			return other.URL == webhook.URL && slices.Equal(other.Events, webhook.Events)
+		})
+		if i >= 0 {
+			remaining = slices.Delete(remaining, i, i+1)
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks
+}
+
+func (e *Engine) runWebhookDispatcher(ctx context.Context) {
+	store, ok := e.stateManager.(pkg.WebhookStore)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(webhookTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.stopCh:
+			return
+		case <-ticker.C:
+			e.deliverWebhooks(ctx, store)
+		}
+	}
+}
+
+// deliverWebhooks sends the deliveries that are due. Every engine runs this
+// loop; claiming through the store keeps each attempt to one engine.
+func (e *Engine) deliverWebhooks(ctx context.Context, store pkg.WebhookStore) {
+	if e.signingSecret() == "" {
+		return
+	}
+
+	deliveries, err := store.ClaimWebhookDeliveries(ctx, time.Now(), webhookClaimLease, webhookBatchSize)
+	if err != nil {
+		e.logger.Error("Failed to claim webhook deliveries", zap.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *pkg.WebhookDelivery) {
+			defer wg.Done()
+			e.deliverWebhook(ctx, store, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+// deliverWebhook makes one attempt at a delivery and records its outcome.
+// Any response outside 2xx counts as a failure and is retried with backoff.
+func (e *Engine) deliverWebhook(ctx context.Context, store pkg.WebhookStore, delivery *pkg.WebhookDelivery) {
+	status, err := e.postWebhook(ctx, delivery)
+
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	now := time.Now()
+
+	if err == nil {
+		delivery.State = pkg.WebhookDeliverySucceeded
+		delivery.Error = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	} else if delivery.Attempts >= webhookMaxAttempts {
+		delivery.State = pkg.WebhookDeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+		e.logger.Warn("Webhook delivery failed", zap.String("delivery_id", delivery.ID), zap.String("url", delivery.URL), zap.Error(err))
+	} else {
+		backoff := webhookRetryBackoff << (delivery.Attempts - 1)
+		if backoff > webhookMaxBackoff || backoff <= 0 {
+			backoff = webhookMaxBackoff
+		}
+		next := now.Add(backoff)
+		delivery.State = pkg.WebhookDeliveryPending
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := store.SaveWebhookDelivery(ctx, delivery); err != nil {
+		e.logger.Error("Failed to save webhook delivery", zap.String("delivery_id", delivery.ID), zap.Error(err))
+	}
+}
+
+func (e *Engine) postWebhook(ctx context.Context, delivery *pkg.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "temjob-webhook")
+	request.Header.Set("X-Temjob-Event", string(delivery.Event))
+	request.Header.Set("X-Temjob-Delivery", delivery.ID)
+	request.Header.Set("X-Temjob-Timestamp", strconv.FormatInt(timestamp, 10))
+
+	secret := e.signingSecret()
+	if secret == "" {
+		return 0, fmt.Errorf("webhook secret not configured")
+	}
+	request.Header.Set("X-Temjob-Signature", "sha256="+pkg.SignWebhookPayload(secret, timestamp, delivery.Payload))
+
+	response, err := e.webhookClient.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
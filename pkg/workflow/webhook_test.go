@@ -0,0 +1,214 @@
+package workflow
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/state"
+)
+
+// webhookReceiver records the deliveries it receives and answers them with
+// status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *webhookReceiver) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// saveDueDelivery stores a pending delivery to url that is due now.
+func saveDueDelivery(t *testing.T, stateManager *state.MemoryStateManager, url string) *pkg.WebhookDelivery {
+	t.Helper()
+
+	now := time.Now()
+	delivery := &pkg.WebhookDelivery{
+		ID:            pkg.NewWebhookDeliveryID(),
+		WorkflowID:    "wf",
+		URL:           url,
+		Event:         pkg.EventWorkflowCompleted,
+		Payload:       []byte(`{"event":{"type":"workflow_completed"}}`),
+		State:         pkg.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}
+	if err := stateManager.SaveWebhookDelivery(context.Background(), delivery); err != nil {
+		t.Fatalf("failed to save delivery: %v", err)
+	}
+	return delivery
+}
+
+func getDelivery(t *testing.T, stateManager *state.MemoryStateManager, deliveryID string) *pkg.WebhookDelivery {
+	t.Helper()
+
+	delivery, err := stateManager.GetWebhookDelivery(context.Background(), deliveryID)
+	if err != nil {
+		t.Fatalf("failed to get delivery: %v", err)
+	}
+	return delivery
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	t.Parallel()
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	engine.SetWebhookSecret("secret")
+	delivery := saveDueDelivery(t, stateManager, server.URL)
+
+	engine.deliverWebhooks(context.Background(), stateManager)
+	if receiver.received() != 1 {
+		t.Fatalf("received %d deliveries, want 1", receiver.received())
+	}
+
+	request := receiver.requests[0]
+	if request.Header.Get("X-Temjob-Delivery") != delivery.ID || request.Header.Get("X-Temjob-Event") != string(pkg.EventWorkflowCompleted) {
+		t.Errorf("headers = %v", request.Header)
+	}
+	err := pkg.VerifyWebhookSignature("secret", request.Header.Get("X-Temjob-Timestamp"), request.Header.Get("X-Temjob-Signature"), receiver.bodies[0], time.Minute)
+	if err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	delivered := getDelivery(t, stateManager, delivery.ID)
+	if delivered.State != pkg.WebhookDeliverySucceeded || delivered.Attempts != 1 || delivered.DeliveredAt == nil || delivered.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want one successful attempt", delivered)
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	t.Parallel()
+
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	engine.SetWebhookSecret("secret")
+	delivery := saveDueDelivery(t, stateManager, server.URL)
+	ctx := context.Background()
+
+	before := time.Now()
+	engine.deliverWebhooks(ctx, stateManager)
+	failed := getDelivery(t, stateManager, delivery.ID)
+	if failed.State != pkg.WebhookDeliveryPending || failed.Attempts != 1 || failed.ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("delivery = %+v, want a pending retry after one attempt", failed)
+	}
+	if failed.NextAttemptAt == nil || failed.NextAttemptAt.Before(before.Add(webhookRetryBackoff)) {
+		t.Errorf("next attempt = %v, want after the %v backoff", failed.NextAttemptAt, webhookRetryBackoff)
+	}
+
+	// Not due again until the backoff ran out
+	engine.deliverWebhooks(ctx, stateManager)
+	if receiver.received() != 1 {
+		t.Errorf("received %d deliveries, want no attempt before the backoff", receiver.received())
+	}
+
+	// The last attempt gives up
+	now := time.Now()
+	failed.Attempts = webhookMaxAttempts - 1
+	failed.NextAttemptAt = &now
+	if err := stateManager.SaveWebhookDelivery(ctx, failed); err != nil {
+		t.Fatalf("failed to save delivery: %v", err)
+	}
+	engine.deliverWebhooks(ctx, stateManager)
+	exhausted := getDelivery(t, stateManager, delivery.ID)
+	if exhausted.State != pkg.WebhookDeliveryFailed || exhausted.Attempts != webhookMaxAttempts || exhausted.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want it failed after %d attempts", exhausted, webhookMaxAttempts)
+	}
+}
+
+func TestWebhookClaimedOnce(t *testing.T) {
+	t.Parallel()
+
+	stateManager := state.NewMemoryStateManager()
+	delivery := saveDueDelivery(t, stateManager, "http://127.0.0.1:0")
+	ctx := context.Background()
+	now := time.Now()
+
+	claimed, err := stateManager.ClaimWebhookDeliveries(ctx, now, webhookClaimLease, webhookBatchSize)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != delivery.ID {
+		t.Fatalf("first claim = %v, %v; want the delivery", claimed, err)
+	}
+
+	// Another engine checking at the same time gets nothing
+	if claimed, _ := stateManager.ClaimWebhookDeliveries(ctx, now, webhookClaimLease, webhookBatchSize); len(claimed) != 0 {
+		t.Errorf("second claim got %d deliveries, want none", len(claimed))
+	}
+
+	// A claim whose sender never recorded an outcome is taken again later
+	if claimed, _ := stateManager.ClaimWebhookDeliveries(ctx, now.Add(webhookClaimLease), webhookClaimLease, webhookBatchSize); len(claimed) != 1 {
+		t.Errorf("claim after the lease got %d deliveries, want the delivery", len(claimed))
+	}
+}
+
+func TestWebhookNotSentWithoutSecret(t *testing.T) {
+	t.Parallel()
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	delivery := saveDueDelivery(t, stateManager, server.URL)
+
+	engine.deliverWebhooks(context.Background(), stateManager)
+	if receiver.received() != 0 {
+		t.Error("an engine without a secret sent a delivery")
+	}
+
+	// The delivery is left for an engine that has a secret
+	claimed, err := stateManager.ClaimWebhookDeliveries(context.Background(), time.Now(), webhookClaimLease, webhookBatchSize)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != delivery.ID {
+		t.Errorf("claim = %v, %v; want the delivery still due", claimed, err)
+	}
+}
+
+func TestWebhookQueuedForWorkflowEvents(t *testing.T) {
+	t.Parallel()
+
+	engine, stateManager := newScheduleTestEngine(t)
+	engine.SetWebhookSecret("secret")
+	ctx := context.Background()
+
+	workflowID, err := engine.SubmitWorkflowWithOptions(ctx, "wait", nil, pkg.SubmitOptions{
+		Webhooks: []pkg.Webhook{{URL: "https://example.com/hook"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to submit workflow: %v", err)
+	}
+	finishRun(t, engine, workflowID)
+
+	deliveries, err := stateManager.ListWebhookDeliveries(ctx, workflowID)
+	if err != nil {
+		t.Fatalf("failed to list deliveries: %v", err)
+	}
+	// Without events listed, only the workflow's end is delivered
+	if len(deliveries) != 1 || deliveries[0].Event != pkg.EventWorkflowCompleted || deliveries[0].State != pkg.WebhookDeliveryPending {
+		t.Errorf("deliveries = %+v, want one pending workflow_completed delivery", deliveries)
+	}
+}
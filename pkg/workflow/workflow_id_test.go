@@ -0,0 +1,223 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+// slowHandler returns a handler that, when its input asks for it, reports
+// on started and then takes a while, so a test can act while the task runs.
+func slowHandler(started chan<- struct{}) pkg.TaskHandler {
+	return func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+		if input["slow"] == true {
+			started <- struct{}{}
+			time.Sleep(1500 * time.Millisecond)
+		}
+		return map[string]interface{}{}, nil
+	}
+}
+
+func TestWorkflowIDRejectDuplicate(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("dup").
+		AddTask("t", echoHandler, 0).
+		AddStep("t").Then().
+		Build())
+	ctx := context.Background()
+	options := pkg.SubmitOptions{WorkflowID: "order-1"}
+
+	workflowID, err := env.engine.SubmitWorkflowWithOptions(ctx, "dup", nil, options)
+	if err != nil || workflowID != "order-1" {
+		t.Fatalf("first submit = %q, %v", workflowID, err)
+	}
+	env.wait(t, workflowID)
+
+	workflowID, err = env.engine.SubmitWorkflowWithOptions(ctx, "dup", nil, options)
+	if !errors.Is(err, pkg.ErrWorkflowExists) || workflowID != "order-1" {
+		t.Errorf("second submit = %q, %v; want the existing ID and ErrWorkflowExists", workflowID, err)
+	}
+}
+
+func TestWorkflowIDTooLong(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("long").Build())
+	options := pkg.SubmitOptions{WorkflowID: strings.Repeat("x", pkg.MaxWorkflowIDLength+1)}
+	if _, err := env.engine.SubmitWorkflowWithOptions(context.Background(), "long", nil, options); err == nil {
+		t.Error("submit with an over-long ID succeeded")
+	}
+}
+
+func TestWorkflowIDAllowFailed(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("retry").
+		AddTask("t", func(ctx context.Context, input map[string]interface{}) (map[string]interface{}, error) {
+			if input["fail"] == true {
+				return nil, pkg.NonRetryable(errors.New("bad input"))
+			}
+			return map[string]interface{}{}, nil
+		}, 0).
+		AddStep("t").Then().
+		Build())
+	ctx := context.Background()
+	options := pkg.SubmitOptions{WorkflowID: "job-1", IDReusePolicy: pkg.WorkflowIDReuseAllowFailed}
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "retry", map[string]interface{}{"fail": true}, options); err != nil {
+		t.Fatalf("first submit: %v", err)
+	}
+	assertState(t, env.wait(t, "job-1"), pkg.WorkflowStateFailed)
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "retry", nil, options); err != nil {
+		t.Fatalf("resubmit after failure: %v", err)
+	}
+	assertState(t, env.wait(t, "job-1"), pkg.WorkflowStateCompleted)
+
+	tasks, err := env.stateManager.GetWorkflowTasks(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("failed to get tasks: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].State != pkg.TaskStateCompleted {
+		t.Errorf("tasks after reuse = %d, want only the new run's task", len(tasks))
+	}
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "retry", nil, options); !errors.Is(err, pkg.ErrWorkflowExists) {
+		t.Errorf("resubmit after success: err = %v, want ErrWorkflowExists", err)
+	}
+}
+
+func TestWorkflowIDRejectRunning(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("running").
+		AddSignalStep("wait", "go", 0).Then().
+		Build())
+	ctx := context.Background()
+	options := pkg.SubmitOptions{WorkflowID: "run-1", IDReusePolicy: pkg.WorkflowIDReuseRejectRunning}
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "running", nil, options); err != nil {
+		t.Fatalf("first submit: %v", err)
+	}
+	env.waitForTask(t, "run-1", "wait", pkg.TaskStateWaiting)
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "running", nil, options); !errors.Is(err, pkg.ErrWorkflowExists) {
+		t.Errorf("resubmit while running: err = %v, want ErrWorkflowExists", err)
+	}
+
+	if err := env.engine.SignalWorkflow(ctx, "run-1", "go", nil); err != nil {
+		t.Fatalf("failed to signal: %v", err)
+	}
+	assertState(t, env.wait(t, "run-1"), pkg.WorkflowStateCompleted)
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "running", nil, options); err != nil {
+		t.Errorf("resubmit after completion: %v", err)
+	}
+}
+
+func TestWorkflowIDReuseDropsStaleSignals(t *testing.T) {
+	t.Parallel()
+
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("stale").
+		AddTimerStep("pause", time.Second).Then().
+		AddSignalStep("wait", "go", 2*time.Second).DependsOn("pause").Then().
+		Build())
+	ctx := context.Background()
+	options := pkg.SubmitOptions{WorkflowID: "stale-1", IDReusePolicy: pkg.WorkflowIDReuseAllowFailed}
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "stale", nil, options); err != nil {
+		t.Fatalf("first submit: %v", err)
+	}
+	// The first run is canceled before its signal step consumes the signal
+	if err := env.engine.SignalWorkflow(ctx, "stale-1", "go", nil); err != nil {
+		t.Fatalf("failed to signal: %v", err)
+	}
+	if err := env.engine.CancelWorkflow(ctx, "stale-1"); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "stale", nil, options); err != nil {
+		t.Fatalf("resubmit after cancel: %v", err)
+	}
+	wf := env.wait(t, "stale-1")
+	assertState(t, wf, pkg.WorkflowStateFailed)
+	if !strings.Contains(wf.Error, "timed out") {
+		t.Errorf("error = %q, want the new run to time out", wf.Error)
+	}
+}
+
+func TestWorkflowIDReuseAfterCancel(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{}, 1)
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("billing").
+		AddTask("slow", slowHandler(started), 0).
+		AddStep("slow").Then().
+		Build())
+	ctx := context.Background()
+	options := pkg.SubmitOptions{WorkflowID: "billing-1", IDReusePolicy: pkg.WorkflowIDReuseAllowFailed}
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "billing", map[string]interface{}{"slow": true}, options); err != nil {
+		t.Fatalf("first submit: %v", err)
+	}
+	<-started
+	if err := env.engine.CancelWorkflow(ctx, "billing-1"); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+
+	// The canceled run is still waiting on its task when the ID is reused
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "billing", nil, options); err != nil {
+		t.Fatalf("resubmit after cancel: %v", err)
+	}
+	assertState(t, env.wait(t, "billing-1"), pkg.WorkflowStateCompleted)
+
+	tasks, err := env.stateManager.GetWorkflowTasks(ctx, "billing-1")
+	if err != nil {
+		t.Fatalf("failed to get tasks: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Errorf("tasks after reuse = %d, want only the new run's task", len(tasks))
+	}
+}
+
+func TestWorkflowIDReuseKeepsConcurrencySlot(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{}, 1)
+	env := newTestEnv(t, sdk.NewWorkflowBuilder("limited").
+		AddTask("slow", slowHandler(started), 0).
+		AddStep("slow").Then().
+		AddSignalStep("wait", "go", 0).DependsOn("slow").Then().
+		MaxConcurrency(1).
+		RejectOverLimit().
+		Build())
+	ctx := context.Background()
+	options := pkg.SubmitOptions{WorkflowID: "limited-1", IDReusePolicy: pkg.WorkflowIDReuseAllowFailed}
+
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "limited", map[string]interface{}{"slow": true}, options); err != nil {
+		t.Fatalf("first submit: %v", err)
+	}
+	<-started
+	if err := env.engine.CancelWorkflow(ctx, "limited-1"); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if _, err := env.engine.SubmitWorkflowWithOptions(ctx, "limited", nil, options); err != nil {
+		t.Fatalf("resubmit after cancel: %v", err)
+	}
+	env.waitForTask(t, "limited-1", "wait", pkg.TaskStateWaiting)
+
+	// The canceled run must not have released the slot of the new one
+	if _, err := env.engine.SubmitWorkflow(ctx, "limited", nil); !errors.Is(err, pkg.ErrConcurrencyLimit) {
+		t.Errorf("submit while the reused ID runs: err = %v, want ErrConcurrencyLimit", err)
+	}
+
+	if err := env.engine.SignalWorkflow(ctx, "limited-1", "go", nil); err != nil {
+		t.Fatalf("failed to signal: %v", err)
+	}
+	assertState(t, env.wait(t, "limited-1"), pkg.WorkflowStateCompleted)
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// sseKeepAlive is how often an idle stream sends a comment so proxies do not
+// close the connection.
+const sseKeepAlive = 15 * time.Second
+
+// streamEvents sends the events of every workflow as server-sent events.
+func (s *Server) streamEvents(c *gin.Context) {
+	s.streamHistoryEvents(c, "")
+}
+
+// streamWorkflowEvents sends the events of one workflow as server-sent events.
+func (s *Server) streamWorkflowEvents(c *gin.Context) {
+	workflowID := c.Param("id")
+
+	if _, err := s.stateManager.GetWorkflow(c.Request.Context(), workflowID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.streamHistoryEvents(c, workflowID)
+}
+
+// streamHistoryEvents writes each history event as the JSON data of an SSE
+// "message" event, so browsers receive them all through onmessage.
+func (s *Server) streamHistoryEvents(c *gin.Context, workflowID string) {
+	bus, ok := s.stateManager.(pkg.EventBus)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "state manager does not stream events"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	events, err := bus.SubscribeEvents(ctx, workflowID)
+	if err != nil {
+		s.logger.Error("Failed to subscribe to events", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	// Send the headers right away so clients see the stream open.
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("message", event)
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		}
+	})
+}
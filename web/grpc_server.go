@@ -0,0 +1,406 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	temjobv1 "github.com/XXueTu/temjob/api/temjob/v1"
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// GRPCServer serves temjobv1.WorkflowService next to the REST API, backed
+// by the same engine and state manager.
+type GRPCServer struct {
+	temjobv1.UnimplementedWorkflowServiceServer
+
+	stateManager pkg.StateManager
+	engine       pkg.WorkflowEngine
+	logger       *zap.Logger
+	server       *grpc.Server
+}
+
+func NewGRPCServer(stateManager pkg.StateManager, engine pkg.WorkflowEngine, logger *zap.Logger) *GRPCServer {
+	server := &GRPCServer{
+		stateManager: stateManager,
+		engine:       engine,
+		logger:       logger,
+		server:       grpc.NewServer(),
+	}
+
+	temjobv1.RegisterWorkflowServiceServer(server.server, server)
+	return server
+}
+
+func (s *GRPCServer) Start(port string) error {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %s: %w", port, err)
+	}
+
+	s.logger.Info("Starting gRPC server", zap.String("port", port))
+	return s.server.Serve(listener)
+}
+
+// Stop waits for in-flight calls to finish; event streams are closed
+// right away since they never finish on their own.
+func (s *GRPCServer) Stop() {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		s.server.Stop()
+	}
+}
+
+func (s *GRPCServer) SubmitWorkflow(ctx context.Context, req *temjobv1.SubmitWorkflowRequest) (*temjobv1.SubmitWorkflowResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	webhooks := make([]pkg.Webhook, len(req.GetWebhooks()))
+	for i, webhook := range req.GetWebhooks() {
+		webhooks[i] = pkg.Webhook{URL: webhook.GetUrl()}
+		for _, event := range webhook.GetEvents() {
+			webhooks[i].Events = append(webhooks[i].Events, pkg.EventType(event))
+		}
+	}
+
+	input := req.GetInput().AsMap()
+	workflowID, err := s.engine.SubmitWorkflowWithOptions(ctx, req.GetName(), input, pkg.SubmitOptions{
+		WorkflowID:    req.GetWorkflowId(),
+		IDReusePolicy: pkg.WorkflowIDReusePolicy(req.GetIdReusePolicy()),
+		Priority:      int(req.GetPriority()),
+		Webhooks:      webhooks,
+	})
+	if err != nil {
+		return nil, s.submitError(err)
+	}
+
+	return &temjobv1.SubmitWorkflowResponse{WorkflowId: workflowID}, nil
+}
+
+func (s *GRPCServer) GetWorkflow(ctx context.Context, req *temjobv1.GetWorkflowRequest) (*temjobv1.GetWorkflowResponse, error) {
+	workflow, err := s.stateManager.GetWorkflow(ctx, req.GetWorkflowId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	message, err := workflowToProto(workflow)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &temjobv1.GetWorkflowResponse{Workflow: message}, nil
+}
+
+func (s *GRPCServer) ListWorkflows(ctx context.Context, req *temjobv1.ListWorkflowsRequest) (*temjobv1.ListWorkflowsResponse, error) {
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = 50
+	}
+
+	workflows, err := s.stateManager.ListWorkflows(ctx, limit, int(req.GetOffset()))
+	if err != nil {
+		s.logger.Error("Failed to list workflows", zap.Error(err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	response := &temjobv1.ListWorkflowsResponse{Workflows: make([]*temjobv1.Workflow, 0, len(workflows))}
+	for _, workflow := range workflows {
+		message, err := workflowToProto(workflow)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		response.Workflows = append(response.Workflows, message)
+	}
+	return response, nil
+}
+
+func (s *GRPCServer) CancelWorkflow(ctx context.Context, req *temjobv1.CancelWorkflowRequest) (*temjobv1.CancelWorkflowResponse, error) {
+	if _, err := s.stateManager.GetWorkflow(ctx, req.GetWorkflowId()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err := s.engine.CancelWorkflow(ctx, req.GetWorkflowId()); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &temjobv1.CancelWorkflowResponse{}, nil
+}
+
+// RetryWorkflow resubmits the workflow under its own ID, which the
+// allow_failed reuse policy only permits once it failed or was canceled. The
+// webhooks of the original submission are kept; the definition adds its own
+// again.
+func (s *GRPCServer) RetryWorkflow(ctx context.Context, req *temjobv1.RetryWorkflowRequest) (*temjobv1.RetryWorkflowResponse, error) {
+	workflow, err := s.stateManager.GetWorkflow(ctx, req.GetWorkflowId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	workflowID, err := s.engine.SubmitWorkflowWithOptions(ctx, workflow.Name, workflow.Input, pkg.SubmitOptions{
+		WorkflowID:    workflow.ID,
+		IDReusePolicy: pkg.WorkflowIDReuseAllowFailed,
+		Priority:      workflow.Priority,
+		Webhooks:      s.engine.SubmissionWebhooks(workflow),
+	})
+	if err != nil {
+		if errors.Is(err, pkg.ErrWorkflowExists) {
+			return nil, status.Errorf(codes.FailedPrecondition, "cannot retry workflow in state: %s", workflow.State)
+		}
+		return nil, s.submitError(err)
+	}
+
+	return &temjobv1.RetryWorkflowResponse{WorkflowId: workflowID}, nil
+}
+
+func (s *GRPCServer) SignalWorkflow(ctx context.Context, req *temjobv1.SignalWorkflowRequest) (*temjobv1.SignalWorkflowResponse, error) {
+	if req.GetSignalName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "signal_name is required")
+	}
+	if _, err := s.stateManager.GetWorkflow(ctx, req.GetWorkflowId()); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	var payload map[string]interface{}
+	if req.GetPayload() != nil {
+		payload = req.GetPayload().AsMap()
+	}
+
+	err := s.engine.SignalWorkflow(ctx, req.GetWorkflowId(), req.GetSignalName(), payload)
+	if errors.Is(err, pkg.ErrWorkflowEnded) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("Failed to signal workflow", zap.Error(err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &temjobv1.SignalWorkflowResponse{}, nil
+}
+
+func (s *GRPCServer) GetTask(ctx context.Context, req *temjobv1.GetTaskRequest) (*temjobv1.GetTaskResponse, error) {
+	task, err := s.stateManager.GetTask(ctx, req.GetTaskId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	message, err := taskToProto(task)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &temjobv1.GetTaskResponse{Task: message}, nil
+}
+
+func (s *GRPCServer) ListWorkflowTasks(ctx context.Context, req *temjobv1.ListWorkflowTasksRequest) (*temjobv1.ListWorkflowTasksResponse, error) {
+	tasks, err := s.stateManager.GetWorkflowTasks(ctx, req.GetWorkflowId())
+	if err != nil {
+		s.logger.Error("Failed to get workflow tasks", zap.Error(err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	response := &temjobv1.ListWorkflowTasksResponse{Tasks: make([]*temjobv1.Task, 0, len(tasks))}
+	for _, task := range tasks {
+		message, err := taskToProto(task)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		response.Tasks = append(response.Tasks, message)
+	}
+	return response, nil
+}
+
+func (s *GRPCServer) WatchEvents(req *temjobv1.WatchEventsRequest, stream grpc.ServerStreamingServer[temjobv1.WatchEventsResponse]) error {
+	bus, ok := s.stateManager.(pkg.EventBus)
+	if !ok {
+		return status.Error(codes.Unimplemented, "state manager does not stream events")
+	}
+
+	ctx := stream.Context()
+	if req.GetWorkflowId() != "" {
+		if _, err := s.stateManager.GetWorkflow(ctx, req.GetWorkflowId()); err != nil {
+			return status.Error(codes.NotFound, err.Error())
+		}
+	}
+
+	events, err := bus.SubscribeEvents(ctx, req.GetWorkflowId())
+	if err != nil {
+		s.logger.Error("Failed to subscribe to events", zap.Error(err))
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for event := range events {
+		message, err := eventToProto(event)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(&temjobv1.WatchEventsResponse{Event: message}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// submitError maps submission errors to status codes the way submitWorkflow
+// maps them to HTTP statuses.
+func (s *GRPCServer) submitError(err error) error {
+	switch {
+	case errors.Is(err, pkg.ErrWorkflowExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, pkg.ErrDefinitionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, pkg.ErrInvalidInput):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, pkg.ErrConcurrencyLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		s.logger.Error("Failed to submit workflow", zap.Error(err))
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func workflowToProto(workflow *pkg.Workflow) (*temjobv1.Workflow, error) {
+	input, err := toStruct(workflow.Input)
+	if err != nil {
+		return nil, err
+	}
+	output, err := toStruct(workflow.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &temjobv1.Workflow{
+		Id:             workflow.ID,
+		Name:           workflow.Name,
+		Input:          input,
+		Output:         output,
+		State:          string(workflow.State),
+		Error:          workflow.Error,
+		Tasks:          workflow.Tasks,
+		CreatedAt:      timestamppb.New(workflow.CreatedAt),
+		StartedAt:      toTimestamp(workflow.StartedAt),
+		EndedAt:        toTimestamp(workflow.EndedAt),
+		ConcurrencyKey: workflow.ConcurrencyKey,
+		WaitingReason:  workflow.WaitingReason,
+		Priority:       int32(workflow.Priority),
+	}, nil
+}
+
+func taskToProto(task *pkg.Task) (*temjobv1.Task, error) {
+	input, err := toStruct(task.Input)
+	if err != nil {
+		return nil, err
+	}
+	output, err := toStruct(task.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]*temjobv1.TaskAttempt, 0, len(task.Attempts))
+	for _, attempt := range task.Attempts {
+		attemptOutput, err := toStruct(attempt.Output)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &temjobv1.TaskAttempt{
+			Attempt:   int32(attempt.Attempt),
+			WorkerId:  attempt.WorkerID,
+			State:     string(attempt.State),
+			StartedAt: toTimestamp(attempt.StartedAt),
+			EndedAt:   toTimestamp(attempt.EndedAt),
+			Error:     attempt.Error,
+			Output:    attemptOutput,
+		})
+	}
+
+	var progress *temjobv1.TaskProgress
+	if task.Progress != nil {
+		progress = &temjobv1.TaskProgress{
+			Percent:   task.Progress.Percent,
+			Current:   task.Progress.Current,
+			Total:     task.Progress.Total,
+			Message:   task.Progress.Message,
+			Attempt:   int32(task.Progress.Attempt),
+			UpdatedAt: timestamppb.New(task.Progress.UpdatedAt),
+		}
+	}
+
+	return &temjobv1.Task{
+		Id:          task.ID,
+		WorkflowId:  task.WorkflowID,
+		Type:        task.Type,
+		Kind:        string(task.Kind),
+		Input:       input,
+		Output:      output,
+		State:       string(task.State),
+		Error:       task.Error,
+		RetryCount:  int32(task.RetryCount),
+		MaxRetries:  int32(task.MaxRetries),
+		CreatedAt:   timestamppb.New(task.CreatedAt),
+		StartedAt:   toTimestamp(task.StartedAt),
+		CompletedAt: toTimestamp(task.CompletedAt),
+		WorkerId:    task.WorkerID,
+		WakeAt:      toTimestamp(task.WakeAt),
+		Attempts:    attempts,
+		Priority:    int32(task.Priority),
+		Progress:    progress,
+	}, nil
+}
+
+func eventToProto(event *pkg.HistoryEvent) (*temjobv1.WorkflowEvent, error) {
+	metadata, err := toStruct(event.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &temjobv1.WorkflowEvent{
+		Id:         event.ID,
+		WorkflowId: event.WorkflowID,
+		TaskId:     event.TaskID,
+		Type:       string(event.Type),
+		Level:      event.Level,
+		Message:    event.Message,
+		Metadata:   metadata,
+		CreatedAt:  timestamppb.New(event.CreatedAt),
+	}, nil
+}
+
+// toStruct converts through JSON so any value the REST API can encode, not
+// just the plain types structpb.NewStruct accepts, survives the conversion.
+func toStruct(values map[string]interface{}) (*structpb.Struct, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal struct: %w", err)
+	}
+
+	result := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("failed to convert struct: %w", err)
+	}
+	return result, nil
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
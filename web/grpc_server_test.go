@@ -0,0 +1,82 @@
+package web
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	temjobv1 "github.com/XXueTu/temjob/api/temjob/v1"
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/sdk"
+)
+
+func TestGRPCSignalEndedWorkflow(t *testing.T) {
+	s := newTestServer(t)
+	workflowID := s.canceledWorkflow(t)
+	grpcServer := NewGRPCServer(s.stateManager, s.engine, zap.NewNop())
+
+	_, err := grpcServer.SignalWorkflow(context.Background(), &temjobv1.SignalWorkflowRequest{
+		WorkflowId: workflowID,
+		SignalName: "go",
+	})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("signal to a canceled workflow: err = %v, want FailedPrecondition", err)
+	}
+}
+
+func TestGRPCRetryWorkflowKeepsWebhooks(t *testing.T) {
+	s := newTestServer(t, sdk.NewWorkflowBuilder("notified").
+		AddSignalStep("wait", "go", 0).Then().
+		Webhook("https://example.com/definition").
+		Build())
+	s.engine.SetWebhookSecret("secret")
+	grpcServer := NewGRPCServer(s.stateManager, s.engine, zap.NewNop())
+	ctx := context.Background()
+
+	submitted := pkg.Webhook{URL: "https://example.com/submission", Events: []pkg.EventType{pkg.EventWorkflowFailed}}
+	workflowID, err := s.engine.SubmitWorkflowWithOptions(ctx, "notified", nil, pkg.SubmitOptions{
+		Webhooks: []pkg.Webhook{submitted},
+	})
+	if err != nil {
+		t.Fatalf("failed to submit workflow: %v", err)
+	}
+	if err := s.engine.CancelWorkflow(ctx, workflowID); err != nil {
+		t.Fatalf("failed to cancel workflow: %v", err)
+	}
+
+	// Retried while the canceled run is still waiting for its signal
+	if _, err := grpcServer.RetryWorkflow(ctx, &temjobv1.RetryWorkflowRequest{WorkflowId: workflowID}); err != nil {
+		t.Fatalf("failed to retry workflow: %v", err)
+	}
+
+	workflow, err := s.stateManager.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		t.Fatalf("failed to get workflow: %v", err)
+	}
+	want := []pkg.Webhook{{URL: "https://example.com/definition"}, submitted}
+	if !slices.EqualFunc(workflow.Webhooks, want, func(a, b pkg.Webhook) bool {
+		return a.URL == b.URL && slices.Equal(a.Events, b.Events)
+	}) {
+		t.Errorf("webhooks = %+v, want %+v", workflow.Webhooks, want)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tasks, err := s.stateManager.GetWorkflowTasks(ctx, workflowID)
+		if err != nil {
+			t.Fatalf("failed to get tasks: %v", err)
+		}
+		if len(tasks) == 1 && tasks[0].State == pkg.TaskStateWaiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("retried workflow did not reach its signal step, tasks = %d", len(tasks))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,339 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+const (
+	defaultLeaseTTL = time.Minute
+	maxLeaseTTL     = time.Hour
+)
+
+// Remote workers pull tasks over HTTP instead of reading the Redis queue:
+// they poll for a task, renew its lease with heartbeats while it runs and
+// report the outcome with complete or fail. Heartbeats and reports may
+// carry the handler's log lines, which are stored as the task's logs. A
+// task whose lease expires is failed and retried like any other failed
+// attempt. Reports name the attempt they finish, so a report repeated after
+// a lost response is answered 200 once its outcome is recorded.
+
+type pollRequest struct {
+	WorkerID string `json:"worker_id" binding:"required"`
+	// Lease is a Go duration string such as "60s"; heartbeats must renew
+	// the lease before it runs out.
+	Lease string `json:"lease"`
+}
+
+type heartbeatRequest struct {
+	WorkerID string `json:"worker_id" binding:"required"`
+	Lease    string `json:"lease"`
+	// Progress, when set, is stored on the task once the lease is renewed.
+	Progress *pkg.TaskProgress   `json:"progress"`
+	Logs     []*pkg.TaskLogEntry `json:"logs"`
+}
+
+type completeRequest struct {
+	WorkerID string `json:"worker_id" binding:"required"`
+	// Attempt is the task's retry count plus one when it was polled.
+	Attempt int                    `json:"attempt"`
+	Output  map[string]interface{} `json:"output"`
+	Logs    []*pkg.TaskLogEntry    `json:"logs"`
+}
+
+type failRequest struct {
+	WorkerID     string              `json:"worker_id" binding:"required"`
+	Attempt      int                 `json:"attempt"`
+	Error        string              `json:"error" binding:"required"`
+	NonRetryable bool                `json:"non_retryable"`
+	Logs         []*pkg.TaskLogEntry `json:"logs"`
+}
+
+// taskReport is the outcome of an attempt a remote worker reports.
+type taskReport struct {
+	workerID  string
+	attempt   int
+	state     pkg.TaskState
+	output    map[string]interface{}
+	errMsg    string
+	retryable bool
+	logs      []*pkg.TaskLogEntry
+}
+
+func (s *Server) taskLeaser(c *gin.Context) (pkg.TaskLeaser, bool) {
+	leaser, ok := s.taskQueue.(pkg.TaskLeaser)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "task queue does not support remote workers"})
+	}
+	return leaser, ok
+}
+
+func parseLease(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultLeaseTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if ttl < time.Second || ttl > maxLeaseTTL {
+		return 0, errors.New("lease must be between 1s and 1h")
+	}
+	return ttl, nil
+}
+
+// pollTask blocks until a task is available, for up to 30 seconds, and
+// answers 204 when none arrived. The task is dequeued and leased with a
+// context detached from the request, so a client hanging up mid-poll cannot
+// strand a dequeued task without a lease.
+func (s *Server) pollTask(c *gin.Context) {
+	var req pollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl, err := parseLease(req.Lease)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	leaser, ok := s.taskLeaser(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	task, err := s.taskQueue.Dequeue(ctx, req.WorkerID)
+	if err != nil {
+		s.logger.Error("Failed to dequeue task for remote worker", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if task == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	expiresAt, err := leaser.AcquireLease(ctx, task.ID, req.WorkerID, ttl)
+	if err != nil {
+		s.logger.Error("Failed to lease task", zap.String("task_id", task.ID), zap.Error(err))
+		if err := s.taskQueue.UpdateTaskState(ctx, task.ID, pkg.TaskStateFailed, nil, "failed to lease task"); err != nil {
+			s.logger.Error("Failed to fail unleased task", zap.String("task_id", task.ID), zap.Error(err))
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = pkg.RecordEvent(ctx, s.stateManager, &pkg.HistoryEvent{
+		WorkflowID: task.WorkflowID,
+		TaskID:     task.ID,
+		Type:       pkg.EventTaskStarted,
+		Message:    "Task started: " + task.Type,
+		Metadata: map[string]interface{}{
+			"worker_id": req.WorkerID,
+			"attempt":   task.RetryCount + 1,
+			"remote":    true,
+		},
+	})
+	if err != nil {
+		s.logger.Warn("Failed to record history event", zap.String("task_id", task.ID), zap.Error(err))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task":             task,
+		"lease_expires_at": expiresAt,
+	})
+}
+
+func (s *Server) heartbeatTask(c *gin.Context) {
+	taskID := c.Param("id")
+
+	var req heartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ttl, err := parseLease(req.Lease)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	leaser, ok := s.taskLeaser(c)
+	if !ok {
+		return
+	}
+
+	expiresAt, err := leaser.RenewLease(c.Request.Context(), taskID, req.WorkerID, ttl)
+	if err != nil {
+		s.leaseError(c, err)
+		return
+	}
+
+	if store, ok := s.taskQueue.(pkg.ProgressStore); ok && req.Progress != nil {
+		if err := store.SetTaskProgress(c.Request.Context(), taskID, *req.Progress); err != nil {
+			s.logger.Error("Failed to set task progress", zap.String("task_id", taskID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	s.appendTaskLogs(c.Request.Context(), taskID, req.Logs)
+
+	c.JSON(http.StatusOK, gin.H{"lease_expires_at": expiresAt})
+}
+
+func (s *Server) completeTask(c *gin.Context) {
+	taskID := c.Param("id")
+
+	var req completeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.finishTask(c, taskID, taskReport{
+		workerID:  req.WorkerID,
+		attempt:   req.Attempt,
+		state:     pkg.TaskStateCompleted,
+		output:    req.Output,
+		retryable: true,
+		logs:      req.Logs,
+	})
+}
+
+func (s *Server) failTask(c *gin.Context) {
+	taskID := c.Param("id")
+
+	var req failRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.finishTask(c, taskID, taskReport{
+		workerID:  req.WorkerID,
+		attempt:   req.Attempt,
+		state:     pkg.TaskStateFailed,
+		errMsg:    req.Error,
+		retryable: !req.NonRetryable,
+		logs:      req.Logs,
+	})
+}
+
+// finishTask releases the worker's lease and records the attempt's outcome.
+// Releasing first means a worker racing its own lease expiry either reports
+// the outcome or gets 409, never both it and the reclaimer. If the outcome
+// cannot be recorded the lease is restored, so the worker can retry the
+// report or the lease expires and the attempt is reclaimed. The attempt's
+// last log lines are stored before its outcome, so they are in place once
+// the workflow moves on.
+func (s *Server) finishTask(c *gin.Context, taskID string, report taskReport) {
+	leaser, ok := s.taskLeaser(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	if err := leaser.ReleaseLease(ctx, taskID, report.workerID); err != nil {
+		if errors.Is(err, pkg.ErrLeaseLost) && s.reportRecorded(ctx, taskID, report) {
+			c.JSON(http.StatusOK, gin.H{"message": "Task state already recorded"})
+			return
+		}
+		s.leaseError(c, err)
+		return
+	}
+	s.appendTaskLogs(ctx, taskID, report.logs)
+
+	var err error
+	if failer, ok := s.taskQueue.(pkg.TaskFailer); ok && !report.retryable {
+		err = failer.FailTask(ctx, taskID, report.errMsg, false)
+	} else {
+		err = s.taskQueue.UpdateTaskState(ctx, taskID, report.state, report.output, report.errMsg)
+	}
+	if err != nil {
+		s.logger.Error("Failed to update task state", zap.String("task_id", taskID), zap.Error(err))
+		if _, leaseErr := leaser.AcquireLease(ctx, taskID, report.workerID, defaultLeaseTTL); leaseErr != nil {
+			s.logger.Error("Failed to restore task lease", zap.String("task_id", taskID), zap.Error(leaseErr))
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Task state updated successfully"})
+}
+
+// reportRecorded reports whether the task's history already holds the
+// outcome of report, recorded by an earlier delivery of the same report. An
+// attempt reclaimed after its lease expired does not match, since the
+// reclaimer records its own error.
+func (s *Server) reportRecorded(ctx context.Context, taskID string, report taskReport) bool {
+	if report.attempt == 0 {
+		return false
+	}
+
+	task, err := s.stateManager.GetTask(ctx, taskID)
+	if err != nil {
+		return false
+	}
+	for _, attempt := range task.Attempts {
+		if attempt.Attempt == report.attempt && attempt.WorkerID == report.workerID &&
+			attempt.State == report.state && attempt.Error == report.errMsg {
+			return true
+		}
+	}
+	return false
+}
+
+// appendTaskLogs stores log lines a remote worker sent for a task it holds
+// the lease of. The task, workflow and attempt are taken from the task
+// rather than the lines. Failures are logged, not returned, so losing log lines
+// never fails the heartbeat or report carrying them.
+func (s *Server) appendTaskLogs(ctx context.Context, taskID string, logs []*pkg.TaskLogEntry) {
+	store, ok := s.stateManager.(pkg.TaskLogStore)
+	if !ok || len(logs) == 0 {
+		return
+	}
+
+	task, err := s.stateManager.GetTask(ctx, taskID)
+	if err != nil {
+		s.logger.Warn("Failed to store remote task logs", zap.String("task_id", taskID), zap.Error(err))
+		return
+	}
+
+	for _, entry := range logs {
+		if entry == nil {
+			continue
+		}
+		entry.TaskID = task.ID
+		entry.WorkflowID = task.WorkflowID
+		entry.Attempt = task.RetryCount + 1
+		entry.Seq = 0
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = time.Now()
+		}
+		if err := store.AppendTaskLog(ctx, entry); err != nil {
+			s.logger.Warn("Failed to store remote task log", zap.String("task_id", taskID), zap.Error(err))
+			return
+		}
+	}
+}
+
+func (s *Server) leaseError(c *gin.Context, err error) {
+	if errors.Is(err, pkg.ErrLeaseLost) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	s.logger.Error("Failed to update task lease", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
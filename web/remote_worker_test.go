@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+)
+
+// enqueueRemoteTask stores and enqueues a task for a remote worker to poll.
+func (s *testServer) enqueueRemoteTask(t *testing.T, maxRetries int) *pkg.Task {
+	t.Helper()
+
+	task := &pkg.Task{
+		ID:         pkg.NewTaskID(),
+		WorkflowID: "remote",
+		Type:       "remote",
+		State:      pkg.TaskStatePending,
+		MaxRetries: maxRetries,
+		CreatedAt:  time.Now(),
+	}
+	ctx := context.Background()
+	if err := s.stateManager.SaveTask(ctx, task); err != nil {
+		t.Fatalf("failed to save task: %v", err)
+	}
+	if err := s.taskQueue.Enqueue(ctx, task); err != nil {
+		t.Fatalf("failed to enqueue task: %v", err)
+	}
+	return task
+}
+
+// poll leases the next task to workerID.
+func (s *testServer) poll(t *testing.T, workerID, lease string) *pkg.Task {
+	t.Helper()
+
+	var response struct {
+		Task *pkg.Task `json:"task"`
+	}
+	code := s.do(t, http.MethodPost, "/api/v1/worker/poll", map[string]interface{}{"worker_id": workerID, "lease": lease}, &response)
+	if code != http.StatusOK || response.Task == nil {
+		t.Fatalf("poll: status = %d, task = %v", code, response.Task)
+	}
+	return response.Task
+}
+
+func TestRemoteWorkerRepeatedReport(t *testing.T) {
+	s := newTestServer(t)
+	task := s.enqueueRemoteTask(t, 0)
+	s.poll(t, "remote-1", "60s")
+
+	path := "/api/v1/worker/tasks/" + task.ID + "/complete"
+	report := map[string]interface{}{"worker_id": "remote-1", "attempt": 1, "output": map[string]interface{}{"ok": true}}
+	if code := s.do(t, http.MethodPost, path, report, nil); code != http.StatusOK {
+		t.Fatalf("complete: status = %d, want 200", code)
+	}
+
+	// The same report repeated after a lost response is recognized
+	if code := s.do(t, http.MethodPost, path, report, nil); code != http.StatusOK {
+		t.Errorf("repeated complete: status = %d, want 200", code)
+	}
+
+	other := map[string]interface{}{"worker_id": "remote-2", "attempt": 1}
+	if code := s.do(t, http.MethodPost, path, other, nil); code != http.StatusConflict {
+		t.Errorf("complete by another worker: status = %d, want 409", code)
+	}
+	unnamed := map[string]interface{}{"worker_id": "remote-1"}
+	if code := s.do(t, http.MethodPost, path, unnamed, nil); code != http.StatusConflict {
+		t.Errorf("repeated complete without attempt: status = %d, want 409", code)
+	}
+}
+
+func TestRemoteWorkerReportAfterReclaim(t *testing.T) {
+	s := newTestServer(t)
+	task := s.enqueueRemoteTask(t, 1)
+	s.poll(t, "remote-1", "1s")
+
+	time.Sleep(1100 * time.Millisecond)
+	if reclaimed, err := s.taskQueue.ReclaimExpiredLeases(context.Background()); err != nil || reclaimed != 1 {
+		t.Fatalf("reclaimed %d leases, %v; want 1", reclaimed, err)
+	}
+
+	path := "/api/v1/worker/tasks/" + task.ID + "/heartbeat"
+	if code := s.do(t, http.MethodPost, path, map[string]interface{}{"worker_id": "remote-1"}, nil); code != http.StatusConflict {
+		t.Errorf("heartbeat after reclaim: status = %d, want 409", code)
+	}
+
+	// The reclaimer recorded a failure of the same attempt, not this one
+	path = "/api/v1/worker/tasks/" + task.ID + "/fail"
+	report := map[string]interface{}{"worker_id": "remote-1", "attempt": 1, "error": "boom"}
+	if code := s.do(t, http.MethodPost, path, report, nil); code != http.StatusConflict {
+		t.Errorf("fail after reclaim: status = %d, want 409", code)
+	}
+}
+
+// failingQueue fails the next failures state updates.
+type failingQueue struct {
+	*queue.MemoryTaskQueue
+	failures int
+}
+
+func (q *failingQueue) UpdateTaskState(ctx context.Context, taskID string, state pkg.TaskState, output map[string]interface{}, errMsg string) error {
+	if q.failures > 0 {
+		q.failures--
+		return errors.New("store unavailable")
+	}
+	return q.MemoryTaskQueue.UpdateTaskState(ctx, taskID, state, output, errMsg)
+}
+
+func TestRemoteWorkerReportRestoresLease(t *testing.T) {
+	s := newTestServer(t)
+	taskQueue := &failingQueue{MemoryTaskQueue: s.taskQueue, failures: 1}
+	s.Server = NewServer(s.stateManager, taskQueue, s.engine, zap.NewNop())
+
+	task := s.enqueueRemoteTask(t, 0)
+	s.poll(t, "remote-1", "60s")
+
+	path := "/api/v1/worker/tasks/" + task.ID + "/complete"
+	report := map[string]interface{}{"worker_id": "remote-1", "attempt": 1}
+	if code := s.do(t, http.MethodPost, path, report, nil); code != http.StatusInternalServerError {
+		t.Fatalf("complete with a failing store: status = %d, want 500", code)
+	}
+
+	// The worker still holds the lease and its retried report goes through
+	if _, err := s.taskQueue.RenewLease(context.Background(), task.ID, "remote-1", time.Minute); err != nil {
+		t.Errorf("lease after a failed report: %v", err)
+	}
+	if code := s.do(t, http.MethodPost, path, report, nil); code != http.StatusOK {
+		t.Fatalf("retried complete: status = %d, want 200", code)
+	}
+
+	stored, err := s.stateManager.GetTask(context.Background(), task.ID)
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	if stored.State != pkg.TaskStateCompleted {
+		t.Errorf("task state = %s, want completed", stored.State)
+	}
+}
@@ -0,0 +1,261 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+// scheduleRequest is the REST representation of a schedule; durations are
+// Go duration strings such as "15m" or "1h30m".
+type scheduleRequest struct {
+	ID            string                 `json:"id"`
+	WorkflowName  string                 `json:"workflow_name" binding:"required"`
+	CronExpr      string                 `json:"cron_expr"`
+	Interval      string                 `json:"interval"`
+	Timezone      string                 `json:"timezone"`
+	InputTemplate map[string]interface{} `json:"input_template"`
+	OverlapPolicy pkg.OverlapPolicy      `json:"overlap_policy"`
+	Jitter        string                 `json:"jitter"`
+	Paused        bool                   `json:"paused"`
+}
+
+func (r *scheduleRequest) toSchedule() (*pkg.Schedule, error) {
+	schedule := &pkg.Schedule{
+		ID:            r.ID,
+		WorkflowName:  r.WorkflowName,
+		CronExpr:      r.CronExpr,
+		Timezone:      r.Timezone,
+		InputTemplate: r.InputTemplate,
+		OverlapPolicy: r.OverlapPolicy,
+		Paused:        r.Paused,
+	}
+
+	var err error
+	if r.Interval != "" {
+		if schedule.Interval, err = time.ParseDuration(r.Interval); err != nil {
+			return nil, err
+		}
+	}
+	if r.Jitter != "" {
+		if schedule.Jitter, err = time.ParseDuration(r.Jitter); err != nil {
+			return nil, err
+		}
+	}
+
+	return schedule, nil
+}
+
+func (s *Server) listSchedules(c *gin.Context) {
+	schedules, err := s.engine.ListSchedules(c.Request.Context())
+	if err != nil {
+		s.logger.Error("Failed to list schedules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+func (s *Server) createSchedule(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := req.toSchedule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.engine.CreateSchedule(c.Request.Context(), schedule)
+	if err != nil {
+		s.logger.Error("Failed to create schedule", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) getSchedule(c *gin.Context) {
+	schedule, err := s.engine.GetSchedule(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (s *Server) updateSchedule(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.ID = c.Param("id")
+
+	schedule, err := req.toSchedule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := s.engine.GetSchedule(c.Request.Context(), schedule.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := s.engine.UpdateSchedule(c.Request.Context(), schedule)
+	if err != nil {
+		s.logger.Error("Failed to update schedule", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func (s *Server) deleteSchedule(c *gin.Context) {
+	if err := s.engine.DeleteSchedule(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
+
+func (s *Server) pauseSchedule(c *gin.Context) {
+	if err := s.engine.PauseSchedule(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule paused successfully"})
+}
+
+func (s *Server) resumeSchedule(c *gin.Context) {
+	if err := s.engine.ResumeSchedule(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule resumed successfully"})
+}
+
+func (s *Server) triggerSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	if _, err := s.engine.GetSchedule(c.Request.Context(), scheduleID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	workflowID, err := s.engine.TriggerSchedule(c.Request.Context(), scheduleID)
+	if err != nil {
+		s.logger.Error("Failed to trigger schedule", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workflow_id": workflowID})
+}
+
+// backfillRequest is the REST form of pkg.BackfillRequest with duration
+// strings and RFC 3339 range bounds.
+type backfillRequest struct {
+	WorkflowName  string                 `json:"workflow_name"`
+	CronExpr      string                 `json:"cron_expr"`
+	Interval      string                 `json:"interval"`
+	Timezone      string                 `json:"timezone"`
+	InputTemplate map[string]interface{} `json:"input_template"`
+	Start         time.Time              `json:"start" binding:"required"`
+	End           time.Time              `json:"end" binding:"required"`
+	MaxConcurrent int                    `json:"max_concurrent"`
+}
+
+func (r *backfillRequest) toRequest() (pkg.BackfillRequest, error) {
+	request := pkg.BackfillRequest{
+		WorkflowName:  r.WorkflowName,
+		CronExpr:      r.CronExpr,
+		Timezone:      r.Timezone,
+		InputTemplate: r.InputTemplate,
+		Start:         r.Start,
+		End:           r.End,
+		MaxConcurrent: r.MaxConcurrent,
+	}
+
+	if r.Interval != "" {
+		interval, err := time.ParseDuration(r.Interval)
+		if err != nil {
+			return request, err
+		}
+		request.Interval = interval
+	}
+
+	return request, nil
+}
+
+func (s *Server) backfillSchedule(c *gin.Context) {
+	var req backfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := s.engine.GetSchedule(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.startBackfill(c, pkg.BackfillRequest{
+		ScheduleID:    c.Param("id"),
+		Start:         req.Start,
+		End:           req.End,
+		MaxConcurrent: req.MaxConcurrent,
+	})
+}
+
+func (s *Server) createBackfill(c *gin.Context) {
+	var req backfillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := req.toRequest()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.startBackfill(c, request)
+}
+
+func (s *Server) startBackfill(c *gin.Context, request pkg.BackfillRequest) {
+	backfill, err := s.engine.Backfill(c.Request.Context(), request)
+	if err != nil {
+		s.logger.Error("Failed to start backfill", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, backfill)
+}
+
+func (s *Server) getBackfill(c *gin.Context) {
+	backfill, err := s.engine.GetBackfill(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, backfill)
+}
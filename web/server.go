@@ -1,8 +1,11 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -35,11 +38,39 @@ func (s *Server) setupRoutes() {
 	api := s.router.Group("/api/v1")
 	{
 		api.GET("/workflows", s.listWorkflows)
+		api.POST("/workflows", s.submitWorkflow)
 		api.GET("/workflows/:id", s.getWorkflow)
+		api.GET("/workflows/:id/result", s.getWorkflowResult)
 		api.POST("/workflows/:id/cancel", s.cancelWorkflow)
+		api.POST("/workflows/:id/signals/:name", s.signalWorkflow)
+		api.POST("/workflows/:id/approvals/:step", s.decideApproval)
+		api.GET("/workflows/:id/queries/:name", s.queryWorkflow)
+		api.GET("/workflows/:id/history", s.getWorkflowHistory)
+		api.GET("/workflows/:id/events", s.streamWorkflowEvents)
 		api.GET("/workflows/:id/tasks", s.getWorkflowTasks)
+		api.GET("/workflows/:id/webhooks", s.listWebhookDeliveries)
+		api.POST("/webhooks/deliveries/:id/redeliver", s.redeliverWebhook)
 		api.GET("/tasks/:id", s.getTask)
+		api.GET("/tasks/:id/logs", s.getTaskLogs)
+		api.GET("/definitions", s.listDefinitions)
+		api.POST("/worker/poll", s.pollTask)
+		api.POST("/worker/tasks/:id/heartbeat", s.heartbeatTask)
+		api.POST("/worker/tasks/:id/complete", s.completeTask)
+		api.POST("/worker/tasks/:id/fail", s.failTask)
 		api.GET("/stats", s.getStats)
+		api.GET("/events", s.streamEvents)
+
+		api.GET("/schedules", s.listSchedules)
+		api.POST("/schedules", s.createSchedule)
+		api.GET("/schedules/:id", s.getSchedule)
+		api.PUT("/schedules/:id", s.updateSchedule)
+		api.DELETE("/schedules/:id", s.deleteSchedule)
+		api.POST("/schedules/:id/pause", s.pauseSchedule)
+		api.POST("/schedules/:id/resume", s.resumeSchedule)
+		api.POST("/schedules/:id/trigger", s.triggerSchedule)
+		api.POST("/schedules/:id/backfill", s.backfillSchedule)
+		api.POST("/backfills", s.createBackfill)
+		api.GET("/backfills/:id", s.getBackfill)
 	}
 
 	s.router.Static("/static", "./web/static")
@@ -63,6 +94,57 @@ func (s *Server) listWorkflows(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"workflows": workflows})
 }
 
+type submitWorkflowRequest struct {
+	Name          string                    `json:"name" binding:"required"`
+	Input         map[string]interface{}    `json:"input"`
+	WorkflowID    string                    `json:"workflow_id" binding:"max=128"`
+	IDReusePolicy pkg.WorkflowIDReusePolicy `json:"id_reuse_policy" binding:"omitempty,oneof=reject_duplicate allow_failed reject_running"`
+	Priority      int                       `json:"priority"`
+	Webhooks      []pkg.Webhook             `json:"webhooks"`
+}
+
+// submitWorkflow starts a workflow of a registered definition. A taken
+// workflow_id answers 409 with the existing ID so clients can retry safely.
+func (s *Server) submitWorkflow(c *gin.Context) {
+	var req submitWorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Input == nil {
+		req.Input = make(map[string]interface{})
+	}
+
+	workflowID, err := s.engine.SubmitWorkflowWithOptions(c.Request.Context(), req.Name, req.Input, pkg.SubmitOptions{
+		WorkflowID:    req.WorkflowID,
+		IDReusePolicy: req.IDReusePolicy,
+		Priority:      req.Priority,
+		Webhooks:      req.Webhooks,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pkg.ErrWorkflowExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "workflow_id": workflowID})
+		case errors.Is(err, pkg.ErrDefinitionNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, pkg.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, pkg.ErrConcurrencyLimit):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		default:
+			s.logger.Error("Failed to submit workflow", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"workflow_id": workflowID})
+}
+
+func (s *Server) listDefinitions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"definitions": s.engine.ListDefinitions()})
+}
+
 func (s *Server) getWorkflow(c *gin.Context) {
 	workflowID := c.Param("id")
 
@@ -76,6 +158,57 @@ func (s *Server) getWorkflow(c *gin.Context) {
 	c.JSON(http.StatusOK, workflow)
 }
 
+// maxResultWait bounds how long a result request may be held open.
+const maxResultWait = time.Minute
+
+// getWorkflowResult long-polls for the end of a workflow. It answers 200
+// with the workflow once it has ended, or 202 with its current state when
+// it is still running after the requested wait.
+func (s *Server) getWorkflowResult(c *gin.Context) {
+	workflowID := c.Param("id")
+
+	wait, err := time.ParseDuration(c.DefaultQuery("wait", "30s"))
+	if err != nil || wait < 0 || wait > maxResultWait {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wait must be a duration between 0s and 1m"})
+		return
+	}
+
+	workflow, err := s.stateManager.GetWorkflow(c.Request.Context(), workflowID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !workflow.State.Terminal() && wait > 0 {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+		defer cancel()
+
+		ended, err := pkg.WaitForWorkflow(ctx, s.stateManager, workflowID)
+		switch {
+		case err == nil:
+			workflow = ended
+		case errors.Is(err, context.DeadlineExceeded):
+			if workflow, err = s.stateManager.GetWorkflow(c.Request.Context(), workflowID); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+		default:
+			if c.Request.Context().Err() != nil {
+				return
+			}
+			s.logger.Error("Failed to wait for workflow", zap.String("workflow_id", workflowID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !workflow.State.Terminal() {
+		c.JSON(http.StatusAccepted, workflow)
+		return
+	}
+	c.JSON(http.StatusOK, workflow)
+}
+
 func (s *Server) cancelWorkflow(c *gin.Context) {
 	workflowID := c.Param("id")
 
@@ -89,6 +222,129 @@ func (s *Server) cancelWorkflow(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Workflow canceled successfully"})
 }
 
+func (s *Server) signalWorkflow(c *gin.Context) {
+	workflowID := c.Param("id")
+	signalName := c.Param("name")
+
+	var payload map[string]interface{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := s.stateManager.GetWorkflow(c.Request.Context(), workflowID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := s.engine.SignalWorkflow(c.Request.Context(), workflowID, signalName, payload)
+	if errors.Is(err, pkg.ErrWorkflowEnded) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to signal workflow", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Signal sent successfully"})
+}
+
+// queryWorkflow passes the URL query parameters to the query handler as
+// args; repeated parameters arrive as a list.
+func (s *Server) queryWorkflow(c *gin.Context) {
+	workflowID := c.Param("id")
+	queryName := c.Param("name")
+
+	args := make(map[string]interface{})
+	for key, values := range c.Request.URL.Query() {
+		if len(values) == 1 {
+			args[key] = values[0]
+		} else {
+			args[key] = values
+		}
+	}
+
+	if _, err := s.stateManager.GetWorkflow(c.Request.Context(), workflowID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := s.engine.QueryWorkflow(c.Request.Context(), workflowID, queryName, args)
+	if err != nil {
+		if errors.Is(err, pkg.ErrQueryNotFound) || errors.Is(err, pkg.ErrDefinitionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		s.logger.Error("Failed to query workflow", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+func (s *Server) getWorkflowHistory(c *gin.Context) {
+	workflowID := c.Param("id")
+
+	store, ok := s.stateManager.(pkg.HistoryStore)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "state manager does not keep workflow history"})
+		return
+	}
+
+	if _, err := s.stateManager.GetWorkflow(c.Request.Context(), workflowID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := store.GetWorkflowHistory(c.Request.Context(), workflowID)
+	if err != nil {
+		s.logger.Error("Failed to get workflow history", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workflow_id": workflowID,
+		"events":      events,
+		"count":       len(events),
+	})
+}
+
+type approvalRequest struct {
+	Decision string `json:"decision" binding:"required,oneof=approved rejected"`
+	Approver string `json:"approver" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+func (s *Server) decideApproval(c *gin.Context) {
+	workflowID := c.Param("id")
+	step := c.Param("step")
+
+	var req approvalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := s.engine.DecideApproval(c.Request.Context(), workflowID, step, req.Decision, req.Approver, req.Comment)
+	if errors.Is(err, pkg.ErrNoPendingApproval) || errors.Is(err, pkg.ErrWorkflowEnded) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to record approval", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Approval recorded successfully"})
+}
+
 func (s *Server) getWorkflowTasks(c *gin.Context) {
 	workflowID := c.Param("id")
 
@@ -115,6 +371,49 @@ func (s *Server) getTask(c *gin.Context) {
 	c.JSON(http.StatusOK, task)
 }
 
+// getTaskLogs pages through a task's log lines with the after cursor; pass
+// the returned next_after to fetch newer lines, e.g. to tail a running task.
+func (s *Server) getTaskLogs(c *gin.Context) {
+	taskID := c.Param("id")
+	after, _ := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	store, ok := s.stateManager.(pkg.TaskLogStore)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "state manager does not keep task logs"})
+		return
+	}
+
+	task, err := s.stateManager.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	logs, err := store.GetTaskLogs(c.Request.Context(), taskID, after, limit)
+	if err != nil {
+		s.logger.Error("Failed to get task logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	nextAfter := after
+	if len(logs) > 0 {
+		nextAfter = logs[len(logs)-1].Seq
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":    taskID,
+		"state":      task.State,
+		"logs":       logs,
+		"next_after": nextAfter,
+		"has_more":   len(logs) == limit,
+	})
+}
+
 func (s *Server) getStats(c *gin.Context) {
 	ctx := c.Request.Context()
 
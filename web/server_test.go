@@ -0,0 +1,116 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+	"github.com/XXueTu/temjob/pkg/queue"
+	"github.com/XXueTu/temjob/pkg/sdk"
+	"github.com/XXueTu/temjob/pkg/state"
+	"github.com/XXueTu/temjob/pkg/workflow"
+)
+
+// TestMain runs the tests from the repository root, where the server finds
+// its templates and static files.
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type testServer struct {
+	*Server
+	engine       *workflow.Engine
+	stateManager *state.MemoryStateManager
+	taskQueue    *queue.MemoryTaskQueue
+}
+
+func newTestServer(t *testing.T, definitions ...pkg.WorkflowDefinition) *testServer {
+	t.Helper()
+
+	logger := zap.NewNop()
+	stateManager := state.NewMemoryStateManager()
+	taskQueue := queue.NewMemoryTaskQueue(logger, stateManager)
+	engine := workflow.NewEngine(stateManager, taskQueue, logger)
+	for _, definition := range definitions {
+		engine.RegisterWorkflow(definition)
+	}
+
+	return &testServer{
+		Server:       NewServer(stateManager, taskQueue, engine, logger),
+		engine:       engine,
+		stateManager: stateManager,
+		taskQueue:    taskQueue,
+	}
+}
+
+// do sends a JSON request to the server and decodes the JSON response into
+// out when it is not nil.
+func (s *testServer) do(t *testing.T, method, path string, body, out interface{}) int {
+	t.Helper()
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("failed to marshal request: %v", err)
+		}
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+
+	if out != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+			t.Fatalf("failed to decode response %q: %v", recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+// canceledWorkflow submits a workflow waiting for a signal and cancels it.
+func (s *testServer) canceledWorkflow(t *testing.T) string {
+	t.Helper()
+
+	s.engine.RegisterWorkflow(sdk.NewWorkflowBuilder("waiting").
+		AddSignalStep("wait", "go", 0).Then().
+		Build())
+
+	ctx := context.Background()
+	workflowID, err := s.engine.SubmitWorkflow(ctx, "waiting", nil)
+	if err != nil {
+		t.Fatalf("failed to submit workflow: %v", err)
+	}
+	if err := s.engine.CancelWorkflow(ctx, workflowID); err != nil {
+		t.Fatalf("failed to cancel workflow: %v", err)
+	}
+	return workflowID
+}
+
+func TestSignalEndedWorkflowConflicts(t *testing.T) {
+	s := newTestServer(t)
+	workflowID := s.canceledWorkflow(t)
+
+	code := s.do(t, http.MethodPost, "/api/v1/workflows/"+workflowID+"/signals/go", map[string]interface{}{"a": 1}, nil)
+	if code != http.StatusConflict {
+		t.Errorf("signal to a canceled workflow: status = %d, want 409", code)
+	}
+
+	code = s.do(t, http.MethodPost, "/api/v1/workflows/missing/signals/go", nil, nil)
+	if code != http.StatusNotFound {
+		t.Errorf("signal to a missing workflow: status = %d, want 404", code)
+	}
+}
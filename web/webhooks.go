@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/XXueTu/temjob/pkg"
+)
+
+func (s *Server) webhookStore(c *gin.Context) (pkg.WebhookStore, bool) {
+	store, ok := s.stateManager.(pkg.WebhookStore)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "state manager does not deliver webhooks"})
+	}
+	return store, ok
+}
+
+// listWebhookDeliveries returns the delivery log of a workflow's webhooks.
+func (s *Server) listWebhookDeliveries(c *gin.Context) {
+	workflowID := c.Param("id")
+
+	store, ok := s.webhookStore(c)
+	if !ok {
+		return
+	}
+
+	if _, err := s.stateManager.GetWorkflow(c.Request.Context(), workflowID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	deliveries, err := store.ListWebhookDeliveries(c.Request.Context(), workflowID)
+	if err != nil {
+		s.logger.Error("Failed to list webhook deliveries", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workflow_id": workflowID,
+		"deliveries":  deliveries,
+		"count":       len(deliveries),
+	})
+}
+
+// redeliverWebhook queues a fresh delivery of a logged delivery's payload.
+func (s *Server) redeliverWebhook(c *gin.Context) {
+	deliveryID := c.Param("id")
+
+	store, ok := s.webhookStore(c)
+	if !ok {
+		return
+	}
+
+	original, err := store.GetWebhookDelivery(c.Request.Context(), deliveryID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	delivery, err := pkg.RedeliverWebhook(c.Request.Context(), store, original)
+	if err != nil {
+		s.logger.Error("Failed to redeliver webhook", zap.String("delivery_id", deliveryID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}